@@ -52,6 +52,7 @@ func NewRootCommand(out, err io.Writer) *cobra.Command {
 	rootCmd.SilenceErrors = true
 	rootCmd.AddCommand(NewCmdVersion(out))
 	rootCmd.AddCommand(NewCmdTest(out))
+	rootCmd.AddCommand(NewCmdLicenses(out))
 
 	rootCmd.PersistentFlags().StringVarP(&v, "verbosity", "v", logrus.WarnLevel.String(), "Log level (debug, info, warn, error, fatal, panic)")
 
@@ -0,0 +1,125 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/config"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/licenses"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/version"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var licenseOpts = &config.LicenseInventoryOptions{}
+
+func NewCmdLicenses(out io.Writer) *cobra.Command {
+	var licensesCmd = &cobra.Command{
+		Use:   "licenses",
+		Short: "Lists the Debian packages in an image and their licenses",
+		Long: `Lists the Debian packages in an image along with their versions, the licenses
+detected in their copyright files and the paths of those files, as CSV or SPDX JSON.`,
+		Args: func(cmd *cobra.Command, _ []string) error {
+			return validateLicenseArgs(licenseOpts)
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if licenseOpts.OutputFile != "" {
+				f, err := os.Create(licenseOpts.OutputFile)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			return runLicenses(out)
+		},
+	}
+
+	licensesCmd.Flags().StringVarP(&licenseOpts.ImagePath, "image", "i", "", "path to image. with the tar driver, use oci:<dir>[:<ref>] for an OCI image layout")
+	licensesCmd.Flags().StringVarP(&licenseOpts.Driver, "driver", "d", "docker", "driver to use to read the image")
+	licensesCmd.Flags().StringVar(&licenseOpts.Metadata, "metadata", "", "path to image metadata file")
+	licensesCmd.Flags().StringVar(&licenseOpts.Platform, "platform", "", "platform (os/arch[/variant]) of the image to read from a multi-platform OCI image layout")
+	licensesCmd.Flags().StringVar(&licenseOpts.Format, "format", licenses.CSV, fmt.Sprintf("format of the inventory (%s)", strings.Join(licenses.Formats, ", ")))
+	licensesCmd.Flags().StringVar(&licenseOpts.OutputFile, "output-file", "", "write the inventory to the specified file instead of stdout")
+	return licensesCmd
+}
+
+func validateLicenseArgs(opts *config.LicenseInventoryOptions) error {
+	if opts.Driver == drivers.Host {
+		if opts.Metadata == "" {
+			return fmt.Errorf("Please provide path to image metadata file")
+		}
+		if opts.ImagePath != "" {
+			return fmt.Errorf("Cannot provide both image path and metadata file")
+		}
+	} else {
+		if opts.ImagePath == "" {
+			return fmt.Errorf("Please supply path to image or tarball to read")
+		}
+		if opts.Metadata != "" {
+			return fmt.Errorf("Cannot provide both image path and metadata file")
+		}
+	}
+	if drivers.IsOCILayout(opts.ImagePath) && opts.Driver != drivers.Tar {
+		return fmt.Errorf("OCI image layouts are only supported by the tar driver")
+	}
+	if opts.Platform != "" {
+		if _, err := drivers.ParsePlatform(opts.Platform); err != nil {
+			return err
+		}
+	}
+	if !utils.ValueInList(opts.Format, licenses.Formats) {
+		return fmt.Errorf("Unsupported inventory format %s, please use one of: %s", opts.Format, strings.Join(licenses.Formats, ", "))
+	}
+	return nil
+}
+
+func runLicenses(out io.Writer) error {
+	driverImpl := drivers.InitDriverImpl(licenseOpts.Driver)
+	if driverImpl == nil {
+		return fmt.Errorf("unsupported driver type: %s", licenseOpts.Driver)
+	}
+	driver, err := driverImpl(drivers.DriverConfig{
+		Image:    licenseOpts.ImagePath,
+		Metadata: licenseOpts.Metadata,
+		Platform: licenseOpts.Platform,
+	})
+	if err != nil {
+		return errors.Wrap(err, "creating driver")
+	}
+	defer driver.Destroy()
+
+	entries, err := licenses.Inventory(driver)
+	if err != nil {
+		return errors.Wrap(err, "listing licenses")
+	}
+	if licenseOpts.Format == licenses.SPDX {
+		name := licenseOpts.ImagePath
+		if name == "" {
+			name = licenseOpts.Metadata
+		}
+		tool := "container-structure-test-" + version.GetVersion().Version
+		return licenses.WriteSPDX(out, entries, name, tool, time.Now())
+	}
+	return licenses.WriteCSV(out, entries)
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/GoogleContainerTools/container-structure-test/pkg/config"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/output"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
 
@@ -59,12 +60,17 @@ func NewCmdTest(out io.Writer) *cobra.Command {
 		Short: "Runs the tests",
 		Long:  `Runs the tests`,
 		Args: func(cmd *cobra.Command, _ []string) error {
+			if opts.JSON {
+				opts.Output = output.JSON
+			}
 			return test.ValidateArgs(opts)
 		},
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			if opts.TestReport != "" {
-				// Force JsonOutput
-				opts.JSON = true
+				// Force JsonOutput, unless another report format was requested
+				if opts.Output == output.Text {
+					opts.Output = output.JSON
+				}
 				testReportFile, err := os.Create(opts.TestReport)
 				if err != nil {
 					return err
@@ -93,6 +99,8 @@ func run(out io.Writer) error {
 		Save:     opts.Save,
 		Metadata: opts.Metadata,
 		Runtime:  opts.Runtime,
+		Platform: opts.Platform,
+		Timeout:  opts.Timeout,
 	}
 
 	var err error
@@ -131,29 +139,47 @@ func run(out io.Writer) error {
 	}
 	channel := make(chan interface{}, 1)
 	go runTests(out, channel, args, driverImpl)
-	// TODO(nkubala): put a sync.WaitGroup here
-	return test.ProcessResults(out, opts.JSON, channel)
+	return test.ProcessResults(out, opts.Output, channel)
 }
 
 func runTests(out io.Writer, channel chan interface{}, args *drivers.DriverConfig, driverImpl func(drivers.DriverConfig) (drivers.Driver, error)) {
 	for _, file := range opts.ConfigFiles {
-		if !opts.JSON {
+		if opts.Output == output.Text {
 			output.Banner(out, file)
 		}
 		tests, err := test.Parse(file, args, driverImpl)
 		if err != nil {
 			channel <- &unversioned.TestResult{
+				File: file,
 				Errors: []string{
 					fmt.Sprintf("error parsing config file: %s", err),
 				},
 			}
 			continue // Continue with other config files
 		}
-		tests.RunAll(channel, file)
+		tests.SetParallelism(opts.Parallel)
+		tests.SetFilter(test.Filter(opts))
+		runFile(channel, tests, file)
 	}
 	close(channel)
 }
 
+// runFile runs all tests in a config file, recording the file on each result
+// that isn't from a test included from another file.
+func runFile(channel chan interface{}, tests types.StructureTest, file string) {
+	results := make(chan interface{}, 1)
+	go func() {
+		defer close(results)
+		tests.RunAll(results, file)
+	}()
+	for res := range results {
+		if r, ok := res.(*unversioned.TestResult); ok && r.File == "" {
+			r.File = file
+		}
+		channel <- res
+	}
+}
+
 func splitImagePath(imagePath string) []string {
 	var parts []string
 	if strings.Contains(imagePath, "@") {
@@ -180,19 +206,26 @@ func splitImagePath(imagePath string) []string {
 }
 
 func AddTestFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVarP(&opts.ImagePath, "image", "i", "", "path to test image")
+	cmd.Flags().StringVarP(&opts.ImagePath, "image", "i", "", "path to test image. with the tar driver, use oci:<dir>[:<ref>] for an OCI image layout")
 	cmd.Flags().StringVarP(&opts.Driver, "driver", "d", "docker", "driver to use when running tests")
 	cmd.Flags().StringVar(&opts.Metadata, "metadata", "", "path to image metadata file")
 	cmd.Flags().StringVar(&opts.Runtime, "runtime", "", "runtime to use with docker driver")
+	cmd.Flags().StringVar(&opts.Platform, "platform", "", "platform (os/arch[/variant]) of the image to test from a multi-platform OCI image layout")
 
 	cmd.Flags().BoolVar(&opts.Pull, "pull", false, "force a pull of the image before running tests")
 	cmd.Flags().BoolVar(&opts.Save, "save", false, "preserve created containers after test run")
 	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "flag to suppress output")
 	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "force run of host driver (without user prompt)")
-	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "output test results in json format")
+	cmd.Flags().BoolVarP(&opts.JSON, "json", "j", false, "output test results in json format (same as --output json)")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", output.Text, fmt.Sprintf("format to output test results in (%s)", strings.Join(output.Formats, ", ")))
 	cmd.Flags().BoolVar(&opts.NoColor, "no-color", false, "no color in the output")
+	cmd.Flags().IntVar(&opts.Parallel, "parallel", 1, "number of tests to run in parallel")
+	cmd.Flags().StringSliceVar(&opts.IncludeTags, "include-tags", []string{}, "only run tests with at least one of these tags, others are reported as skipped")
+	cmd.Flags().StringSliceVar(&opts.ExcludeTags, "exclude-tags", []string{}, "skip tests with any of these tags")
+	cmd.Flags().StringVar(&opts.Run, "run", "", "only run tests whose names match this regex, e.g. 'File Existence Test: .*'")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 0, "default timeout for each command run by command tests, e.g. 30s. 0 means no timeout")
 
 	cmd.Flags().StringArrayVarP(&opts.ConfigFiles, "config", "c", []string{}, "test config files")
 	cmd.MarkFlagRequired("config")
-	cmd.Flags().StringVar(&opts.TestReport, "test-report", "", "generate JSON test report and write it to specified file.")
+	cmd.Flags().StringVar(&opts.TestReport, "test-report", "", "generate test report and write it to specified file. defaults to JSON unless --output is set.")
 }
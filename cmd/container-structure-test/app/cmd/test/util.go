@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/config"
@@ -26,8 +28,10 @@ import (
 	"github.com/GoogleContainerTools/container-structure-test/pkg/output"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
@@ -47,13 +51,59 @@ func ValidateArgs(opts *config.StructureTestOptions) error {
 			return fmt.Errorf("Cannot provide both image path and metadata file")
 		}
 	}
+	if drivers.IsOCILayout(opts.ImagePath) && opts.Driver != drivers.Tar {
+		return fmt.Errorf("OCI image layouts are only supported by the tar driver")
+	}
+	if opts.Platform != "" {
+		if _, err := drivers.ParsePlatform(opts.Platform); err != nil {
+			return err
+		}
+	}
 	if len(opts.ConfigFiles) == 0 {
 		return fmt.Errorf("Please provide at least one test config file")
 	}
+	if !utils.ValueInList(opts.Output, output.Formats) {
+		return fmt.Errorf("Unsupported output format %s, please use one of: %s", opts.Output, strings.Join(output.Formats, ", "))
+	}
+	if opts.Parallel < 1 {
+		return fmt.Errorf("Please provide a positive number of parallel tests to run")
+	}
+	if opts.Timeout < 0 {
+		return fmt.Errorf("Please provide a non-negative timeout")
+	}
+	if _, err := regexp.Compile(opts.Run); err != nil {
+		return fmt.Errorf("Invalid --run regex %s: %s", opts.Run, err)
+	}
 	return nil
 }
 
+// Filter returns the filter selecting the tests to run from the command line
+// options, which must have been validated.
+func Filter(opts *config.StructureTestOptions) *unversioned.TestFilter {
+	filter := &unversioned.TestFilter{
+		IncludeTags: opts.IncludeTags,
+		ExcludeTags: opts.ExcludeTags,
+	}
+	if opts.Run != "" {
+		filter.Run = regexp.MustCompile(opts.Run)
+	}
+	return filter
+}
+
 func Parse(fp string, args *drivers.DriverConfig, driverImpl func(drivers.DriverConfig) (drivers.Driver, error)) (types.StructureTest, error) {
+	tests, err := parseFile(fp, "", nil, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	tests.SetDriverImpl(driverImpl, *args)
+	return tests, nil
+}
+
+// parseFile parses a config file and merges in the files it includes. included
+// files default to the schema version of the file including them. stack holds
+// the files currently being included, to detect cycles, and seen every file
+// parsed so far, so a file included from several others is only merged once.
+func parseFile(fp, defaultVersion string, stack []string, seen map[string]bool) (types.StructureTest, error) {
 	testContents, err := ioutil.ReadFile(fp)
 	if err != nil {
 		return nil, err
@@ -84,9 +134,15 @@ func Parse(fp string, args *drivers.DriverConfig, driverImpl func(drivers.Driver
 	}
 
 	version := versionHolder.SchemaVersion
+	if version == "" {
+		version = defaultVersion
+	}
 	if version == "" {
 		return nil, errors.New("Please provide JSON schema version")
 	}
+	if defaultVersion != "" && version != defaultVersion {
+		return nil, fmt.Errorf("schema version %s of %s does not match %s of the file including it", version, fp, defaultVersion)
+	}
 
 	var st types.StructureTest
 	if schemaVersion, ok := types.SchemaVersions[version]; ok {
@@ -99,47 +155,96 @@ func Parse(fp string, args *drivers.DriverConfig, driverImpl func(drivers.Driver
 		return nil, errors.New("error unmarshalling config: " + err.Error())
 	}
 
-	tests, _ := st.(types.StructureTest) //type assertion
-	tests.SetDriverImpl(driverImpl, *args)
-	return tests, nil
+	includer, ok := st.(types.Includer)
+	if !ok {
+		return st, nil
+	}
+	abs, err := filepath.Abs(fp)
+	if err != nil {
+		return nil, err
+	}
+	stack = append(stack, abs)
+	seen[abs] = true
+	for _, include := range includer.Includes() {
+		p := include
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(fp), p)
+		}
+		includeAbs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		if cycle := includeCycle(stack, includeAbs); cycle != "" {
+			return nil, fmt.Errorf("include cycle in %s: %s", fp, cycle)
+		}
+		if seen[includeAbs] {
+			logrus.Debugf("%s is already included, skipping include from %s", p, fp)
+			continue
+		}
+		included, err := parseFile(p, version, stack, seen)
+		if err != nil {
+			return nil, errors.Wrapf(err, "including %s from %s", include, fp)
+		}
+		if err := includer.Merge(included, p); err != nil {
+			return nil, errors.Wrapf(err, "including %s from %s", include, fp)
+		}
+	}
+	return st, nil
 }
 
-func ProcessResults(out io.Writer, json bool, c chan interface{}) error {
-	totalPass := 0
-	totalFail := 0
+// includeCycle describes the cycle formed by including p from the last file in
+// stack, or returns an empty string if there is none.
+func includeCycle(stack []string, p string) string {
+	for i, f := range stack {
+		if f == p {
+			return strings.Join(append(append([]string{}, stack[i:]...), p), " -> ")
+		}
+	}
+	return ""
+}
+
+func ProcessResults(out io.Writer, format string, c chan interface{}) error {
+	summary := unversioned.SummaryObject{}
 	errStrings := make([]string, 0)
 	results, err := channelToSlice(c)
 	if err != nil {
 		return errors.Wrap(err, "reading results from channel")
 	}
 	for _, r := range results {
-		if !json {
-			// output individual results if we're not in json mode
+		r.Status = r.State()
+		if format == output.Text {
+			// output individual results if we're in text mode
 			output.OutputResult(out, r)
 		}
-		if r.IsPass() {
-			totalPass++
-		} else {
-			totalFail++
+		switch r.Status {
+		case unversioned.StatusPass:
+			summary.Pass++
+		case unversioned.StatusSkip:
+			summary.Skipped++
+		case unversioned.StatusXFail:
+			summary.XFail++
+		case unversioned.StatusXPass:
+			// an unexpected pass is a failure too
+			summary.XPass++
+			summary.Fail++
+		default:
+			summary.Fail++
 		}
 	}
-	if totalPass+totalFail == 0 || totalFail > 0 {
+	summary.Total = len(results)
+	// a run where every test was skipped still passes
+	if summary.Total == 0 || summary.Fail > 0 {
 		errStrings = append(errStrings, "FAIL")
 	}
 	if len(errStrings) > 0 {
-		err = fmt.Errorf(strings.Join(errStrings, "\n"))
+		err = errors.New(strings.Join(errStrings, "\n"))
 	}
 
-	summary := unversioned.SummaryObject{
-		Total: totalFail + totalPass,
-		Pass:  totalPass,
-		Fail:  totalFail,
-	}
-	if json {
-		// only output results here if we're in json mode
+	if format != output.Text {
+		// only output results here if we're not in text mode
 		summary.Results = results
 	}
-	output.FinalResults(out, json, summary)
+	output.FinalResults(out, format, summary)
 
 	return err
 }
@@ -0,0 +1,153 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	v2 "github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func writeConfigs(t *testing.T, configs map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "configs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range configs {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseIncludes(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"app.yaml": `schemaVersion: '2.0.0'
+include: ['shared/base.yaml', 'shared/users.json']
+fileExistenceTests:
+- name: 'app'
+  path: '/app'
+metadataTest:
+  user: 'app'
+  exact: false
+  labels:
+  - key: 'app'
+    value: 'yes'
+`,
+		// fragments don't need a schema version, and include files relative to themselves
+		"shared/base.yaml": `include: ['users.json']
+fileExistenceTests:
+- name: 'passwd'
+  path: '/etc/passwd'
+metadataTest:
+  user: 'root'
+  workdir: '/'
+  exact: true
+  labels:
+  - key: 'maintainer'
+    value: 'team'
+`,
+		"shared/users.json": `{"userTests": [{"name": "root", "uniqueRoot": true}]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	tests, err := Parse(filepath.Join(dir, "app.yaml"), &drivers.DriverConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := tests.(*v2.StructureTest)
+	var names, files []string
+	for _, ft := range st.FileExistenceTests {
+		names = append(names, ft.Name)
+		files = append(files, ft.File)
+	}
+	testutil.CheckDeepEqual(t, []string{"passwd", "app"}, names)
+	// tests defined in the file being run are recorded as such when run
+	testutil.CheckDeepEqual(t, []string{filepath.Join(dir, "shared/base.yaml"), ""}, files)
+	// users.json is included twice, but only merged once, from base.yaml
+	testutil.CheckDeepEqual(t, 1, len(st.UserTests))
+	testutil.CheckDeepEqual(t, filepath.Join(dir, "shared/users.json"), st.UserTests[0].File)
+	testutil.CheckDeepEqual(t, "app", st.MetadataTest.User)
+	testutil.CheckDeepEqual(t, "/", st.MetadataTest.Workdir)
+	testutil.CheckDeepEqual(t, 2, len(st.MetadataTest.Labels))
+	// false overrides true in an included file
+	testutil.CheckDeepEqual(t, false, *st.MetadataTest.Exact)
+}
+
+func TestParseIncludeErrors(t *testing.T) {
+	tables := []struct {
+		name     string
+		configs  map[string]string
+		expected []string
+	}{
+		{
+			name: "cycle",
+			configs: map[string]string{
+				"app.yaml": "schemaVersion: '2.0.0'\ninclude: ['a.yaml']\n",
+				"a.yaml":   "include: ['b.yaml']\n",
+				"b.yaml":   "include: ['a.yaml']\n",
+			},
+			expected: []string{"include cycle", "a.yaml -> ", "b.yaml -> ", "a.yaml"},
+		},
+		{
+			name: "missing file",
+			configs: map[string]string{
+				"app.yaml": "schemaVersion: '2.0.0'\ninclude: ['missing.yaml']\n",
+			},
+			expected: []string{"including missing.yaml from", "app.yaml"},
+		},
+		{
+			name: "invalid fragment",
+			configs: map[string]string{
+				"app.yaml":  "schemaVersion: '2.0.0'\ninclude: ['base.yaml']\n",
+				"base.yaml": "fileExistenceTest: []\n",
+			},
+			expected: []string{"including base.yaml from", "fileExistenceTest"},
+		},
+		{
+			name: "schema version mismatch",
+			configs: map[string]string{
+				"app.yaml":  "schemaVersion: '2.0.0'\ninclude: ['base.yaml']\n",
+				"base.yaml": "schemaVersion: '1.0.0'\n",
+			},
+			expected: []string{"schema version 1.0.0", "base.yaml"},
+		},
+	}
+	for _, table := range tables {
+		dir := writeConfigs(t, table.configs)
+		_, err := Parse(filepath.Join(dir, "app.yaml"), &drivers.DriverConfig{}, nil)
+		os.RemoveAll(dir)
+		if err == nil {
+			t.Errorf("%s: expected error", table.name)
+			continue
+		}
+		for _, s := range table.expected {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("%s: expected %q in error %q", table.name, s, err)
+			}
+		}
+	}
+}
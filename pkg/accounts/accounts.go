@@ -0,0 +1,152 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accounts parses the user and group databases of an image, so they
+// can be checked without running getent in the image.
+package accounts
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PasswdFile = "/etc/passwd"
+	GroupFile  = "/etc/group"
+	ShadowFile = "/etc/shadow"
+)
+
+type User struct {
+	Name     string
+	Password string // "x" if the hash is in the shadow file
+	Uid      int
+	Gid      int
+	Home     string
+	Shell    string
+}
+
+type Group struct {
+	Name    string
+	Gid     int
+	Members []string
+}
+
+type Shadow struct {
+	Name     string
+	Password string // empty if the account has no password
+}
+
+// entries splits a colon separated database into its fields, skipping blank
+// lines and comments. every entry must have at least n fields.
+func entries(contents []byte, n int) ([][]string, error) {
+	var res [][]string
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < n {
+			return nil, errors.Errorf("line %d: expected %d fields, got %d", i+1, n, len(fields))
+		}
+		res = append(res, fields)
+	}
+	return res, nil
+}
+
+func id(field string, line []string) (int, error) {
+	i, err := strconv.Atoi(field)
+	if err != nil {
+		return 0, errors.Errorf("invalid id %q for %s", field, line[0])
+	}
+	return i, nil
+}
+
+// ParsePasswd parses the contents of /etc/passwd.
+func ParsePasswd(contents []byte) ([]User, error) {
+	lines, err := entries(contents, 7)
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	for _, l := range lines {
+		uid, err := id(l[2], l)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := id(l[3], l)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, User{Name: l[0], Password: l[1], Uid: uid, Gid: gid, Home: l[5], Shell: l[6]})
+	}
+	return users, nil
+}
+
+// ParseGroup parses the contents of /etc/group.
+func ParseGroup(contents []byte) ([]Group, error) {
+	lines, err := entries(contents, 4)
+	if err != nil {
+		return nil, err
+	}
+	var groups []Group
+	for _, l := range lines {
+		gid, err := id(l[2], l)
+		if err != nil {
+			return nil, err
+		}
+		g := Group{Name: l[0], Gid: gid}
+		for _, m := range strings.Split(l[3], ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				g.Members = append(g.Members, m)
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// ParseShadow parses the contents of /etc/shadow.
+func ParseShadow(contents []byte) ([]Shadow, error) {
+	lines, err := entries(contents, 2)
+	if err != nil {
+		return nil, err
+	}
+	var shadows []Shadow
+	for _, l := range lines {
+		shadows = append(shadows, Shadow{Name: l[0], Password: l[1]})
+	}
+	return shadows, nil
+}
+
+// Groups returns the names of the groups a user belongs to, either as its
+// primary group or as a listed member.
+func Groups(user User, groups []Group) []string {
+	var names []string
+	for _, g := range groups {
+		if g.Gid == user.Gid {
+			names = append(names, g.Name)
+			continue
+		}
+		for _, m := range g.Members {
+			if m == user.Name {
+				names = append(names, g.Name)
+				break
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+const passwd = `root:x:0:0:root:/root:/bin/bash
+# comment
+nobody:x:65534:65534:nobody:/nonexistent:/usr/sbin/nologin
+nonroot:x:65532:65532:nonroot:/home/nonroot:/sbin/nologin
+`
+
+const group = `root:x:0:
+tty:x:5:nonroot
+nonroot:x:65532:
+audio:x:29:root, nonroot
+`
+
+func TestParsePasswd(t *testing.T) {
+	users, err := ParsePasswd([]byte(passwd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []User{
+		{Name: "root", Password: "x", Uid: 0, Gid: 0, Home: "/root", Shell: "/bin/bash"},
+		{Name: "nobody", Password: "x", Uid: 65534, Gid: 65534, Home: "/nonexistent", Shell: "/usr/sbin/nologin"},
+		{Name: "nonroot", Password: "x", Uid: 65532, Gid: 65532, Home: "/home/nonroot", Shell: "/sbin/nologin"},
+	}, users)
+
+	if _, err := ParsePasswd([]byte("root:x:0:0\n")); err == nil {
+		t.Errorf("expected error for truncated entry")
+	}
+	if _, err := ParsePasswd([]byte("root:x:zero:0:root:/root:/bin/sh\n")); err == nil {
+		t.Errorf("expected error for invalid uid")
+	}
+}
+
+func TestGroups(t *testing.T) {
+	groups, err := ParseGroup([]byte(group))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []string{"root", "nonroot"}, groups[3].Members)
+
+	users, _ := ParsePasswd([]byte(passwd))
+	testutil.CheckDeepEqual(t, []string{"tty", "nonroot", "audio"}, Groups(users[2], groups))
+	testutil.CheckDeepEqual(t, []string{"root", "audio"}, Groups(users[0], groups))
+	testutil.CheckDeepEqual(t, []string(nil), Groups(users[1], groups))
+}
+
+func TestParseShadow(t *testing.T) {
+	shadows, err := ParseShadow([]byte("root:*:18000:0:99999:7:::\nnonroot::18000::::::\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []Shadow{{Name: "root", Password: "*"}, {Name: "nonroot"}}, shadows)
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package binaries inspects ELF executables and resolves the shared libraries
+// they need, so images without file or ldd can still be checked.
+package binaries
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Static  = "static"
+	Dynamic = "dynamic"
+
+	RelroNone    = "none"
+	RelroPartial = "partial"
+	RelroFull    = "full"
+)
+
+var (
+	Linkings = []string{Static, Dynamic}
+	Relros   = []string{RelroNone, RelroPartial, RelroFull}
+)
+
+// values not defined by debug/elf in every go version
+const (
+	ptGnuStack elf.ProgType = 0x6474e551
+	ptGnuRelro elf.ProgType = 0x6474e552
+	emRISCV    elf.Machine  = 243
+	dtFlags1   elf.DynTag   = 0x6ffffffb
+	df1Now                  = 0x00000001
+	df1Pie                  = 0x08000000
+)
+
+// Info describes an ELF binary.
+type Info struct {
+	Arch        string   // GOARCH style name of the machine, e.g. amd64
+	Class       int      // 32 or 64 bit
+	Linking     string   // static or dynamic
+	Interpreter string   // dynamic loader, e.g. /lib64/ld-linux-x86-64.so.2
+	Stripped    bool     // whether the symbol table has been removed
+	PIE         bool     // position independent executable
+	Relro       string   // none, partial or full
+	NX          bool     // whether the stack is non executable
+	Needed      []string // DT_NEEDED libraries
+	RPath       []string
+	RunPath     []string
+}
+
+var arches = map[elf.Machine]string{
+	elf.EM_386:     "386",
+	elf.EM_X86_64:  "amd64",
+	elf.EM_ARM:     "arm",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_S390:    "s390x",
+	emRISCV:        "riscv64",
+}
+
+func arch(f *elf.File) string {
+	little := f.ByteOrder.String() == "LittleEndian"
+	switch f.Machine {
+	case elf.EM_PPC64:
+		if little {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_MIPS:
+		name := "mips"
+		if f.Class == elf.ELFCLASS64 {
+			name = "mips64"
+		}
+		if little {
+			name += "le"
+		}
+		return name
+	}
+	if a, ok := arches[f.Machine]; ok {
+		return a
+	}
+	return strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+}
+
+// Inspect parses the contents of an ELF binary.
+func Inspect(contents []byte) (*Info, error) {
+	f, err := elf.NewFile(bytes.NewReader(contents))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing ELF")
+	}
+	defer f.Close()
+
+	info := &Info{Arch: arch(f), Class: 32, Relro: RelroNone}
+	if f.Class == elf.ELFCLASS64 {
+		info.Class = 64
+	}
+	// NX stays false without a PT_GNU_STACK header, as the stack is then executable
+	hasRelro := false
+	for _, prog := range f.Progs {
+		switch prog.Type {
+		case elf.PT_INTERP:
+			interp, err := readInterpreter(prog)
+			if err != nil {
+				return nil, err
+			}
+			info.Interpreter = interp
+		case ptGnuStack:
+			info.NX = prog.Flags&elf.PF_X == 0
+		case ptGnuRelro:
+			hasRelro = true
+		}
+	}
+	info.Stripped = f.Section(".symtab") == nil
+
+	if info.Needed, err = f.ImportedLibraries(); err != nil {
+		return nil, errors.Wrap(err, "reading needed libraries")
+	}
+	if info.RPath, err = dynPaths(f, elf.DT_RPATH); err != nil {
+		return nil, err
+	}
+	if info.RunPath, err = dynPaths(f, elf.DT_RUNPATH); err != nil {
+		return nil, err
+	}
+	info.Linking = Dynamic
+	if info.Interpreter == "" && len(info.Needed) == 0 {
+		info.Linking = Static
+	}
+
+	dyn, err := dynValues(f)
+	if err != nil {
+		return nil, err
+	}
+	flags, flags1, bindNow := dyn[elf.DT_FLAGS], dyn[dtFlags1], dyn[elf.DT_BIND_NOW]
+	info.PIE = f.Type == elf.ET_DYN && (info.Interpreter != "" || anySet(flags1, df1Pie))
+	if hasRelro {
+		info.Relro = RelroPartial
+		if len(bindNow) > 0 || anySet(flags, uint64(elf.DF_BIND_NOW)) || anySet(flags1, df1Now) {
+			info.Relro = RelroFull
+		}
+	}
+	return info, nil
+}
+
+func readInterpreter(prog *elf.Prog) (string, error) {
+	b := make([]byte, prog.Filesz)
+	if _, err := prog.ReadAt(b, 0); err != nil {
+		return "", errors.Wrap(err, "reading interpreter")
+	}
+	return string(bytes.TrimRight(b, "\x00")), nil
+}
+
+func dynPaths(f *elf.File, tag elf.DynTag) ([]string, error) {
+	values, err := f.DynString(tag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", tag)
+	}
+	var paths []string
+	for _, v := range values {
+		paths = append(paths, strings.Split(v, ":")...)
+	}
+	return paths, nil
+}
+
+// dynValues returns the values of the entries in the dynamic section by tag.
+// File.DynValue does the same, but only in newer go versions.
+func dynValues(f *elf.File) (map[elf.DynTag][]uint64, error) {
+	values := map[elf.DynTag][]uint64{}
+	ds := f.SectionByType(elf.SHT_DYNAMIC)
+	if ds == nil {
+		return values, nil
+	}
+	d, err := ds.Data()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading dynamic section")
+	}
+	// entries are a tag followed by a value, each of the size of an address
+	size := 4
+	if f.Class == elf.ELFCLASS64 {
+		size = 8
+	}
+	for ; len(d) >= 2*size; d = d[2*size:] {
+		tag, value := dynWord(f.ByteOrder, d, size), dynWord(f.ByteOrder, d[size:], size)
+		if elf.DynTag(tag) == elf.DT_NULL {
+			break
+		}
+		values[elf.DynTag(tag)] = append(values[elf.DynTag(tag)], value)
+	}
+	return values, nil
+}
+
+func dynWord(order binary.ByteOrder, b []byte, size int) uint64 {
+	if size == 4 {
+		return uint64(order.Uint32(b))
+	}
+	return order.Uint64(b)
+}
+
+func anySet(values []uint64, flag uint64) bool {
+	for _, v := range values {
+		if v&flag != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package binaries
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/packages/packagestest"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestInspect(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test binaries are only ELF on linux")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Inspect(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, runtime.GOARCH, info.Arch)
+	testutil.CheckDeepEqual(t, info.Interpreter == "", info.Linking == Static)
+
+	if _, err := Inspect([]byte("#!/bin/sh\n")); err == nil {
+		t.Errorf("expected error inspecting a script")
+	}
+}
+
+func TestInspectHardening(t *testing.T) {
+	// built from an empty main with gcc -pie -Wl,-z,relro,-z,now and with
+	// gcc -no-pie -Wl,-z,relro,-z,lazy
+	tables := []struct {
+		file  string
+		pie   bool
+		relro string
+	}{
+		{file: "bindnow", pie: true, relro: RelroFull},
+		{file: "lazy", pie: false, relro: RelroPartial},
+	}
+	for _, table := range tables {
+		contents, err := ioutil.ReadFile(filepath.Join("testdata", table.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := Inspect(contents)
+		if err != nil {
+			t.Fatalf("%s: %s", table.file, err)
+		}
+		testutil.CheckDeepEqual(t, "amd64", info.Arch)
+		testutil.CheckDeepEqual(t, Dynamic, info.Linking)
+		testutil.CheckDeepEqual(t, table.pie, info.PIE)
+		testutil.CheckDeepEqual(t, table.relro, info.Relro)
+		testutil.CheckDeepEqual(t, true, info.NX)
+		testutil.CheckDeepEqual(t, true, info.Stripped)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	fs := packagestest.FS{
+		"/etc/ld.so.conf":                           "include /etc/ld.so.conf.d/*.conf\n",
+		"/etc/ld.so.conf.d/libc.conf":               "# libc default configuration\n/usr/local/lib\n",
+		"/etc/ld.so.conf.d/x86_64-linux-gnu.conf":   "/lib/x86_64-linux-gnu\n/usr/lib/x86_64-linux-gnu\n",
+		"/etc/ld.so.conf.d/README":                  "not included",
+		"/etc/ld-musl-x86_64.path":                  "/lib:/usr/lib\n/opt/lib\n",
+		"/usr/lib/x86_64-linux-gnu/libssl.so.1.1":   "",
+		"/opt/app/lib/libapp.so":                    "",
+		"/lib/x86_64-linux-gnu/libc.so.6":           "",
+		"/lib/x86_64-linux-gnu/libcrypto.so.1.1/.x": "",
+	}
+	glibc := &Info{Class: 64, Interpreter: "/lib64/ld-linux-x86-64.so.2", RPath: []string{"$ORIGIN/../lib"}}
+	testutil.CheckDeepEqual(t, []string{
+		"/opt/app/lib", "/env/lib",
+		"/usr/local/lib", "/lib/x86_64-linux-gnu", "/usr/lib/x86_64-linux-gnu",
+		"/lib64", "/usr/lib64", "/lib", "/usr/lib",
+	}, SearchPath(fs, glibc, "/opt/app/bin/app", "/env/lib"))
+
+	// RPATH is ignored when there's a RUNPATH, which is searched after LD_LIBRARY_PATH
+	glibc.RunPath = []string{"/run"}
+	testutil.CheckDeepEqual(t, []string{"/env/lib", "/run"}, SearchPath(fs, glibc, "/opt/app/bin/app", "/env/lib")[:2])
+
+	musl := &Info{Class: 64, Interpreter: "/lib/ld-musl-x86_64.so.1"}
+	testutil.CheckDeepEqual(t, []string{"/lib", "/usr/lib", "/opt/lib"}, SearchPath(fs, musl, "/bin/app", ""))
+
+	found, missing := Resolve(fs,
+		[]string{"libc.so.6", "libssl.so.1.1", "libcrypto.so.1.1", "libapp.so", "/opt/app/lib/libapp.so"},
+		SearchPath(fs, &Info{Class: 64, RPath: []string{"$ORIGIN/../lib"}}, "/opt/app/bin/app", ""))
+	testutil.CheckDeepEqual(t, map[string]string{
+		"libc.so.6":              "/lib/x86_64-linux-gnu/libc.so.6",
+		"libssl.so.1.1":          "/usr/lib/x86_64-linux-gnu/libssl.so.1.1",
+		"libapp.so":              "/opt/app/lib/libapp.so",
+		"/opt/app/lib/libapp.so": "/opt/app/lib/libapp.so",
+	}, found)
+	// directories don't satisfy a library
+	testutil.CheckDeepEqual(t, []string{"libcrypto.so.1.1"}, missing)
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package binaries
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/packages"
+)
+
+const ldSoConf = "/etc/ld.so.conf"
+
+// includes in ld.so.conf are only followed this deep, in case they form a loop
+const maxIncludeDepth = 8
+
+// SearchPath returns the directories the dynamic loader looks for the
+// libraries of a binary at binaryPath in, in order: its RPATH unless it has a
+// RUNPATH, LD_LIBRARY_PATH, its RUNPATH, the loader's configuration and the
+// default directories.
+func SearchPath(fs packages.FileReader, info *Info, binaryPath, ldLibraryPath string) []string {
+	origin := path.Dir(binaryPath)
+	expand := func(dirs []string) []string {
+		var res []string
+		for _, d := range dirs {
+			d = strings.Replace(d, "${ORIGIN}", origin, -1)
+			d = strings.Replace(d, "$ORIGIN", origin, -1)
+			if d != "" {
+				res = append(res, path.Clean(d))
+			}
+		}
+		return res
+	}
+	var dirs []string
+	if len(info.RunPath) == 0 {
+		dirs = append(dirs, expand(info.RPath)...)
+	}
+	dirs = append(dirs, expand(strings.Split(ldLibraryPath, ":"))...)
+	dirs = append(dirs, expand(info.RunPath)...)
+
+	if strings.Contains(path.Base(info.Interpreter), "ld-musl-") {
+		// musl reads /etc/ld-musl-<arch>.path instead of ld.so.conf
+		name := strings.TrimSuffix(path.Base(info.Interpreter), ".so.1")
+		if contents, err := fs.ReadFile("/etc/" + name + ".path"); err == nil {
+			return append(dirs, strings.FieldsFunc(string(contents), func(r rune) bool {
+				return r == ':' || r == '\n'
+			})...)
+		}
+		return append(dirs, "/lib", "/usr/local/lib", "/usr/lib")
+	}
+	dirs = append(dirs, ldConfig(fs, ldSoConf, 0)...)
+	if info.Class == 64 {
+		dirs = append(dirs, "/lib64", "/usr/lib64")
+	}
+	return append(dirs, "/lib", "/usr/lib")
+}
+
+// ldConfig returns the directories listed in an ld.so.conf file, following
+// include directives.
+func ldConfig(fs packages.FileReader, file string, depth int) []string {
+	if depth > maxIncludeDepth {
+		return nil
+	}
+	contents, err := fs.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, line := range strings.Split(string(contents), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != "include" {
+			dirs = append(dirs, fields...)
+			continue
+		}
+		for _, pattern := range fields[1:] {
+			if !path.IsAbs(pattern) {
+				pattern = path.Join(path.Dir(file), pattern)
+			}
+			for _, included := range glob(fs, pattern) {
+				dirs = append(dirs, ldConfig(fs, included, depth+1)...)
+			}
+		}
+	}
+	return dirs
+}
+
+// glob returns the files matching a pattern with wildcards in its last element.
+func glob(fs packages.FileReader, pattern string) []string {
+	dir := path.Dir(pattern)
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		logrus.Debugf("error listing %s: %s", dir, err)
+		return nil
+	}
+	var matches []string
+	for _, info := range infos {
+		if ok, _ := path.Match(path.Base(pattern), info.Name()); ok && !info.IsDir() {
+			matches = append(matches, path.Join(dir, info.Name()))
+		}
+	}
+	// glibc's ldconfig includes files in sorted order
+	sort.Strings(matches)
+	return matches
+}
+
+// Resolve returns the path each library needed by a binary is found at in
+// the search path, and the libraries that aren't found.
+func Resolve(fs packages.FileReader, needed, searchPath []string) (map[string]string, []string) {
+	found := map[string]string{}
+	var missing []string
+	for _, lib := range needed {
+		candidates := []string{lib}
+		if !strings.Contains(lib, "/") {
+			candidates = nil
+			for _, dir := range searchPath {
+				candidates = append(candidates, path.Join(dir, lib))
+			}
+		}
+		resolved := ""
+		for _, c := range candidates {
+			if info, err := fs.StatFile(c); err == nil && !info.IsDir() {
+				resolved = c
+				break
+			}
+		}
+		if resolved == "" {
+			missing = append(missing, lib)
+			continue
+		}
+		found[lib] = resolved
+	}
+	return found, missing
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capabilities decodes the file capabilities stored in the
+// security.capability extended attribute, as set by setcap.
+package capabilities
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Xattr is the extended attribute holding a file's capabilities.
+const Xattr = "security.capability"
+
+const (
+	revisionMask   = 0xff000000
+	revision1      = 0x01000000
+	revision2      = 0x02000000
+	revision3      = 0x03000000
+	flagsEffective = 0x000001
+)
+
+// names of the capabilities by bit number, as used by setcap and getcap
+var names = []string{
+	"cap_chown", "cap_dac_override", "cap_dac_read_search", "cap_fowner",
+	"cap_fsetid", "cap_kill", "cap_setgid", "cap_setuid",
+	"cap_setpcap", "cap_linux_immutable", "cap_net_bind_service", "cap_net_broadcast",
+	"cap_net_admin", "cap_net_raw", "cap_ipc_lock", "cap_ipc_owner",
+	"cap_sys_module", "cap_sys_rawio", "cap_sys_chroot", "cap_sys_ptrace",
+	"cap_sys_pacct", "cap_sys_admin", "cap_sys_boot", "cap_sys_nice",
+	"cap_sys_resource", "cap_sys_time", "cap_sys_tty_config", "cap_mknod",
+	"cap_lease", "cap_audit_write", "cap_audit_control", "cap_setfcap",
+	"cap_mac_override", "cap_mac_admin", "cap_syslog", "cap_wake_alarm",
+	"cap_block_suspend", "cap_audit_read", "cap_perfmon", "cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+func name(bit int) string {
+	if bit < len(names) {
+		return names[bit]
+	}
+	return fmt.Sprintf("cap_%d", bit)
+}
+
+// Decode returns the capabilities in the value of the security.capability
+// attribute, one per capability with its flags, e.g. cap_net_bind_service+ep,
+// sorted by name.
+func Decode(value []byte) ([]string, error) {
+	if len(value) < 4 {
+		return nil, fmt.Errorf("capability data too short: %d bytes", len(value))
+	}
+	magic := binary.LittleEndian.Uint32(value)
+	words := 0
+	switch magic & revisionMask {
+	case revision1:
+		words = 1
+	case revision2, revision3:
+		// revision 3 adds the root uid of the namespace the capabilities apply in
+		words = 2
+	default:
+		return nil, fmt.Errorf("unsupported capability revision %#x", magic&revisionMask)
+	}
+	if len(value) < 4+8*words {
+		return nil, fmt.Errorf("capability data too short: %d bytes", len(value))
+	}
+	effective := magic&flagsEffective != 0
+	var caps []string
+	for w := 0; w < words; w++ {
+		permitted := binary.LittleEndian.Uint32(value[4+8*w:])
+		inheritable := binary.LittleEndian.Uint32(value[8+8*w:])
+		for b := uint(0); b < 32; b++ {
+			p, i := permitted&(1<<b) != 0, inheritable&(1<<b) != 0
+			if !p && !i {
+				continue
+			}
+			flags := ""
+			// the effective flag applies to every permitted or inheritable capability
+			if effective {
+				flags += "e"
+			}
+			if i {
+				flags += "i"
+			}
+			if p {
+				flags += "p"
+			}
+			caps = append(caps, name(w*32+int(b))+"+"+flags)
+		}
+	}
+	sort.Strings(caps)
+	return caps, nil
+}
+
+// Normalize converts capabilities in the text form accepted by setcap, such as
+// "cap_net_raw,cap_net_bind_service=pe", into the one per capability form
+// returned by Decode, sorted by name.
+func Normalize(text []string) ([]string, error) {
+	var caps []string
+	for _, t := range text {
+		t = strings.ToLower(strings.TrimSpace(t))
+		i := strings.IndexAny(t, "+=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid capability %s: expected flags, e.g. cap_net_raw+ep", t)
+		}
+		flags := ""
+		for _, f := range "eip" {
+			if strings.ContainsRune(t[i+1:], f) {
+				flags += string(f)
+			}
+		}
+		if flags == "" || len(strings.Trim(t[i+1:], "eip")) > 0 {
+			return nil, fmt.Errorf("invalid flags in capability %s", t)
+		}
+		for _, n := range strings.Split(t[:i], ",") {
+			caps = append(caps, strings.TrimSpace(n)+"+"+flags)
+		}
+	}
+	sort.Strings(caps)
+	return caps, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capabilities
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func capData(magic uint32, words ...uint32) []byte {
+	b := make([]byte, 4+4*len(words))
+	binary.LittleEndian.PutUint32(b, magic)
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(b[4+4*i:], w)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	tables := []struct {
+		name     string
+		value    []byte
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "setcap cap_net_bind_service+ep",
+			value:    capData(revision2|flagsEffective, 1<<10, 0, 0, 0),
+			expected: []string{"cap_net_bind_service+ep"},
+		},
+		{
+			name:     "permitted and inheritable without effective",
+			value:    capData(revision2, 1<<13, 1<<12, 0, 0),
+			expected: []string{"cap_net_admin+i", "cap_net_raw+p"},
+		},
+		{
+			name:     "high capabilities",
+			value:    capData(revision3|flagsEffective, 0, 0, 1<<7, 0, 0),
+			expected: []string{"cap_bpf+ep"},
+		},
+		{
+			name:     "revision 1",
+			value:    capData(revision1, 1<<0|1<<7, 0),
+			expected: []string{"cap_chown+p", "cap_setuid+p"},
+		},
+		{name: "truncated", value: capData(revision2, 0), err: true},
+		{name: "unknown revision", value: capData(0x09000000, 0, 0, 0, 0), err: true},
+	}
+	for _, table := range tables {
+		caps, err := Decode(table.value)
+		if table.err {
+			if err == nil {
+				t.Errorf("%s: expected error", table.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", table.name, err)
+			continue
+		}
+		testutil.CheckDeepEqual(t, table.expected, caps)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	caps, err := Normalize([]string{"CAP_NET_RAW,cap_net_bind_service=pe", "cap_chown+ie"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []string{"cap_chown+ei", "cap_net_bind_service+ep", "cap_net_raw+ep"}, caps)
+
+	for _, invalid := range []string{"cap_net_raw", "cap_net_raw+", "cap_net_raw+ex"} {
+		if _, err := Normalize([]string{invalid}); err == nil {
+			t.Errorf("expected error for %s", invalid)
+		}
+	}
+}
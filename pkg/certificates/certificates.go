@@ -0,0 +1,123 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package certificates parses certificate files and bundles in PEM or DER
+// form, so trust stores and service certificates can be checked without
+// running openssl in the image.
+package certificates
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RSA     = "rsa"
+	ECDSA   = "ecdsa"
+	Ed25519 = "ed25519" // only parsed by crypto/x509 since go 1.13
+	DSA     = "dsa"
+)
+
+var KeyTypes = []string{RSA, ECDSA, Ed25519, DSA}
+
+// Bundle is the contents of a certificate file.
+type Bundle struct {
+	Certificates []*x509.Certificate
+	PrivateKeys  []string // types of the PEM blocks holding private keys
+}
+
+// IsPEM returns whether data holds PEM blocks rather than DER.
+func IsPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+// Parse parses every certificate in a PEM file, skipping blocks other than
+// certificates but recording private keys, or the certificates in a DER file.
+func Parse(data []byte) (*Bundle, error) {
+	b := &Bundle{}
+	if !IsPEM(data) {
+		certs, err := x509.ParseCertificates(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing DER certificates")
+		}
+		b.Certificates = certs
+		return b, nil
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return b, nil
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing certificate %d", len(b.Certificates)+1)
+			}
+			b.Certificates = append(b.Certificates, cert)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			b.PrivateKeys = append(b.PrivateKeys, block.Type)
+		}
+	}
+}
+
+// PrivateKeys returns the types of the PEM private key blocks in data, such
+// as RSA PRIVATE KEY, without parsing anything else.
+func PrivateKeys(data []byte) []string {
+	var keys []string
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return keys
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			keys = append(keys, block.Type)
+		}
+	}
+}
+
+// Key returns the type and size in bits of a certificate's public key.
+func Key(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return RSA, key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return ECDSA, key.Curve.Params().BitSize
+	case *dsa.PublicKey:
+		return DSA, key.P.BitLen()
+	}
+	return strings.ToLower(cert.PublicKeyAlgorithm.String()), 0
+}
+
+// Fingerprint returns the hex encoded SHA-256 digest of a certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint converts a fingerprint as printed by openssl, such as
+// AB:CD:..., into the form returned by Fingerprint.
+func NormalizeFingerprint(f string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(f), ":", "", -1))
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func testCertificate(t *testing.T, cn string, pub crypto.PublicKey, priv crypto.Signer) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParse(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecCert := testCertificate(t, "ec", ecKey.Public(), ecKey)
+	rsaCert := testCertificate(t, "rsa", rsaKey.Public(), rsaKey)
+
+	var bundle bytes.Buffer
+	pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: ecCert})
+	bundle.WriteString("# comments between certificates are ignored\n")
+	pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: rsaCert})
+	pem.Encode(&bundle, &pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")})
+
+	b, err := Parse(bundle.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, 2, len(b.Certificates))
+	testutil.CheckDeepEqual(t, []string{"EC PRIVATE KEY"}, b.PrivateKeys)
+	testutil.CheckDeepEqual(t, []string{"EC PRIVATE KEY"}, PrivateKeys(bundle.Bytes()))
+	testutil.CheckDeepEqual(t, "CN=ec,O=Example", b.Certificates[0].Subject.String())
+
+	keyType, size := Key(b.Certificates[0])
+	testutil.CheckDeepEqual(t, ECDSA, keyType)
+	testutil.CheckDeepEqual(t, 256, size)
+	keyType, size = Key(b.Certificates[1])
+	testutil.CheckDeepEqual(t, RSA, keyType)
+	testutil.CheckDeepEqual(t, 1024, size)
+
+	der, err := Parse(ecCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, 1, len(der.Certificates))
+	testutil.CheckDeepEqual(t, Fingerprint(b.Certificates[0]), Fingerprint(der.Certificates[0]))
+
+	if _, err := Parse([]byte("not a certificate")); err == nil {
+		t.Errorf("expected error parsing invalid DER")
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	f := NormalizeFingerprint(" AB:cd:" + strings.Repeat("00:", 29) + "EF ")
+	testutil.CheckDeepEqual(t, "abcd"+strings.Repeat("00", 29)+"ef", f)
+}
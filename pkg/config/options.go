@@ -14,13 +14,22 @@
 
 package config
 
+import "time"
+
 type StructureTestOptions struct {
 	ImagePath   string
 	Driver      string
 	Runtime     string
 	Metadata    string
+	Platform    string
 	TestReport  string
+	Output      string
 	ConfigFiles []string
+	Parallel    int
+	Timeout     time.Duration
+	IncludeTags []string
+	ExcludeTags []string
+	Run         string
 
 	JSON    bool
 	Pull    bool
@@ -29,3 +38,12 @@ type StructureTestOptions struct {
 	Force   bool
 	NoColor bool
 }
+
+type LicenseInventoryOptions struct {
+	ImagePath  string
+	Driver     string
+	Metadata   string
+	Platform   string
+	Format     string
+	OutputFile string
+}
@@ -23,7 +23,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -32,6 +33,9 @@ import (
 	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
 
 	docker "github.com/fsouza/go-dockerclient"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
 )
 
 type DockerDriver struct {
@@ -41,8 +45,16 @@ type DockerDriver struct {
 	env           map[string]string
 	save          bool
 	runtime       string
+	timeout       time.Duration
 }
 
+// imageVariants caches the platform variant of each image, as the docker client
+// doesn't expose it and reading it means loading the image from the daemon.
+var imageVariants = struct {
+	sync.Mutex
+	variants map[string]string
+}{variants: map[string]string{}}
+
 func NewDockerDriver(args DriverConfig) (Driver, error) {
 	newCli, err := docker.NewClientFromEnv()
 	if err != nil {
@@ -55,6 +67,7 @@ func NewDockerDriver(args DriverConfig) (Driver, error) {
 		env:           nil,
 		save:          args.Save,
 		runtime:       args.Runtime,
+		timeout:       args.Timeout,
 	}, nil
 }
 
@@ -123,12 +136,15 @@ func (d *DockerDriver) Teardown(_ [][]string) error {
 	return nil
 }
 
-func (d *DockerDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string) (string, string, int, error) {
+func (d *DockerDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string, stdin io.Reader) (string, string, int, error) {
 	var env []string
 	for _, envVar := range envVars {
 		env = append(env, fmt.Sprintf("%s=%s", envVar.Key, envVar.Value))
 	}
-	stdout, stderr, exitCode, err := d.exec(env, fullCommand)
+	stdout, stderr, exitCode, err := d.exec(env, fullCommand, stdin)
+	if IsTimeout(err) {
+		return stdout, stderr, -1, err
+	}
 	if err != nil {
 		return "", "", -1, err
 	}
@@ -181,9 +197,8 @@ func (d *DockerDriver) processEnvVars(vars []unversioned.EnvVar) []string {
 	return env
 }
 
-// copies a tar archive starting at the specified path from the image, and returns
-// a tar reader which can be used to iterate through its contents and retrieve metadata
-func (d *DockerDriver) retrieveTar(path string) (*tar.Reader, error) {
+// creates a container from the current image to copy files out of
+func (d *DockerDriver) createPlaceholderContainer() (*docker.Container, error) {
 	// this contains a placeholder command which does not get run, since
 	// the client doesn't allow creating a container without a command.
 	container, err := d.cli.CreateContainer(docker.CreateContainerOptions{
@@ -197,6 +212,50 @@ func (d *DockerDriver) retrieveTar(path string) (*tar.Reader, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Error creating container")
 	}
+	return container, nil
+}
+
+// streamTar is like retrieveTar, but streams the archive from the daemon rather
+// than buffering all of it. the returned function must be called once done with
+// the reader, to stop the download and remove the container.
+func (d *DockerDriver) streamTar(path string) (*tar.Reader, func(), error) {
+	container, err := d.createPlaceholderContainer()
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, pw := io.Pipe()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		err := d.cli.DownloadFromContainer(container.ID, docker.DownloadFromContainerOptions{
+			OutputStream: pw,
+			Path:         path,
+		})
+		pw.CloseWithError(errors.Wrap(err, "Error retrieving file from container"))
+	}()
+	done := func() {
+		// closing the reader makes the download fail if it hasn't finished yet
+		pr.Close()
+		<-finished
+		d.removeContainer(container.ID)
+	}
+	return tar.NewReader(pr), done, nil
+}
+
+type closeFunc func()
+
+func (f closeFunc) Close() error {
+	f()
+	return nil
+}
+
+// copies a tar archive starting at the specified path from the image, and returns
+// a tar reader which can be used to iterate through its contents and retrieve metadata
+func (d *DockerDriver) retrieveTar(path string) (*tar.Reader, error) {
+	container, err := d.createPlaceholderContainer()
+	if err != nil {
+		return nil, err
+	}
 	defer d.removeContainer(container.ID)
 
 	var b bytes.Buffer
@@ -215,80 +274,97 @@ func (d *DockerDriver) retrieveTar(path string) (*tar.Reader, error) {
 	return tar.NewReader(bytes.NewReader(b.Bytes())), nil
 }
 
-func (d *DockerDriver) StatFile(target string) (os.FileInfo, error) {
+// Lstat describes a path without following a symlink in its last element.
+// the daemon resolves any symlinks in the parent directories within the container.
+func (d *DockerDriver) Lstat(target string) (os.FileInfo, error) {
 	reader, err := d.retrieveTar(target)
 	if err != nil {
 		return nil, err
 	}
-	for {
-		header, err := reader.Next()
-		if err == io.EOF {
-			break
-		}
-		switch header.Typeflag {
-		case tar.TypeDir, tar.TypeReg, tar.TypeLink, tar.TypeSymlink:
-			if filepath.Clean(header.Name) == path.Base(target) {
-				return header.FileInfo(), nil
-			}
-		default:
-			continue
-		}
+	header, err := findEntry(reader, target)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("File %s not found in image", target)
+	return header.FileInfo(), nil
+}
+
+func (d *DockerDriver) StatFile(target string) (os.FileInfo, error) {
+	return statFollowingLinks(d.Lstat, target)
 }
 
 func (d *DockerDriver) ReadFile(target string) ([]byte, error) {
-	reader, err := d.retrieveTar(target)
+	rc, err := d.OpenFile(target)
 	if err != nil {
 		return nil, err
 	}
-	for {
-		header, err := reader.Next()
-		if err == io.EOF {
-			break
+	defer rc.Close()
+	var b bytes.Buffer
+	if _, err := b.ReadFrom(rc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (d *DockerDriver) OpenFile(target string) (io.ReadCloser, error) {
+	current := target
+	for links := 0; links <= maxSymlinks; links++ {
+		reader, done, err := d.streamTar(current)
+		if err != nil {
+			return nil, err
+		}
+		header, err := findEntry(reader, current)
+		if err != nil {
+			done()
+			return nil, err
 		}
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if filepath.Clean(header.Name) == path.Base(target) {
-				return nil, fmt.Errorf("Cannot read specified path: %s is a directory, not a file", target)
-			}
+			done()
+			return nil, fmt.Errorf("Cannot read specified path: %s is a directory, not a file", target)
 		case tar.TypeSymlink:
-			return d.ReadFile(header.Linkname)
+			done()
+			current = linkDestination(current, header.Linkname)
 		case tar.TypeReg, tar.TypeLink:
-			if filepath.Clean(header.Name) == path.Base(target) {
-				var b bytes.Buffer
-				stream := bufio.NewWriter(&b)
-				io.Copy(stream, reader)
-				return b.Bytes(), nil
-			}
+			return readCloser{reader, closeFunc(done)}, nil
 		default:
-			continue
+			done()
+			return nil, fmt.Errorf("Cannot read specified path: %s is not a regular file", target)
 		}
 	}
-	return nil, fmt.Errorf("File %s not found in image", target)
+	return nil, tooManyLinks(target)
 }
 
-func (d *DockerDriver) ReadDir(target string) ([]os.FileInfo, error) {
-	reader, err := d.retrieveTar(target)
-	if err != nil {
-		return nil, err
-	}
-	var infos []os.FileInfo
+// findEntry advances an archive of target to the entry for target itself.
+func findEntry(reader *tar.Reader, target string) (*tar.Header, error) {
 	for {
 		header, err := reader.Next()
 		if err == io.EOF {
-			break
+			return nil, fmt.Errorf("File %s not found in image", target)
 		}
-		if header.Typeflag == tar.TypeDir {
-			// we only want top level dirs here, no recursion. to get these, remove
-			// trailing separator and split on separator. there should only be two parts.
-			parts := strings.Split(strings.TrimSuffix(header.Name, string(os.PathSeparator)), string(os.PathSeparator))
-			if len(parts) == 2 {
-				infos = append(infos, header.FileInfo())
-			}
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Clean(header.Name) == path.Base(target) {
+			return header, nil
 		}
 	}
-	return infos, nil
+}
+
+func (d *DockerDriver) ReadDir(target string) ([]os.FileInfo, error) {
+	reader, err := d.retrieveTar(target)
+	if err != nil {
+		return nil, err
+	}
+	// entry names start with the directory itself
+	return readTarDir(reader, path.Dir(path.Clean("/"+target)), target)
+}
+
+func (d *DockerDriver) Walk(root string, fn filepath.WalkFunc) error {
+	reader, err := d.retrieveTar(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return walkTar(reader, path.Dir(path.Clean("/"+root)), root, fn)
 }
 
 // This method takes a command (in the form of a list of args), and does the following:
@@ -318,7 +394,15 @@ func (d *DockerDriver) runAndCommit(env []string, command []string) (string, err
 		return "", errors.Wrap(err, "Error creating container")
 	}
 
-	if _, err = d.cli.WaitContainer(container.ID); err != nil {
+	stop := afterTimeout(d.timeout, func() {
+		d.killContainer(container.ID)
+	})
+	_, err = d.cli.WaitContainer(container.ID)
+	if stop() {
+		d.removeContainer(container.ID)
+		return "", &TimeoutError{Command: command, Timeout: d.timeout}
+	}
+	if err != nil {
 		return "", errors.Wrap(err, "Error when waiting for container")
 	}
 
@@ -342,7 +426,7 @@ func (d *DockerDriver) runAndCommit(env []string, command []string) (string, err
 	return image.ID, nil
 }
 
-func (d *DockerDriver) exec(env []string, command []string) (string, string, int, error) {
+func (d *DockerDriver) exec(env []string, command []string, stdin io.Reader) (string, string, int, error) {
 	// first, start container from the current image
 	container, err := d.cli.CreateContainer(docker.CreateContainerOptions{
 		Config: &docker.Config{
@@ -352,6 +436,9 @@ func (d *DockerDriver) exec(env []string, command []string) (string, string, int
 			Entrypoint:   []string{},
 			AttachStdout: true,
 			AttachStderr: true,
+			AttachStdin:  stdin != nil,
+			OpenStdin:    stdin != nil,
+			StdinOnce:    stdin != nil,
 		},
 		HostConfig:       d.hostConfig(),
 		NetworkingConfig: nil,
@@ -364,13 +451,35 @@ func (d *DockerDriver) exec(env []string, command []string) (string, string, int
 	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
 
+	if stdin != nil {
+		// attach before starting the container, so that no input is lost. since the
+		// container only takes stdin once, it is closed when the input runs out.
+		success := make(chan struct{})
+		attached, err := d.cli.AttachToContainerNonBlocking(docker.AttachToContainerOptions{
+			Container:   container.ID,
+			InputStream: stdin,
+			Stdin:       true,
+			Stream:      true,
+			Success:     success,
+		})
+		if err != nil {
+			return "", "", -1, errors.Wrap(err, "Error attaching to container")
+		}
+		defer attached.Close()
+		<-success
+		success <- struct{}{}
+	}
+
 	if err = d.cli.StartContainer(container.ID, nil); err != nil {
 		return "", "", -1, errors.Wrap(err, "Error creating container")
 	}
 
-	//TODO(nkubala): look into adding timeout
+	stop := afterTimeout(d.timeout, func() {
+		d.killContainer(container.ID)
+	})
 	exitCode, err := d.cli.WaitContainer(container.ID)
-	if err != nil {
+	timedOut := stop()
+	if err != nil && !timedOut {
 		return "", "", -1, errors.Wrap(err, "Error when waiting for container")
 	}
 
@@ -384,6 +493,9 @@ func (d *DockerDriver) exec(env []string, command []string) (string, string, int
 		return "", "", -1, errors.Wrap(err, "Error retrieving container logs")
 	}
 
+	if timedOut {
+		return stdout.String(), stderr.String(), -1, &TimeoutError{Command: command, Timeout: d.timeout}
+	}
 	return stdout.String(), stderr.String(), exitCode, nil
 }
 
@@ -405,6 +517,22 @@ func (d *DockerDriver) GetConfig() (unversioned.Config, error) {
 		ports = append(ports, p.Port())
 	}
 
+	var healthcheck *unversioned.Healthcheck
+	if h := img.Config.Healthcheck; h != nil {
+		healthcheck = &unversioned.Healthcheck{
+			Test:        h.Test,
+			Interval:    h.Interval,
+			Timeout:     h.Timeout,
+			StartPeriod: h.StartPeriod,
+			Retries:     h.Retries,
+		}
+	}
+
+	variant, err := d.variant()
+	if err != nil {
+		return unversioned.Config{}, err
+	}
+
 	return unversioned.Config{
 		Env:          convertSliceToMap(img.Config.Env),
 		Entrypoint:   img.Config.Entrypoint,
@@ -413,9 +541,27 @@ func (d *DockerDriver) GetConfig() (unversioned.Config, error) {
 		Workdir:      img.Config.WorkingDir,
 		ExposedPorts: ports,
 		Labels:       img.Config.Labels,
+		User:         img.Config.User,
+		Healthcheck:  healthcheck,
+		StopSignal:   img.Config.StopSignal,
+		Shell:        img.Config.Shell,
+		OnBuild:      img.Config.OnBuild,
+		OS:           img.OS,
+		Architecture: img.Architecture,
+		Variant:      variant,
+		Author:       img.Author,
+		Created:      img.Created,
 	}, nil
 }
 
+func (d *DockerDriver) killContainer(containerID string) {
+	if err := d.cli.KillContainer(docker.KillContainerOptions{
+		ID: containerID,
+	}); err != nil {
+		logrus.Warnf("Error when killing container %s: %s", containerID, err.Error())
+	}
+}
+
 func (d *DockerDriver) removeContainer(containerID string) {
 	if d.save {
 		return
@@ -426,3 +572,48 @@ func (d *DockerDriver) removeContainer(containerID string) {
 		logrus.Warnf("Error when removing container %s: %s", containerID, err.Error())
 	}
 }
+
+// variant returns the platform variant of the image from its config file,
+// loading the image from the daemon the first time.
+func (d *DockerDriver) variant() (string, error) {
+	imageVariants.Lock()
+	defer imageVariants.Unlock()
+	if variant, ok := imageVariants.variants[d.originalImage]; ok {
+		return variant, nil
+	}
+	img, err := d.image()
+	if err != nil {
+		return "", err
+	}
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		return "", errors.Wrap(err, "retrieving image config file")
+	}
+	variant, err := configVariant(rawConfig)
+	if err != nil {
+		return "", err
+	}
+	imageVariants.variants[d.originalImage] = variant
+	return variant, nil
+}
+
+// image returns the image being tested as stored in the docker daemon.
+func (d *DockerDriver) image() (v1.Image, error) {
+	ref, err := name.ParseReference(d.originalImage, name.WeakValidation)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing image reference")
+	}
+	img, err := daemon.Image(ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieving image from docker daemon")
+	}
+	return img, nil
+}
+
+func (d *DockerDriver) GetLayers() ([]unversioned.Layer, error) {
+	img, err := d.image()
+	if err != nil {
+		return nil, err
+	}
+	return imageLayers(img)
+}
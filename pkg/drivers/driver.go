@@ -15,26 +15,36 @@
 package drivers
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 )
 
 // TODO: add singularity driver here
 const (
-	Docker = "docker"
-	Tar    = "tar"
-	Host   = "host"
+	Docker      = "docker"
+	Tar         = "tar"
+	Host        = "host"
 	Singularity = "singularity"
+	SIF         = "sif"
 )
 
 type DriverConfig struct {
-	Image    string // used by Docker/Tar drivers
-	Save     bool   // used by Docker/Tar drivers
-	Metadata string // used by Host driver
-	Runtime  string // used by Docker driver
+	Image    string        // used by Docker/Tar/Singularity/SIF drivers
+	Save     bool          // used by Docker/Tar drivers
+	Metadata string        // used by Host driver
+	Runtime  string        // used by Docker driver
+	Platform string        // used by Tar driver to select an image from an OCI layout
+	Timeout  time.Duration // used by Docker/Host/Singularity drivers to kill commands that run too long
 }
 
 type Driver interface {
@@ -47,18 +57,37 @@ type Driver interface {
 
 	// given an array of command parts, construct a full command and execute it against the
 	// current environment. a list of environment variables can be passed to be set in the
-	// environment before the command is executed. additionally, a boolean flag is passed
-	// to specify whether or not we care about the output of the command.
-	ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string) (string, string, int, error)
+	// environment before the command is executed. if stdin is not nil, it is passed to
+	// the command as its standard input.
+	ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string, stdin io.Reader) (string, string, int, error)
 
+	// StatFile describes a path, following symlinks within the image.
 	StatFile(path string) (os.FileInfo, error)
 
+	// Lstat describes a path without following a symlink in its last element. the
+	// file info is backed by a *tar.Header, which holds the target of a symlink.
+	Lstat(path string) (os.FileInfo, error)
+
 	ReadFile(path string) ([]byte, error)
 
+	// OpenFile returns a reader for the contents of a file, for files too large
+	// to read into memory at once. the reader must be closed once done with.
+	OpenFile(path string) (io.ReadCloser, error)
+
 	ReadDir(path string) ([]os.FileInfo, error)
 
+	// Walk calls fn for root and every path below it, in the same order and with the
+	// same handling of filepath.SkipDir as filepath.Walk. symlinks aren't followed.
+	// file infos are backed by a *tar.Header, which holds the ownership, link
+	// target and extended attributes of each path.
+	Walk(root string, fn filepath.WalkFunc) error
+
 	GetConfig() (unversioned.Config, error)
 
+	// GetLayers returns the layers of the image from the bottom up, along with the
+	// paths each one changes. only drivers with access to the image layers support it.
+	GetLayers() ([]unversioned.Layer, error)
+
 	Destroy()
 }
 
@@ -73,11 +102,80 @@ func InitDriverImpl(driver string) func(DriverConfig) (Driver, error) {
 		return NewHostDriver
 	case Singularity:
 		return NewSingularityDriver
+	case SIF:
+		return NewSIFDriver
 	default:
 		return nil
 	}
 }
 
+// convertConfigFile converts an image config file to the config used by tests.
+// the raw config is needed for fields go-containerregistry doesn't parse yet.
+func convertConfigFile(configFile *v1.ConfigFile, rawConfig []byte) (unversioned.Config, error) {
+	config := configFile.Config
+
+	// docker provides these as maps (since they can be mapped in docker run commands)
+	// since this will never be the case when built through a dockerfile, we convert to list of strings
+	volumes := []string{}
+	for v := range config.Volumes {
+		volumes = append(volumes, v)
+	}
+
+	ports := []string{}
+	for p := range config.ExposedPorts {
+		// docker always appends the protocol to the port, so this is safe
+		ports = append(ports, strings.Split(p, "/")[0])
+	}
+
+	var healthcheck *unversioned.Healthcheck
+	if h := config.Healthcheck; h != nil {
+		healthcheck = &unversioned.Healthcheck{
+			Test:        h.Test,
+			Interval:    h.Interval,
+			Timeout:     h.Timeout,
+			StartPeriod: h.StartPeriod,
+			Retries:     h.Retries,
+		}
+	}
+
+	variant, err := configVariant(rawConfig)
+	if err != nil {
+		return unversioned.Config{}, err
+	}
+
+	return unversioned.Config{
+		Env:          convertSliceToMap(config.Env),
+		Entrypoint:   config.Entrypoint,
+		Cmd:          config.Cmd,
+		Volumes:      volumes,
+		Workdir:      config.WorkingDir,
+		ExposedPorts: ports,
+		Labels:       config.Labels,
+		User:         config.User,
+		Healthcheck:  healthcheck,
+		StopSignal:   config.StopSignal,
+		Shell:        config.Shell,
+		OnBuild:      config.OnBuild,
+		OS:           configFile.OS,
+		Architecture: configFile.Architecture,
+		Variant:      variant,
+		Author:       configFile.Author,
+		Created:      configFile.Created.Time,
+	}, nil
+}
+
+// configVariant reads the platform variant from a raw image config file, as
+// v1.ConfigFile doesn't have it.
+func configVariant(rawConfig []byte) (string, error) {
+	var platform struct {
+		Variant string `json:"variant"`
+	}
+	if err := json.Unmarshal(rawConfig, &platform); err != nil {
+		return "", errors.Wrap(err, "parsing config file")
+	}
+	return platform.Variant, nil
+}
+
 func convertSliceToMap(slice []string) map[string]string {
 	// convert slice to map for processing
 	res := make(map[string]string)
@@ -0,0 +1,73 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestConvertConfigFile(t *testing.T) {
+	raw := []byte(`{
+		"architecture": "arm",
+		"variant": "v7",
+		"os": "linux",
+		"author": "someone",
+		"created": "2019-01-01T00:00:00Z",
+		"config": {
+			"User": "nobody",
+			"Env": ["PATH=/usr/bin"],
+			"Healthcheck": {"Test": ["CMD", "true"], "Interval": 30000000000, "Retries": 3},
+			"StopSignal": "SIGTERM",
+			"Shell": ["/bin/sh", "-c"],
+			"OnBuild": ["RUN make"]
+		}
+	}`)
+	configFile, err := v1.ParseConfigFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := convertConfigFile(configFile, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.CheckDeepEqual(t, "nobody", config.User)
+	testutil.CheckDeepEqual(t, &unversioned.Healthcheck{
+		Test:     []string{"CMD", "true"},
+		Interval: 30 * time.Second,
+		Retries:  3,
+	}, config.Healthcheck)
+	testutil.CheckDeepEqual(t, "SIGTERM", config.StopSignal)
+	testutil.CheckDeepEqual(t, []string{"/bin/sh", "-c"}, config.Shell)
+	testutil.CheckDeepEqual(t, []string{"RUN make"}, config.OnBuild)
+	testutil.CheckDeepEqual(t, "linux", config.OS)
+	testutil.CheckDeepEqual(t, "arm", config.Architecture)
+	testutil.CheckDeepEqual(t, "v7", config.Variant)
+	testutil.CheckDeepEqual(t, "someone", config.Author)
+	testutil.CheckDeepEqual(t, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), config.Created.UTC())
+}
+
+func TestConvertConfigFileCorrupt(t *testing.T) {
+	if _, err := convertConfigFile(&v1.ConfigFile{}, []byte(`{"variant": 7}`)); err == nil {
+		t.Errorf("expected error converting a corrupt config file")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// cleanLayerPath normalizes a path from a layer tarball, e.g. ./etc/passwd, to etc/passwd.
+func cleanLayerPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// layerChanges records the whiteouts found in a single layer.
+type layerChanges struct {
+	whiteouts map[string]bool // paths removed from lower layers
+	opaque    map[string]bool // directories whose lower contents are hidden
+}
+
+// hidden returns whether an entry at the given path in a lower layer is hidden
+// by the whiteouts of the layers above it.
+func hidden(name string, upper []layerChanges) bool {
+	for _, changes := range upper {
+		if changes.whiteouts[name] {
+			return true
+		}
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			if changes.whiteouts[dir] || changes.opaque[dir] {
+				return true
+			}
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+	return false
+}
+
+func forEachEntry(layer v1.Layer, fn func(*tar.Header, io.Reader) error) error {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return errors.Wrap(err, "reading layer contents")
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading tar")
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// flatten returns a tar stream of the image's final filesystem. Layers are
+// scanned from the top down to work out which entry wins for every path, taking
+// both regular and opaque whiteouts into account; the winning entries are then
+// written from the bottom layer up, so directories precede their contents.
+func flatten(img v1.Image) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeFlattened(img, pw))
+	}()
+	return pr
+}
+
+func writeFlattened(img v1.Image, w io.Writer) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return errors.Wrap(err, "retrieving image layers")
+	}
+
+	seen := map[string]bool{}
+	keep := make([]map[string]bool, len(layers))
+	var upper []layerChanges
+	for i := len(layers) - 1; i >= 0; i-- {
+		changes := layerChanges{whiteouts: map[string]bool{}, opaque: map[string]bool{}}
+		keep[i] = map[string]bool{}
+		if err := forEachEntry(layers[i], func(header *tar.Header, _ io.Reader) error {
+			name := cleanLayerPath(header.Name)
+			base := path.Base(name)
+			switch {
+			case base == opaqueWhiteout:
+				changes.opaque[path.Dir(name)] = true
+				return nil
+			case strings.HasPrefix(base, whiteoutPrefix):
+				changes.whiteouts[path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix))] = true
+				return nil
+			}
+			if seen[name] || hidden(name, upper) {
+				return nil
+			}
+			seen[name] = true
+			keep[i][name] = true
+			// anything other than a directory replaces whatever was below it
+			if header.Typeflag != tar.TypeDir {
+				changes.whiteouts[name] = true
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		upper = append(upper, changes)
+	}
+
+	tw := tar.NewWriter(w)
+	for i, layer := range layers {
+		if err := forEachEntry(layer, func(header *tar.Header, r io.Reader) error {
+			name := cleanLayerPath(header.Name)
+			if !keep[i][name] {
+				return nil
+			}
+			// only keep the first occurrence if a layer contains duplicates
+			delete(keep[i], name)
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			_, err := io.Copy(tw, r)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -16,11 +16,14 @@ package drivers
 
 import (
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -33,12 +36,20 @@ import (
 
 type HostDriver struct {
 	ConfigPath string // path to image metadata config on host fs
-	GlobalVars []unversioned.EnvVar
+
+	// env vars set on this driver. these are passed to each command run
+	// rather than set in the process environment, so that multiple drivers
+	// can safely run side by side.
+	env map[string]string
+
+	timeout time.Duration
 }
 
 func NewHostDriver(args DriverConfig) (Driver, error) {
 	return &HostDriver{
 		ConfigPath: args.Metadata,
+		env:        map[string]string{},
+		timeout:    args.Timeout,
 	}, nil
 }
 
@@ -49,10 +60,11 @@ func (d *HostDriver) Destroy() {
 func (d *HostDriver) Setup(envVars []unversioned.EnvVar, fullCommands [][]string) error {
 	// since we're running on the host, we'll provide an optional teardown field for
 	// each test that will allow users to undo the setup they did.
-	// keep track of the original env vars so we can reset later.
-	d.GlobalVars = SetEnvVars(envVars)
+	if err := d.SetEnv(envVars); err != nil {
+		return err
+	}
 	for _, cmd := range fullCommands {
-		_, _, _, err := d.ProcessCommand(nil, cmd)
+		_, _, _, err := d.ProcessCommand(nil, cmd, nil)
 		if err != nil {
 			return err
 		}
@@ -63,9 +75,9 @@ func (d *HostDriver) Setup(envVars []unversioned.EnvVar, fullCommands [][]string
 func (d *HostDriver) Teardown(fullCommands [][]string) error {
 	// since we're running on the host, we'll provide an optional teardown field for each test that
 	// will allow users to undo the setup they did.
-	ResetEnvVars(d.GlobalVars)
+	d.env = map[string]string{}
 	for _, cmd := range fullCommands {
-		_, _, _, err := d.ProcessCommand(nil, cmd)
+		_, _, _, err := d.ProcessCommand(nil, cmd, nil)
 		if err != nil {
 			return err
 		}
@@ -74,59 +86,51 @@ func (d *HostDriver) Teardown(fullCommands [][]string) error {
 }
 
 func (d *HostDriver) SetEnv(envVars []unversioned.EnvVar) error {
+	env := d.environment(envVars)
 	for _, envVar := range envVars {
-		if err := os.Setenv(envVar.Key, os.ExpandEnv(envVar.Value)); err != nil {
-			return err
-		}
+		d.env[envVar.Key] = env[envVar.Key]
 	}
 	return nil
 }
 
-// given a list of environment variable key/value pairs, set these in the current environment.
-// also, keep track of the previous values of these vars to reset after test execution.
-func SetEnvVars(envVars []unversioned.EnvVar) []unversioned.EnvVar {
-	var originalVars []unversioned.EnvVar
-	for _, envVar := range envVars {
-		originalVars = append(originalVars, unversioned.EnvVar{envVar.Key, os.Getenv(envVar.Key), envVar.IsRegex})
-		if err := os.Setenv(envVar.Key, os.ExpandEnv(envVar.Value)); err != nil {
-			logrus.Errorf("Error setting env var: %s", err)
-		}
+// environment returns the environment a command should be run with: the host's
+// environment, overlaid with the vars set on the driver and the provided vars.
+// values are expanded against the environment built up so far.
+func (d *HostDriver) environment(envVars []unversioned.EnvVar) map[string]string {
+	env := convertSliceToMap(os.Environ())
+	for k, v := range d.env {
+		env[k] = v
 	}
-	return originalVars
-}
-
-func ResetEnvVars(envVars []unversioned.EnvVar) {
 	for _, envVar := range envVars {
-		var err error
-		if envVar.Value == "" {
-			// if the previous value was empty string, the variable did not
-			// exist in the environment; unset it
-			err = os.Unsetenv(envVar.Key)
-		} else {
-			// otherwise, set it back to its previous value
-			err = os.Setenv(envVar.Key, envVar.Value)
-		}
-		if err != nil {
-			logrus.Errorf("error resetting env var: %s", err)
-		}
+		env[envVar.Key] = os.Expand(envVar.Value, func(key string) string {
+			return env[key]
+		})
 	}
+	return env
 }
 
-func (d *HostDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string) (string, string, int, error) {
-	originalVars := SetEnvVars(envVars)
-	defer ResetEnvVars(originalVars)
-	cmd := exec.Command(fullCommand[0], fullCommand[1:]...)
+func (d *HostDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string, stdin io.Reader) (string, string, int, error) {
+	env := d.environment(envVars)
+	cmd := exec.Command(lookPath(fullCommand[0], env["PATH"]), fullCommand[1:]...)
+	cmd.Env = convertMapToSlice(env)
+	cmd.Stdin = stdin
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
 	exitCode := 0
 
+	if d.timeout > 0 {
+		setProcessGroup(cmd)
+	}
 	if err := cmd.Start(); err != nil {
 		logrus.Fatalf("error starting command: %v", err)
 	}
 
-	if err := cmd.Wait(); err != nil {
+	if err := waitCommand(cmd, d.timeout); err != nil {
+		if IsTimeout(err) {
+			return stdout.String(), stderr.String(), -1, err
+		}
 		if exiterr, ok := err.(*exec.ExitError); ok {
 			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
 				exitCode = status.ExitStatus()
@@ -139,18 +143,52 @@ func (d *HostDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []
 	return stdout.String(), stderr.String(), exitCode, nil
 }
 
+// lookPath finds a command in the dirs of the PATH it is run with, rather than
+// in the PATH of this process as exec.Command does. commands that aren't found
+// are left to exec.Command to report.
+func lookPath(file, path string) string {
+	if strings.ContainsRune(file, os.PathSeparator) || strings.Contains(file, "/") {
+		return file
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		if p, err := exec.LookPath(filepath.Join(dir, file)); err == nil {
+			return p
+		}
+	}
+	return file
+}
+
 func (d *HostDriver) StatFile(path string) (os.FileInfo, error) {
 	return os.Stat(path)
 }
 
+func (d *HostDriver) Lstat(path string) (os.FileInfo, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	return hostFileInfo(path, info)
+}
+
 func (d *HostDriver) ReadFile(path string) ([]byte, error) {
 	return ioutil.ReadFile(path)
 }
 
+func (d *HostDriver) OpenFile(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
 func (d *HostDriver) ReadDir(path string) ([]os.FileInfo, error) {
 	return ioutil.ReadDir(path)
 }
 
+func (d *HostDriver) Walk(root string, fn filepath.WalkFunc) error {
+	return walkHost(root, fn)
+}
+
 func (d *HostDriver) GetConfig() (unversioned.Config, error) {
 	file, err := ioutil.ReadFile(d.ConfigPath)
 	if err != nil {
@@ -160,28 +198,9 @@ func (d *HostDriver) GetConfig() (unversioned.Config, error) {
 	var metadata v1.ConfigFile
 
 	json.Unmarshal(file, &metadata)
-	config := metadata.Config
-
-	// docker provides these as maps (since they can be mapped in docker run commands)
-	// since this will never be the case when built through a dockerfile, we convert to list of strings
-	volumes := []string{}
-	for v := range config.Volumes {
-		volumes = append(volumes, v)
-	}
-
-	ports := []string{}
-	for p := range config.ExposedPorts {
-		// docker always appends the protocol to the port, so this is safe
-		ports = append(ports, strings.Split(p, "/")[0])
-	}
+	return convertConfigFile(&metadata, file)
+}
 
-	return unversioned.Config{
-		Env:          convertSliceToMap(config.Env),
-		Entrypoint:   config.Entrypoint,
-		Cmd:          config.Cmd,
-		Volumes:      volumes,
-		Workdir:      config.WorkingDir,
-		ExposedPorts: ports,
-		Labels:       config.Labels,
-	}, nil
+func (d *HostDriver) GetLayers() ([]unversioned.Layer, error) {
+	return nil, errors.New("Host driver is unable to inspect image layers, please use the tar or docker driver")
 }
@@ -0,0 +1,87 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package drivers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+func TestHostDriverTimeout(t *testing.T) {
+	driver, err := NewHostDriver(DriverConfig{Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	// the background sleep holds on to stdout, so the whole process group must be killed
+	stdout, _, exitCode, err := driver.ProcessCommand(nil, []string{"sh", "-c", "echo started; sleep 10 & sleep 10"}, nil)
+	if !IsTimeout(err) {
+		t.Fatalf("expected timeout error but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected command to be killed after timeout, but it ran for %s", elapsed)
+	}
+	if stdout != "started\n" || exitCode != -1 {
+		t.Errorf("expected output before timeout and exit code -1, got %q and %d", stdout, exitCode)
+	}
+
+	stdout, _, exitCode, err = driver.ProcessCommand(nil, []string{"sh", "-c", "echo done; exit 3"}, nil)
+	if err != nil || stdout != "done\n" || exitCode != 3 {
+		t.Errorf("expected command to complete within timeout, got %q, %d, %v", stdout, exitCode, err)
+	}
+}
+
+func TestHostDriverStdin(t *testing.T) {
+	driver, err := NewHostDriver(DriverConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, exitCode, err := driver.ProcessCommand(nil, []string{"tr", "a-z", "A-Z"}, strings.NewReader("hello\n"))
+	if err != nil || stdout != "HELLO\n" || exitCode != 0 {
+		t.Errorf("expected command to read stdin, got %q, %d, %v", stdout, exitCode, err)
+	}
+}
+
+func TestHostDriverPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "hello-from-path"), []byte("#!/bin/sh\necho hello\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := NewHostDriver(DriverConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the command is only found through the PATH it is run with
+	env := []unversioned.EnvVar{{Key: "PATH", Value: dir + ":$PATH"}}
+	stdout, _, exitCode, err := driver.ProcessCommand(env, []string{"hello-from-path"}, nil)
+	if err != nil || stdout != "hello\n" || exitCode != 0 {
+		t.Errorf("expected command to be found in PATH, got %q, %d, %v", stdout, exitCode, err)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// layerContents is the list of entries in a layer, with whiteouts separated out.
+type layerContents struct {
+	entries   []*tar.Header
+	whiteouts []string
+	opaque    []string
+	size      int64
+}
+
+func readLayerContents(layer v1.Layer) (*layerContents, error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading layer contents")
+	}
+	defer rc.Close()
+	cr := &countingReader{r: rc}
+	tr := tar.NewReader(cr)
+	contents := &layerContents{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading tar")
+		}
+		name := cleanLayerPath(header.Name)
+		if name == "" {
+			continue
+		}
+		base := path.Base(name)
+		switch {
+		case base == opaqueWhiteout:
+			contents.opaque = append(contents.opaque, path.Clean("/"+path.Dir(name)))
+		case strings.HasPrefix(base, whiteoutPrefix):
+			contents.whiteouts = append(contents.whiteouts, "/"+path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix)))
+		default:
+			header.Name = "/" + name
+			contents.entries = append(contents.entries, header)
+		}
+	}
+	// count the end of archive padding as well
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return nil, errors.Wrap(err, "reading layer contents")
+	}
+	contents.size = cr.n
+	return contents, nil
+}
+
+// within returns whether p is inside the directory dir.
+func within(p, dir string) bool {
+	return dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// imageLayers describes the layers of an image from the bottom up, working out
+// the paths each one adds, modifies and deletes by replaying them in order.
+// directories already present below a layer aren't reported as modified, since
+// layers restate the parent directories of everything they change.
+func imageLayers(img v1.Image) ([]unversioned.Layer, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieving image layers")
+	}
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieving image config")
+	}
+	// history entries for empty layers, e.g. from ENV, don't have a layer of their own
+	var createdBy []string
+	for _, h := range configFile.History {
+		if !h.EmptyLayer {
+			createdBy = append(createdBy, h.CreatedBy)
+		}
+	}
+	if len(createdBy) != len(layers) {
+		createdBy = nil
+	}
+
+	// every path in the filesystem so far, and whether it is a directory
+	existing := map[string]bool{}
+	var res []unversioned.Layer
+	for i, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return nil, errors.Wrap(err, "retrieving layer digest")
+		}
+		size, err := layer.Size()
+		if err != nil {
+			return nil, errors.Wrap(err, "retrieving layer size")
+		}
+		contents, err := readLayerContents(layer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "layer %d", i)
+		}
+		l := unversioned.Layer{
+			Digest:           digest.String(),
+			Size:             size,
+			UncompressedSize: contents.size,
+		}
+		if createdBy != nil {
+			l.CreatedBy = createdBy[i]
+		}
+
+		deleted := map[string]bool{}
+		clearDir := func(dir string) {
+			for e := range existing {
+				if within(e, dir) {
+					deleted[e] = true
+					delete(existing, e)
+				}
+			}
+		}
+		for _, dir := range contents.opaque {
+			clearDir(dir)
+		}
+		for _, p := range contents.whiteouts {
+			if _, ok := existing[p]; ok {
+				deleted[p] = true
+				delete(existing, p)
+			}
+			clearDir(p)
+		}
+		for _, header := range contents.entries {
+			p := header.Name
+			isDir := header.Typeflag == tar.TypeDir
+			wasDir, exists := existing[p]
+			if deleted[p] {
+				// replaced after being cleared by an opaque whiteout
+				delete(deleted, p)
+				exists = true
+			}
+			switch {
+			case !exists:
+				l.Added = append(l.Added, p)
+			case wasDir && isDir:
+			default:
+				l.Modified = append(l.Modified, p)
+			}
+			if wasDir && !isDir {
+				// a directory replaced by a file takes its contents with it
+				clearDir(p)
+			}
+			existing[p] = isDir
+		}
+		for p := range deleted {
+			l.Deleted = append(l.Deleted, p)
+		}
+		sort.Strings(l.Added)
+		sort.Strings(l.Modified)
+		sort.Strings(l.Deleted)
+		res = append(res, l)
+	}
+	return res, nil
+}
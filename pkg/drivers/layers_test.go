@@ -0,0 +1,91 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// layoutImage returns the image for a manifest written to a layout, without
+// needing it to be referenced from the layout's index.
+func layoutImage(t *testing.T, dir string, desc v1.Descriptor) v1.Image {
+	t.Helper()
+	layout := ociLayout{path: dir}
+	rawManifest, err := layout.readBlob(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ociImage{layout: layout, desc: desc, rawManifest: rawManifest}
+}
+
+func TestImageLayers(t *testing.T) {
+	dir := newTestLayout(t)
+	defer os.RemoveAll(dir)
+
+	img, err := OCIImageFromLayout("oci:"+dir, "linux/amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := imageLayers(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 2 {
+		t.Fatalf("expected 2 layers, got %d", len(layers))
+	}
+
+	base, top := layers[0], layers[1]
+	testutil.CheckDeepEqual(t, []string{"/etc", "/etc/config", "/etc/removed", "/opaque", "/opaque/hidden"}, base.Added)
+	testutil.CheckDeepEqual(t, []string(nil), base.Modified)
+	testutil.CheckDeepEqual(t, []string(nil), base.Deleted)
+
+	testutil.CheckDeepEqual(t, []string{"/opaque/new"}, top.Added)
+	testutil.CheckDeepEqual(t, []string{"/etc/config"}, top.Modified)
+	testutil.CheckDeepEqual(t, []string{"/etc/removed", "/opaque/hidden"}, top.Deleted)
+
+	// the base layer is stored compressed and the top one uncompressed
+	if base.Size >= base.UncompressedSize {
+		t.Errorf("expected compressed size %d to be less than uncompressed size %d", base.Size, base.UncompressedSize)
+	}
+	testutil.CheckDeepEqual(t, top.Size, top.UncompressedSize)
+}
+
+func TestImageLayersReplacedDirectory(t *testing.T) {
+	dir := newTestLayout(t)
+	defer os.RemoveAll(dir)
+
+	desc := writeImage(t, dir, "amd64",
+		[]layerEntry{
+			{name: "app/", dir: true},
+			{name: "app/build/", dir: true},
+			{name: "app/build/out.o", contents: "obj"},
+		},
+		[]layerEntry{
+			{name: "app/build", contents: "now a file"},
+		},
+	)
+	layers, err := imageLayers(layoutImage(t, dir, desc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []string{"/app/build"}, layers[1].Modified)
+	testutil.CheckDeepEqual(t, []string{"/app/build/out.o"}, layers[1].Deleted)
+	testutil.CheckDeepEqual(t, []string(nil), layers[1].Added)
+}
@@ -0,0 +1,399 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	pkgutil "github.com/GoogleContainerTools/container-diff/pkg/util"
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/v1util"
+)
+
+const (
+	// OCIPrefix marks an image reference as a path to an OCI image layout directory,
+	// optionally followed by the ref name of the image to use, e.g. oci:/path/to/dir:latest
+	OCIPrefix = "oci:"
+
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// IsOCILayout returns whether the image reference points to an OCI image layout.
+func IsOCILayout(image string) bool {
+	return strings.HasPrefix(image, OCIPrefix)
+}
+
+// parseOCIReference splits an oci: image reference into the layout path and ref name.
+func parseOCIReference(image string) (string, string) {
+	ref := strings.TrimPrefix(image, OCIPrefix)
+	i := strings.LastIndex(ref, ":")
+	if i < 0 || strings.Contains(ref[i+1:], "/") {
+		return ref, ""
+	}
+	return ref[:i], ref[i+1:]
+}
+
+// ParsePlatform parses a platform in the form os/arch[/variant]
+func ParsePlatform(platform string) (*v1.Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid platform %s, expected os/arch[/variant]", platform)
+	}
+	p := &v1.Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func platformString(p *v1.Platform) string {
+	if p == nil {
+		return "unknown"
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+func platformMatches(want, have *v1.Platform) bool {
+	if have == nil {
+		return false
+	}
+	return want.OS == have.OS &&
+		want.Architecture == have.Architecture &&
+		(want.Variant == "" || want.Variant == have.Variant)
+}
+
+type ociLayout struct {
+	path string
+}
+
+func (l ociLayout) blobPath(h v1.Hash) string {
+	return filepath.Join(l.path, "blobs", h.Algorithm, h.Hex)
+}
+
+func (l ociLayout) blob(h v1.Hash) (io.ReadCloser, error) {
+	return os.Open(l.blobPath(h))
+}
+
+func (l ociLayout) readBlob(h v1.Hash) ([]byte, error) {
+	return ioutil.ReadFile(l.blobPath(h))
+}
+
+// manifests returns every image manifest descriptor reachable from the layout's
+// index, descending into nested indexes. descriptors nested in an index inherit
+// its ref name if they don't have one of their own.
+func (l ociLayout) manifests(index []byte, refName string) ([]v1.Descriptor, error) {
+	im, err := v1.ParseIndexManifest(bytes.NewReader(index))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing index")
+	}
+	var descs []v1.Descriptor
+	for _, desc := range im.Manifests {
+		name := desc.Annotations[ociRefNameAnnotation]
+		if name == "" {
+			name = refName
+		}
+		switch desc.MediaType {
+		case types.OCIImageIndex, types.DockerManifestList:
+			nested, err := l.readBlob(desc.Digest)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading index %s", desc.Digest)
+			}
+			children, err := l.manifests(nested, name)
+			if err != nil {
+				return nil, err
+			}
+			descs = append(descs, children...)
+		case types.OCIManifestSchema1, types.DockerManifestSchema2:
+			if desc.Annotations == nil {
+				desc.Annotations = map[string]string{}
+			}
+			desc.Annotations[ociRefNameAnnotation] = name
+			descs = append(descs, desc)
+		default:
+			logrus.Debugf("skipping descriptor %s with unsupported media type %s", desc.Digest, desc.MediaType)
+		}
+	}
+	return descs, nil
+}
+
+// OCIImageFromLayout resolves an image in an OCI image layout directory. When the
+// index contains images for several platforms, the provided platform (os/arch[/variant])
+// is used to select one, defaulting to linux on the current architecture.
+func OCIImageFromLayout(image string, platform string) (v1.Image, error) {
+	path, refName := parseOCIReference(image)
+	layout := ociLayout{path: path}
+	index, err := ioutil.ReadFile(filepath.Join(path, "index.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading OCI layout index")
+	}
+	descs, err := layout.manifests(index, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []v1.Descriptor
+	for _, desc := range descs {
+		if refName == "" || desc.Annotations[ociRefNameAnnotation] == refName {
+			candidates = append(candidates, desc)
+		}
+	}
+	if len(candidates) == 0 {
+		if refName != "" {
+			return nil, fmt.Errorf("no image with ref name %s found in OCI layout %s", refName, path)
+		}
+		return nil, fmt.Errorf("no images found in OCI layout %s", path)
+	}
+
+	if len(candidates) > 1 || platform != "" {
+		if platform == "" {
+			platform = "linux/" + runtime.GOARCH
+		}
+		want, err := ParsePlatform(platform)
+		if err != nil {
+			return nil, err
+		}
+		var matches []v1.Descriptor
+		var available []string
+		for _, desc := range candidates {
+			available = append(available, platformString(desc.Platform))
+			if platformMatches(want, desc.Platform) {
+				matches = append(matches, desc)
+			}
+		}
+		// an image without a platform in its descriptor is used as is if it is the only one
+		if len(matches) == 0 && len(candidates) == 1 && candidates[0].Platform == nil {
+			matches = candidates
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no image for platform %s found in OCI layout %s, available platforms: %s", platform, path, strings.Join(available, ", "))
+		}
+		candidates = matches
+	}
+	if len(candidates) > 1 {
+		return nil, fmt.Errorf("found %d images in OCI layout %s, please specify a ref name", len(candidates), path)
+	}
+
+	desc := candidates[0]
+	rawManifest, err := layout.readBlob(desc.Digest)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading image manifest")
+	}
+	return &ociImage{
+		layout:      layout,
+		desc:        desc,
+		rawManifest: rawManifest,
+	}, nil
+}
+
+// ociImage implements v1.Image for an image stored in an OCI image layout.
+type ociImage struct {
+	layout      ociLayout
+	desc        v1.Descriptor
+	rawManifest []byte
+}
+
+var _ v1.Image = (*ociImage)(nil)
+
+func (i *ociImage) MediaType() (types.MediaType, error) {
+	return i.desc.MediaType, nil
+}
+
+func (i *ociImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *ociImage) Manifest() (*v1.Manifest, error) {
+	return partial.Manifest(i)
+}
+
+func (i *ociImage) Digest() (v1.Hash, error) {
+	return i.desc.Digest, nil
+}
+
+func (i *ociImage) RawConfigFile() ([]byte, error) {
+	m, err := i.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	return i.layout.readBlob(m.Config.Digest)
+}
+
+func (i *ociImage) ConfigFile() (*v1.ConfigFile, error) {
+	return partial.ConfigFile(i)
+}
+
+func (i *ociImage) ConfigName() (v1.Hash, error) {
+	return partial.ConfigName(i)
+}
+
+func (i *ociImage) BlobSet() (map[v1.Hash]struct{}, error) {
+	return partial.BlobSet(i)
+}
+
+func (i *ociImage) Layers() ([]v1.Layer, error) {
+	m, err := i.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	var layers []v1.Layer
+	for _, desc := range m.Layers {
+		layers = append(layers, &ociLayer{image: i, desc: desc})
+	}
+	return layers, nil
+}
+
+func (i *ociImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	layers, err := i.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range layers {
+		if l.(*ociLayer).desc.Digest == h {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s not found in image", h)
+}
+
+func (i *ociImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	d, err := partial.DiffIDToBlob(i, h)
+	if err != nil {
+		return nil, err
+	}
+	return i.LayerByDigest(d)
+}
+
+// ociLayer implements v1.Layer for a layer blob in an OCI image layout,
+// which may be stored either compressed or uncompressed.
+type ociLayer struct {
+	image *ociImage
+	desc  v1.Descriptor
+}
+
+func (l *ociLayer) Digest() (v1.Hash, error) {
+	return l.desc.Digest, nil
+}
+
+func (l *ociLayer) DiffID() (v1.Hash, error) {
+	return partial.BlobToDiffID(l.image, l.desc.Digest)
+}
+
+func (l *ociLayer) Size() (int64, error) {
+	return l.desc.Size, nil
+}
+
+func (l *ociLayer) compressed() bool {
+	return !strings.HasSuffix(string(l.desc.MediaType), ".tar")
+}
+
+func (l *ociLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.image.layout.blob(l.desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if l.compressed() {
+		return rc, nil
+	}
+	return v1util.GzipReadCloser(rc)
+}
+
+func (l *ociLayer) Uncompressed() (io.ReadCloser, error) {
+	rc, err := l.image.layout.blob(l.desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if !l.compressed() {
+		return rc, nil
+	}
+	// some tools mark uncompressed layers with a compressed media type, so check
+	br := bufio.NewReader(rc)
+	magic, err := br.Peek(2)
+	if err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return v1util.GunzipReadCloser(readCloser{br, rc})
+	}
+	return readCloser{br, rc}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// flattenedLayer exposes the flattened filesystem of an image as a single layer.
+type flattenedLayer struct {
+	image v1.Image
+}
+
+func (l flattenedLayer) DiffID() (v1.Hash, error) {
+	return v1.Hash{}, errors.New("flattened layers have no diff id")
+}
+
+func (l flattenedLayer) Uncompressed() (io.ReadCloser, error) {
+	return flatten(l.image), nil
+}
+
+// getOCIImage resolves an image in an OCI layout and extracts its filesystem
+// into a temp directory, in the same way container-diff does for other images.
+func getOCIImage(image string, platform string) (pkgutil.Image, error) {
+	img, err := OCIImageFromLayout(image, platform)
+	if err != nil {
+		return pkgutil.Image{}, err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return pkgutil.Image{}, err
+	}
+	path, err := ioutil.TempDir("", "oci-"+digest.Hex)
+	if err != nil {
+		return pkgutil.Image{}, err
+	}
+	layer, err := partial.UncompressedToLayer(flattenedLayer{image: img})
+	if err != nil {
+		os.RemoveAll(path)
+		return pkgutil.Image{}, err
+	}
+	extractLock.Lock()
+	defer extractLock.Unlock()
+	if err := pkgutil.GetFileSystemForLayer(layer, path, nil); err != nil {
+		os.RemoveAll(path)
+		return pkgutil.Image{}, errors.Wrap(err, "getting filesystem for image")
+	}
+	return pkgutil.Image{
+		Image:  img,
+		Source: image,
+		FSPath: path,
+		Digest: digest,
+	}, nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+type layerEntry struct {
+	name     string
+	contents string
+	dir      bool
+}
+
+func layerTar(t *testing.T, entries []layerEntry) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.contents))}
+		if e.dir {
+			header.Mode = 0755
+			header.Typeflag = tar.TypeDir
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeBlob(t *testing.T, dir string, b []byte, mediaType types.MediaType) v1.Descriptor {
+	t.Helper()
+	h, size, err := v1.SHA256(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobDir := filepath.Join(dir, "blobs", h.Algorithm)
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(blobDir, h.Hex), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return v1.Descriptor{MediaType: mediaType, Size: size, Digest: h}
+}
+
+func writeJSONBlob(t *testing.T, dir string, v interface{}, mediaType types.MediaType) v1.Descriptor {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeBlob(t, dir, b, mediaType)
+}
+
+// writeImage writes an image with the given layers to the layout, storing the
+// first layer compressed and the rest uncompressed.
+func writeImage(t *testing.T, dir string, arch string, layers ...[]layerEntry) v1.Descriptor {
+	t.Helper()
+	config := v1.ConfigFile{Architecture: arch, OS: "linux"}
+	manifest := v1.Manifest{SchemaVersion: 2, MediaType: types.OCIManifestSchema1}
+	for i, entries := range layers {
+		layer := layerTar(t, entries)
+		diffID, _, err := v1.SHA256(bytes.NewReader(layer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+		if i == 0 {
+			manifest.Layers = append(manifest.Layers, writeBlob(t, dir, gzipped(t, layer), types.OCILayer))
+		} else {
+			manifest.Layers = append(manifest.Layers, writeBlob(t, dir, layer, types.OCIUncompressedLayer))
+		}
+	}
+	manifest.Config = writeJSONBlob(t, dir, config, types.OCIConfigJSON)
+	desc := writeJSONBlob(t, dir, manifest, types.OCIManifestSchema1)
+	desc.Platform = &v1.Platform{OS: "linux", Architecture: arch}
+	return desc
+}
+
+func newTestLayout(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "oci-layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := []layerEntry{
+		{name: "etc/", dir: true},
+		{name: "etc/config", contents: "base"},
+		{name: "etc/removed", contents: "removed"},
+		{name: "opaque/", dir: true},
+		{name: "opaque/hidden", contents: "hidden"},
+	}
+	top := []layerEntry{
+		{name: "etc/config", contents: "top"},
+		{name: "etc/.wh.removed"},
+		{name: "opaque/", dir: true},
+		{name: "opaque/.wh..wh..opq"},
+		{name: "opaque/new", contents: "new"},
+	}
+	amd64 := writeImage(t, dir, "amd64", base, top)
+	arm64 := writeImage(t, dir, "arm64", base)
+	index := writeJSONBlob(t, dir, v1.IndexManifest{
+		SchemaVersion: 2,
+		Manifests:     []v1.Descriptor{amd64, arm64},
+	}, types.OCIImageIndex)
+	index.Annotations = map[string]string{ociRefNameAnnotation: "latest"}
+	b, err := json.Marshal(v1.IndexManifest{SchemaVersion: 2, Manifests: []v1.Descriptor{index}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func flattenedFiles(t *testing.T, img v1.Image) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	rc := flatten(img)
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(contents)
+	}
+	return files
+}
+
+func TestOCIImageFromLayout(t *testing.T) {
+	dir := newTestLayout(t)
+	defer os.RemoveAll(dir)
+
+	tables := []struct {
+		image    string
+		platform string
+		arch     string
+		files    []string
+		err      bool
+	}{
+		{image: "oci:" + dir, platform: "linux/amd64", arch: "amd64", files: []string{"etc/", "etc/config", "opaque/", "opaque/new"}},
+		{image: "oci:" + dir + ":latest", platform: "linux/arm64", arch: "arm64", files: []string{"etc/", "etc/config", "etc/removed", "opaque/", "opaque/hidden"}},
+		{image: "oci:" + dir + ":other", platform: "linux/amd64", err: true},
+		{image: "oci:" + dir, platform: "linux/s390x", err: true},
+		{image: "oci:" + dir, platform: "linux", err: true},
+	}
+
+	for _, table := range tables {
+		img, err := OCIImageFromLayout(table.image, table.platform)
+		if table.err {
+			if err == nil {
+				t.Errorf("expected error resolving %s for %s but got none", table.image, table.platform)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("resolving %s for %s: %s", table.image, table.platform, err)
+		}
+		config, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.CheckDeepEqual(t, table.arch, config.Architecture)
+
+		files := flattenedFiles(t, img)
+		var names []string
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		testutil.CheckDeepEqual(t, table.files, names)
+	}
+}
+
+func TestTarDriverOCILayout(t *testing.T) {
+	dir := newTestLayout(t)
+	defer os.RemoveAll(dir)
+
+	driver, err := NewTarDriver(DriverConfig{Image: "oci:" + dir, Platform: "linux/amd64"})
+	if err != nil {
+		t.Fatalf("creating driver: %s", err)
+	}
+	defer driver.Destroy()
+
+	contents, err := driver.ReadFile("/etc/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "top", string(contents))
+	if _, err := driver.StatFile("/etc/removed"); err == nil {
+		t.Errorf("expected whited out file to be removed")
+	}
+	infos, err := driver.ReadDir("/opaque")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "new" {
+		t.Errorf("expected only opaque/new in opaque directory, got %v", infos)
+	}
+}
+
+func TestTarDriverOCILayoutCleanup(t *testing.T) {
+	dir := newTestLayout(t)
+	defer os.RemoveAll(dir)
+	// truncate the compressed layers, so that extracting the image fails
+	blobs, err := filepath.Glob(filepath.Join(dir, "blobs", "sha256", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range blobs {
+		b, err := ioutil.ReadFile(blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+			if err := ioutil.WriteFile(blob, b[:20], 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+
+	if _, err := NewTarDriver(DriverConfig{Image: "oci:" + dir, Platform: "linux/amd64"}); err == nil {
+		t.Fatal("expected error extracting a corrupt layer")
+	}
+	if left, _ := ioutil.ReadDir(tmp); len(left) != 0 {
+		t.Errorf("expected the extraction directory to be removed, found %s", left[0].Name())
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/sif"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// SIFDriver reads singularity images directly from the SIF file, so file and
+// metadata tests can run without singularity installed. like the tar driver,
+// it can't run commands.
+type SIFDriver struct {
+	image *sif.Image
+	env   map[string]string
+}
+
+func NewSIFDriver(args DriverConfig) (Driver, error) {
+	image, err := sif.Open(args.Image)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening SIF image")
+	}
+	env, err := image.Environment()
+	if err != nil {
+		image.Close()
+		return nil, errors.Wrap(err, "reading image environment")
+	}
+	return &SIFDriver{
+		image: image,
+		env:   env,
+	}, nil
+}
+
+func (d *SIFDriver) Destroy() {
+	if err := d.image.Close(); err != nil {
+		logrus.Warnf("error closing SIF image: %s", err)
+	}
+}
+
+func (d *SIFDriver) SetEnv(envVars []unversioned.EnvVar) error {
+	for _, envVar := range envVars {
+		d.env[envVar.Key] = os.Expand(envVar.Value, func(key string) string {
+			return d.env[key]
+		})
+	}
+	return nil
+}
+
+func (d *SIFDriver) Setup(_ []unversioned.EnvVar, _ [][]string) error {
+	return errors.New("SIF driver is unable to process commands, please use the singularity driver")
+}
+
+func (d *SIFDriver) Teardown(_ [][]string) error {
+	return errors.New("SIF driver is unable to process commands, please use the singularity driver")
+}
+
+func (d *SIFDriver) ProcessCommand(_ []unversioned.EnvVar, _ []string, _ io.Reader) (string, string, int, error) {
+	return "", "", -1, errors.New("SIF driver is unable to process commands, please use the singularity driver")
+}
+
+func (d *SIFDriver) StatFile(path string) (os.FileInfo, error) {
+	return d.image.RootFS().Stat(path)
+}
+
+func (d *SIFDriver) Lstat(path string) (os.FileInfo, error) {
+	return d.image.RootFS().Lstat(path)
+}
+
+func (d *SIFDriver) ReadFile(path string) ([]byte, error) {
+	return d.image.RootFS().ReadFile(path)
+}
+
+func (d *SIFDriver) OpenFile(path string) (io.ReadCloser, error) {
+	return d.image.RootFS().Open(path)
+}
+
+func (d *SIFDriver) ReadDir(path string) ([]os.FileInfo, error) {
+	return d.image.RootFS().ReadDir(path)
+}
+
+func (d *SIFDriver) Walk(root string, fn filepath.WalkFunc) error {
+	info, err := d.image.RootFS().Lstat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	err = d.walk(path.Clean("/"+root), info, fn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walk follows the structure of filepath.Walk, so that SkipDir returned for a
+// file skips the rest of its directory.
+func (d *SIFDriver) walk(p string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if err := fn(p, info, nil); err != nil || !info.IsDir() {
+		return err
+	}
+	children, err := d.image.RootFS().ReadDir(p)
+	if err != nil {
+		return fn(p, info, err)
+	}
+	for _, child := range children {
+		err := d.walk(path.Join(p, child.Name()), child, fn)
+		if err != nil && (err != filepath.SkipDir || !child.IsDir()) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *SIFDriver) GetConfig() (unversioned.Config, error) {
+	labels, err := d.image.Labels()
+	if err != nil {
+		return unversioned.Config{}, errors.Wrap(err, "reading image labels")
+	}
+	return unversioned.Config{
+		Env:          d.env,
+		Entrypoint:   []string{},
+		Cmd:          []string{},
+		Volumes:      []string{},
+		Workdir:      "",
+		ExposedPorts: []string{},
+		Labels:       labels,
+		OS:           "linux",
+		Architecture: d.image.Arch(),
+		Created:      d.image.Created(),
+	}, nil
+}
+
+func (d *SIFDriver) GetLayers() ([]unversioned.Layer, error) {
+	return nil, errors.New("SIF images do not have layers")
+}
@@ -1,53 +1,71 @@
 package drivers
 
 import (
-	"os"
-	"fmt"
-	"path/filepath"
 	"archive/tar"
-	"io"
 	"bytes"
-	"bufio"
-	"strings"
-	"github.com/pkg/errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/GoogleContainerTools/container-structure-test/pkg/sif"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 
 	singularity "github.com/stewartad/singolang"
 )
 
+// prefix singularity uses to pass environment variables into a container
+const singularityEnvPrefix = "SINGULARITYENV"
+
 type SingularityDriver struct {
-	originalImage 	string
-	currentImage 	string
-	currentInstance	*singularity.Instance
-	cli 			singularity.Client
-	env				map[string]string
-	save			bool
-	runtime			string
+	originalImage   string
+	currentImage    string
+	currentInstance *singularity.Instance
+	cli             singularity.Client
+	env             map[string]string
+	save            bool
+	runtime         string
+	timeout         time.Duration
+}
+
+// instances are named uniquely for each driver, so that drivers running
+// side by side don't start, stop or copy files out of each other's instances.
+var instanceCount uint64
+
+func instanceName() string {
+	return fmt.Sprintf("testing-%d-%d", os.Getpid(), atomic.AddUint64(&instanceCount, 1))
 }
 
 func NewSingularityDriver(args DriverConfig) (Driver, error) {
 	newCli, teardown := singularity.NewClient()
 	_ = teardown
-	instance, err := newCli.NewInstance(args.Image, "testing-base", singularity.DefaultEnvOptions())
+	instance, err := newCli.NewInstance(args.Image, instanceName(), singularity.DefaultEnvOptions())
 	if err != nil {
 		return &SingularityDriver{}, nil
 	}
 
 	return &SingularityDriver{
-		originalImage:	args.Image,
-		currentImage:	args.Image,
+		originalImage:   args.Image,
+		currentImage:    args.Image,
 		currentInstance: instance,
-		cli:			*newCli,
-		env:			nil,
-		save:			args.Save,
-		runtime:		args.Runtime,
+		cli:             *newCli,
+		env:             map[string]string{},
+		save:            args.Save,
+		runtime:         args.Runtime,
+		timeout:         args.Timeout,
 	}, nil
 }
 
-func (d *SingularityDriver) Setup(envVars []unversioned.EnvVar, fullCommands[][]string) error {
+func (d *SingularityDriver) Setup(envVars []unversioned.EnvVar, fullCommands [][]string) error {
 	logrus.Debug("Singularity driver does not support setup commands, since containers are read-only. Skipping commands.")
 	return nil
 }
@@ -58,31 +76,25 @@ func (d *SingularityDriver) Teardown(fullCommands [][]string) error {
 }
 
 func (d *SingularityDriver) SetEnv(envVars []unversioned.EnvVar) error {
-	env := d.processEnvVars(envVars)
-	// create a new instance with the passed environment variables
-	container, err := d.cli.NewInstance(d.currentImage, "testing-current", &singularity.EnvOptions{
-		EnvVars: convertSliceToMap(env),
-		AppendPath: []string{},
-		PrependPath: []string{},
-		ReplacePath: "",
-	})
-	if err != nil {
-		return errors.Wrap(err, "Error creating container")
+	// singularity reads the container environment from SINGULARITYENV_ vars in the
+	// environment of the calling process. rather than setting these globally, keep
+	// track of them here and pass them to each command we execute.
+	for k, v := range convertSliceToMap(d.processEnvVars(envVars)) {
+		d.env[k] = v
 	}
-	// stop current container
-	d.currentInstance.Stop()
-	// set current container to new env
-	d.currentInstance = container
 	return nil
 }
 
-func (d *SingularityDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string) (string, string, int, error) {
+func (d *SingularityDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCommand []string, stdin io.Reader) (string, string, int, error) {
 	var env []string
 	for _, envVar := range envVars {
 		env = append(env, fmt.Sprintf("%s=%s", envVar.Key, envVar.Value))
 	}
-	
-	stdout, stderr, exitCode, err := d.exec(env, fullCommand)
+
+	stdout, stderr, exitCode, err := d.exec(env, fullCommand, stdin)
+	if IsTimeout(err) {
+		return stdout, stderr, -1, err
+	}
 	if err != nil {
 		return "", "", -1, err
 	}
@@ -96,18 +108,46 @@ func (d *SingularityDriver) ProcessCommand(envVars []unversioned.EnvVar, fullCom
 	return stdout, stderr, exitCode, nil
 }
 
-func (d *SingularityDriver) exec(env []string, command []string) (string, string, int, error) {
-
+func (d *SingularityDriver) exec(env []string, command []string, stdin io.Reader) (string, string, int, error) {
 	d.currentInstance.Start()
 	defer d.currentInstance.Stop()
 
-	opts := singularity.DefaultExecOptions()
-	opts.Env = &singularity.EnvOptions{
-		EnvVars: convertSliceToMap(env),
+	args := append([]string{"exec", "--cleanenv", "instance://" + d.currentInstance.Name}, command...)
+	cmd := exec.Command("singularity", args...)
+	cmd.Env = os.Environ()
+	for k, v := range d.env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s_%s=%s", singularityEnvPrefix, k, v))
+	}
+	for k, v := range convertSliceToMap(env) {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s_%s=%s", singularityEnvPrefix, k, v))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if d.timeout > 0 {
+		setProcessGroup(cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return "", "", -1, errors.Wrap(err, "Error running command in instance")
 	}
 
-	stdout, stderr, code, err := d.currentInstance.Execute(command, opts)
-	return stdout, stderr, code, err
+	exitCode := 0
+	if err := waitCommand(cmd, d.timeout); err != nil {
+		if IsTimeout(err) {
+			// the instance is stopped on return, which takes anything left running with it
+			return stdout.String(), stderr.String(), -1, &TimeoutError{Command: command, Timeout: d.timeout}
+		}
+		exiterr, ok := err.(*exec.ExitError)
+		if !ok {
+			return "", "", -1, errors.Wrap(err, "Error running command in instance")
+		}
+		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			exitCode = status.ExitStatus()
+		}
+	}
+	return stdout.String(), stderr.String(), exitCode, nil
 }
 
 func (d *SingularityDriver) retrieveTar(target string) (*tar.Reader, func(), error) {
@@ -116,7 +156,7 @@ func (d *SingularityDriver) retrieveTar(target string) (*tar.Reader, func(), err
 	defer d.currentInstance.Stop()
 
 	t, read, err := d.currentInstance.CopyTarball(target)
-	cleanup := func(){
+	cleanup := func() {
 		os.RemoveAll(filepath.Dir(t))
 	}
 	if err != nil {
@@ -126,121 +166,116 @@ func (d *SingularityDriver) retrieveTar(target string) (*tar.Reader, func(), err
 	return read, cleanup, err
 }
 
-func (d *SingularityDriver) StatFile(path string) (os.FileInfo, error) {
+// Lstat describes a path without following a symlink in its last element.
+// tar resolves any symlinks in the parent directories within the container.
+func (d *SingularityDriver) Lstat(path string) (os.FileInfo, error) {
 	read, cleanup, err := d.retrieveTar(path)
 	defer cleanup()
 	if err != nil {
 		return nil, err
 	}
-	
-	for {
-		head, err := read.Next()
-		if err == io.EOF {
-			break
-		}
-
-		/*
-		* BEGIN FILE LOGIC HERE
-		* EVERYTHING ELSE IS BOILER PLATE
-		*/
-		switch head.Typeflag {
-		case tar.TypeDir, tar.TypeReg, tar.TypeLink, tar.TypeSymlink:
-			
-			if filepath.Clean(head.Name) == filepath.Base(path) {
-				return head.FileInfo(), nil
-			}
-		default:
-			continue
-		}
-		/*
-		 * END FILE LOGIC
-		 */
+	header, err := findEntry(read, path)
+	if err != nil {
+		return nil, err
 	}
+	return header.FileInfo(), nil
+}
 
-	return nil, fmt.Errorf("File %s not found in image", path)
+func (d *SingularityDriver) StatFile(path string) (os.FileInfo, error) {
+	return statFollowingLinks(d.Lstat, path)
 }
 
 func (d *SingularityDriver) ReadFile(path string) ([]byte, error) {
+	current := path
+	for links := 0; links <= maxSymlinks; links++ {
+		contents, target, err := d.readFile(current)
+		if err != nil || target == "" {
+			return contents, err
+		}
+		current = linkDestination(current, target)
+	}
+	return nil, tooManyLinks(path)
+}
+
+// readFile returns the contents of a file, or the target if it is a symlink.
+func (d *SingularityDriver) readFile(path string) ([]byte, string, error) {
 	read, cleanup, err := d.retrieveTar(path)
 	defer cleanup()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-
-	for {
-		head, err := read.Next()
-		if err == io.EOF {
-			break
-		}
-
-		/*
-		* BEGIN FILE LOGIC HERE
-		* EVERYTHING ELSE IS BOILER PLATE
-		*/
-		switch head.Typeflag {
-		case tar.TypeDir:
-			if filepath.Clean(head.Name) == filepath.Base(path) {
-				return nil, fmt.Errorf("Cannot read specified path: %s is a directory, not a file", path)
-			}
-		case tar.TypeSymlink:
-			return d.ReadFile(head.Linkname)
-		case tar.TypeReg, tar.TypeLink:
-			if filepath.Clean(head.Name) == filepath.Base(path) {
-				var b bytes.Buffer
-				stream := bufio.NewWriter(&b)
-				io.Copy(stream, read)
-				return b.Bytes(), nil
-			}
-		default:
-			continue
+	header, err := findEntry(read, path)
+	if err != nil {
+		return nil, "", err
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return nil, "", fmt.Errorf("Cannot read specified path: %s is a directory, not a file", path)
+	case tar.TypeSymlink:
+		return nil, header.Linkname, nil
+	case tar.TypeReg, tar.TypeLink:
+		var b bytes.Buffer
+		if _, err := b.ReadFrom(read); err != nil {
+			return nil, "", err
 		}
-		/*
-		 * END FILE LOGIC
-		 */
+		return b.Bytes(), "", nil
 	}
+	return nil, "", fmt.Errorf("Cannot read specified path: %s is not a regular file", path)
+}
 
-	return nil, fmt.Errorf("File %s not found in image", path)
+// OpenFile reads the whole file, since the archive singularity copies it out in
+// is read into memory anyway.
+func (d *SingularityDriver) OpenFile(path string) (io.ReadCloser, error) {
+	contents, err := d.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(contents)), nil
 }
 
-func (d *SingularityDriver) ReadDir(path string) ([]os.FileInfo, error) {
-	read, cleanup, err := d.retrieveTar(path)
+func (d *SingularityDriver) ReadDir(target string) ([]os.FileInfo, error) {
+	read, cleanup, err := d.retrieveTar(target)
 	defer cleanup()
 	if err != nil {
 		return nil, err
 	}
-	
-	var infos []os.FileInfo
-	for {
-		header, err := read.Next()
-		if err == io.EOF {
-			break
-		}
-		if header.Typeflag == tar.TypeDir {
-			// we only want top level dirs here, no recursion. to get these, remove
-			// trailing separator and split on separator. there should only be two parts.
-			parts := strings.Split(strings.TrimSuffix(header.Name, string(os.PathSeparator)), string(os.PathSeparator))
-			if len(parts) == 2 {
-				infos = append(infos, header.FileInfo())
-			}
-		}
-	}
+	// entry names start with the directory itself
+	return readTarDir(read, path.Dir(path.Clean("/"+target)), target)
+}
 
-	return infos, nil
+func (d *SingularityDriver) Walk(root string, fn filepath.WalkFunc) error {
+	read, cleanup, err := d.retrieveTar(root)
+	defer cleanup()
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return walkTar(read, path.Dir(path.Clean("/"+root)), root, fn)
 }
 
 func (d *SingularityDriver) GetConfig() (unversioned.Config, error) {
 	env := d.currentInstance.ImgEnvVars
 	labels := d.currentInstance.ImgLabels
 
-	return unversioned.Config{
-		Env: env,
-		Entrypoint: []string{},
-		Cmd: []string{},
-		Volumes: []string{},
-		Workdir: "",
+	config := unversioned.Config{
+		Env:          env,
+		Entrypoint:   []string{},
+		Cmd:          []string{},
+		Volumes:      []string{},
+		Workdir:      "",
 		ExposedPorts: []string{},
-		Labels: labels,
-	}, nil
+		Labels:       labels,
+		OS:           "linux",
+	}
+	// singularity can also run sandbox directories and remote images, which
+	// don't record their architecture or creation time
+	if image, err := sif.Open(d.originalImage); err == nil {
+		config.Architecture = image.Arch()
+		config.Created = image.Created()
+		image.Close()
+	} else {
+		logrus.Debugf("unable to read SIF header of %s: %s", d.originalImage, err)
+	}
+	return config, nil
 }
 
 func (d *SingularityDriver) Destroy() {
@@ -251,13 +286,10 @@ func (d *SingularityDriver) Destroy() {
 // that string when treated as a key in the image's environment.
 func retrieveSingularityEnv(d *SingularityDriver) func(string) string {
 	return func(envVar string) string {
-		var env map[string]string
-		if env == nil {
-			image := d.currentInstance
-			// convert env to map for processing
-			env = image.EnvOpts.EnvVars
+		if val, ok := d.env[envVar]; ok {
+			return val
 		}
-		return env[envVar]
+		return d.currentInstance.ImgEnvVars[envVar]
 	}
 }
 
@@ -281,4 +313,8 @@ func (d *SingularityDriver) processEnvVars(vars []unversioned.EnvVar) []string {
 		env = append(env, fmt.Sprintf("%s=%s", envVar.Key, expandedVal))
 	}
 	return env
-}
\ No newline at end of file
+}
+
+func (d *SingularityDriver) GetLayers() ([]unversioned.Layer, error) {
+	return nil, errors.New("Singularity images do not have layers")
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// the same limit as the linux kernel, after which a chain of symlinks is
+// assumed to be a loop
+const maxSymlinks = 40
+
+func tooManyLinks(p string) error {
+	return fmt.Errorf("too many levels of symbolic links resolving %s", p)
+}
+
+// LinkTarget returns the target of a symlink described by a file info from
+// Lstat or Walk.
+func LinkTarget(info os.FileInfo) (string, bool) {
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", false
+	}
+	header, ok := info.Sys().(*tar.Header)
+	if !ok {
+		return "", false
+	}
+	return header.Linkname, true
+}
+
+// linkDestination returns the path a symlink at p with the given target points to.
+// relative targets are relative to the directory containing the link.
+func linkDestination(p, target string) string {
+	if path.IsAbs(target) {
+		return path.Clean(target)
+	}
+	return path.Join(path.Dir(path.Clean("/"+p)), target)
+}
+
+// resolve returns the path p refers to once every symlink in it is followed,
+// treating the image root as the root directory, so neither absolute targets
+// nor .. can escape it. lstat is only ever called with paths whose parent
+// directories contain no symlinks.
+func resolve(lstat func(string) (os.FileInfo, error), p string) (string, error) {
+	resolved := "/"
+	parts := strings.Split(p, "/")
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, part)
+		info, err := lstat(next)
+		if err != nil {
+			return "", err
+		}
+		target, ok := LinkTarget(info)
+		if !ok {
+			resolved = next
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return "", tooManyLinks(p)
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return resolved, nil
+}
+
+// Resolve returns the path p refers to in the image once every symlink in it
+// is followed, failing if it doesn't exist or the symlinks form a loop.
+func Resolve(d Driver, p string) (string, error) {
+	return resolve(d.Lstat, p)
+}
+
+// statFollowingLinks follows symlinks in the last element of p, for drivers
+// whose lstat resolves the parent directories within the image itself.
+func statFollowingLinks(lstat func(string) (os.FileInfo, error), p string) (os.FileInfo, error) {
+	current := p
+	for links := 0; ; links++ {
+		info, err := lstat(current)
+		if err != nil {
+			return nil, err
+		}
+		target, ok := LinkTarget(info)
+		if !ok {
+			return info, nil
+		}
+		if links == maxSymlinks {
+			return nil, tooManyLinks(p)
+		}
+		current = linkDestination(current, target)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkgutil "github.com/GoogleContainerTools/container-diff/pkg/util"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+// fakeLstat describes a filesystem of directories, files and symlinks, where
+// the values are link targets, or empty for anything other than a symlink.
+func fakeLstat(fs map[string]string) func(string) (os.FileInfo, error) {
+	return func(p string) (os.FileInfo, error) {
+		target, ok := fs[p]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		header := &tar.Header{Name: p, Typeflag: tar.TypeDir, Mode: 0755}
+		if target != "" {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = target
+		}
+		return header.FileInfo(), nil
+	}
+}
+
+func TestResolve(t *testing.T) {
+	lstat := fakeLstat(map[string]string{
+		"/usr":               "",
+		"/usr/bin":           "",
+		"/usr/bin/python3.7": "",
+		"/usr/bin/python3":   "python3.7",
+		"/usr/bin/python":    "/usr/bin/python3",
+		"/bin":               "usr/bin",
+		"/usr/lib":           "",
+		"/usr/lib/escape":    "../../../../usr/bin",
+		"/usr/lib/loop":      "loop2",
+		"/usr/lib/loop2":     "/usr/lib/loop",
+		"/usr/lib/dangling":  "missing",
+		"/usr/lib/parent":    "..",
+	})
+	tables := []struct {
+		path     string
+		expected string
+		err      bool
+	}{
+		{path: "/usr/bin/python3.7", expected: "/usr/bin/python3.7"},
+		{path: "/usr/bin/python3", expected: "/usr/bin/python3.7"},
+		{path: "/usr/bin/python", expected: "/usr/bin/python3.7"},
+		{path: "/bin/python", expected: "/usr/bin/python3.7"},
+		{path: "usr/./bin/../bin/python3", expected: "/usr/bin/python3.7"},
+		{path: "/usr/lib/escape/python3", expected: "/usr/bin/python3.7"},
+		{path: "/usr/lib/parent/bin", expected: "/usr/bin"},
+		{path: "/", expected: "/"},
+		{path: "/usr/lib/loop", err: true},
+		{path: "/usr/lib/dangling", err: true},
+	}
+	for _, table := range tables {
+		resolved, err := resolve(lstat, table.path)
+		if table.err {
+			if err == nil {
+				t.Errorf("expected error resolving %s, got %s", table.path, resolved)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolving %s: %s", table.path, err)
+			continue
+		}
+		testutil.CheckDeepEqual(t, table.expected, resolved)
+	}
+}
+
+func TestStatFollowingLinks(t *testing.T) {
+	lstat := fakeLstat(map[string]string{
+		"/usr/bin/python3.7": "",
+		"/usr/bin/python3":   "python3.7",
+		"/usr/bin/python":    "/usr/bin/python3",
+		"/usr/lib/loop":      "../lib/loop",
+	})
+	info, err := statFollowingLinks(lstat, "/usr/bin/python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "python3.7", info.Name())
+	if _, err := statFollowingLinks(lstat, "/usr/lib/loop"); err == nil {
+		t.Errorf("expected error following a symlink loop")
+	}
+}
+
+func TestTarDriverSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "etc"), 0755)
+	os.MkdirAll(filepath.Join(dir, "config"), 0755)
+	if err := ioutil.WriteFile(filepath.Join(dir, "etc", "hostname"), []byte("image\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// absolute targets are within the image, not the host running the tests
+	os.Symlink("/etc/hostname", filepath.Join(dir, "config", "hostname"))
+	os.Symlink("/etc", filepath.Join(dir, "config", "etc"))
+
+	driver := &TarDriver{Image: pkgutil.Image{FSPath: dir}}
+	contents, err := driver.ReadFile("/config/hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "image\n", string(contents))
+	contents, err = driver.ReadFile("/config/etc/hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "image\n", string(contents))
+
+	info, err := driver.Lstat("/config/etc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, ok := LinkTarget(info)
+	testutil.CheckDeepEqual(t, true, ok)
+	testutil.CheckDeepEqual(t, "/etc", target)
+
+	info, err = driver.StatFile("/config/etc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, true, info.IsDir())
+}
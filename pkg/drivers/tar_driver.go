@@ -15,10 +15,13 @@
 package drivers
 
 import (
+	"archive/tar"
+	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -34,10 +37,30 @@ type TarDriver struct {
 	Save  bool
 }
 
+// container-diff tracks hardlinks in a package level map while unpacking
+// image filesystems, so extraction must not happen concurrently.
+var extractLock sync.Mutex
+
+func getImageForName(name string) (pkgutil.Image, error) {
+	extractLock.Lock()
+	defer extractLock.Unlock()
+	return pkgutil.GetImageForName(name)
+}
+
 func NewTarDriver(args DriverConfig) (Driver, error) {
+	if IsOCILayout(args.Image) {
+		image, err := getOCIImage(args.Image, args.Platform)
+		if err != nil {
+			return nil, errors.Wrap(err, "processing OCI image layout")
+		}
+		return &TarDriver{
+			Image: image,
+			Save:  args.Save,
+		}, nil
+	}
 	if pkgutil.IsTar(args.Image) {
 		// tar provided, so don't provide any prefix. container-diff can figure this out.
-		image, err := pkgutil.GetImageForName(args.Image)
+		image, err := getImageForName(args.Image)
 		if err != nil {
 			return nil, errors.Wrap(err, "processing tar image reference")
 		}
@@ -47,7 +70,7 @@ func NewTarDriver(args DriverConfig) (Driver, error) {
 		}, nil
 	}
 	// try the local docker daemon first
-	image, err := pkgutil.GetImageForName("daemon://" + args.Image)
+	image, err := getImageForName("daemon://" + args.Image)
 	if err == nil {
 		logrus.Debugf("image found in local docker daemon")
 		return &TarDriver{
@@ -58,7 +81,7 @@ func NewTarDriver(args DriverConfig) (Driver, error) {
 
 	// image not found in local daemon, so try remote.
 	logrus.Infof("unable to retrieve image locally: %s", err)
-	image, err = pkgutil.GetImageForName("remote://" + args.Image)
+	image, err = getImageForName("remote://" + args.Image)
 	if err != nil {
 		return nil, errors.Wrap(err, "retrieving image")
 	}
@@ -133,21 +156,78 @@ func (d *TarDriver) Teardown(_ [][]string) error {
 	return errors.New("Tar driver is unable to process commands, please use a different driver")
 }
 
-func (d *TarDriver) ProcessCommand(_ []unversioned.EnvVar, _ []string) (string, string, int, error) {
+func (d *TarDriver) ProcessCommand(_ []unversioned.EnvVar, _ []string, _ io.Reader) (string, string, int, error) {
 	// this driver is unable to process commands, inform user and fail.
 	return "", "", -1, errors.New("Tar driver is unable to process commands, please use a different driver")
 }
 
+// lstat describes a path in the unpacked filesystem, which must not have
+// symlinks in its parent directories, as those would be resolved on the host.
+func (d *TarDriver) lstat(path string) (os.FileInfo, error) {
+	info, err := os.Lstat(filepath.Join(d.Image.FSPath, path))
+	if err != nil {
+		return nil, err
+	}
+	return hostFileInfo(filepath.Join(d.Image.FSPath, path), info)
+}
+
+// hostPath returns the location of a path in the unpacked filesystem, with
+// symlinks resolved within the image so that they can't point outside of it.
+func (d *TarDriver) hostPath(path string) (string, error) {
+	resolved, err := resolve(d.lstat, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d.Image.FSPath, resolved), nil
+}
+
 func (d *TarDriver) StatFile(path string) (os.FileInfo, error) {
-	return os.Stat(filepath.Join(d.Image.FSPath, path))
+	p, err := d.hostPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(p)
+}
+
+func (d *TarDriver) Lstat(name string) (os.FileInfo, error) {
+	name = path.Clean("/" + name)
+	dir, err := resolve(d.lstat, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	return d.lstat(path.Join(dir, path.Base(name)))
 }
 
 func (d *TarDriver) ReadFile(path string) ([]byte, error) {
-	return ioutil.ReadFile(filepath.Join(d.Image.FSPath, path))
+	p, err := d.hostPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+func (d *TarDriver) OpenFile(path string) (io.ReadCloser, error) {
+	p, err := d.hostPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
 }
 
 func (d *TarDriver) ReadDir(path string) ([]os.FileInfo, error) {
-	return ioutil.ReadDir(filepath.Join(d.Image.FSPath, path))
+	p, err := d.hostPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadDir(p)
+}
+
+// Walk reads the image layers rather than the unpacked filesystem, since
+// unpacking doesn't preserve ownership or extended attributes.
+func (d *TarDriver) Walk(root string, fn filepath.WalkFunc) error {
+	rc := flatten(d.Image.Image)
+	defer rc.Close()
+	return walkTar(tar.NewReader(rc), "/", root, fn)
 }
 
 func (d *TarDriver) GetConfig() (unversioned.Config, error) {
@@ -155,28 +235,13 @@ func (d *TarDriver) GetConfig() (unversioned.Config, error) {
 	if err != nil {
 		return unversioned.Config{}, errors.Wrap(err, "retrieving config file")
 	}
-	config := configFile.Config
-
-	// docker provides these as maps (since they can be mapped in docker run commands)
-	// since this will never be the case when built through a dockerfile, we convert to list of strings
-	volumes := []string{}
-	for v := range config.Volumes {
-		volumes = append(volumes, v)
-	}
-
-	ports := []string{}
-	for p := range config.ExposedPorts {
-		// docker always appends the protocol to the port, so this is safe
-		ports = append(ports, strings.Split(p, "/")[0])
+	rawConfig, err := d.Image.Image.RawConfigFile()
+	if err != nil {
+		return unversioned.Config{}, errors.Wrap(err, "retrieving config file")
 	}
+	return convertConfigFile(configFile, rawConfig)
+}
 
-	return unversioned.Config{
-		Env:          convertSliceToMap(config.Env),
-		Entrypoint:   config.Entrypoint,
-		Cmd:          config.Cmd,
-		Volumes:      volumes,
-		Workdir:      config.WorkingDir,
-		ExposedPorts: ports,
-		Labels:       config.Labels,
-	}, nil
+func (d *TarDriver) GetLayers() ([]unversioned.Layer, error) {
+	return imageLayers(d.Image.Image)
 }
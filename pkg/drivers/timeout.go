@@ -0,0 +1,73 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimeoutError is returned when a command is killed for running longer than
+// the timeout the driver was configured with.
+type TimeoutError struct {
+	Command []string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("command '%s' timed out after %s", strings.Join(e.Command, " "), e.Timeout)
+}
+
+// IsTimeout returns whether the error was caused by a command timing out.
+func IsTimeout(err error) bool {
+	_, ok := errors.Cause(err).(*TimeoutError)
+	return ok
+}
+
+// afterTimeout calls kill once the timeout has passed, unless the returned stop func
+// is called first. stop reports whether kill was called. a timeout of 0 never fires.
+func afterTimeout(timeout time.Duration, kill func()) func() bool {
+	if timeout <= 0 {
+		return func() bool { return false }
+	}
+	var fired int32
+	timer := time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&fired, 1)
+		kill()
+	})
+	return func() bool {
+		timer.Stop()
+		return atomic.LoadInt32(&fired) == 1
+	}
+}
+
+// waitCommand waits for a started command, killing it along with any processes
+// it started if it runs for longer than the timeout. commands that can time out
+// should be started in their own process group with setProcessGroup.
+func waitCommand(cmd *exec.Cmd, timeout time.Duration) error {
+	stop := afterTimeout(timeout, func() {
+		killProcessGroup(cmd)
+	})
+	err := cmd.Wait()
+	if stop() {
+		return &TimeoutError{Command: cmd.Args, Timeout: timeout}
+	}
+	return err
+}
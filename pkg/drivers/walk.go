@@ -0,0 +1,158 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// walkTar walks the entries of a tar stream under root in the same order as
+// filepath.Walk, with file infos backed by the entries' tar headers. entry
+// names are relative to dir. the root itself is synthesized as a directory if
+// the stream only holds its contents.
+func walkTar(tr *tar.Reader, dir, root string, fn filepath.WalkFunc) error {
+	root = path.Clean("/" + root)
+	headers := map[string]*tar.Header{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading tar")
+		}
+		p := path.Join(dir, cleanLayerPath(header.Name))
+		if p != root && !within(p, root) {
+			continue
+		}
+		// tar streams can restate paths, the last entry wins
+		header.Name = p
+		headers[p] = header
+	}
+	if _, ok := headers[root]; !ok {
+		if len(headers) == 0 {
+			return fn(root, nil, &os.PathError{Op: "lstat", Path: root, Err: os.ErrNotExist})
+		}
+		headers[root] = &tar.Header{Name: root, Typeflag: tar.TypeDir, Mode: 0755}
+	}
+	return walkHeaders(headers, fn)
+}
+
+// readTarDir returns the direct children of target in a tar stream, with file
+// infos backed by the entries' tar headers. entry names are relative to dir.
+func readTarDir(tr *tar.Reader, dir, target string) ([]os.FileInfo, error) {
+	target = path.Clean("/" + target)
+	var infos []os.FileInfo
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading tar")
+		}
+		if p := path.Join(dir, cleanLayerPath(header.Name)); p != target && path.Dir(p) == target {
+			infos = append(infos, header.FileInfo())
+		}
+	}
+	return infos, nil
+}
+
+// walkHeaders calls fn for every header, ordered so that each directory is
+// followed by its contents sorted by name, honoring filepath.SkipDir.
+func walkHeaders(headers map[string]*tar.Header, fn filepath.WalkFunc) error {
+	paths := make([]string, 0, len(headers))
+	for p := range headers {
+		paths = append(paths, p)
+	}
+	// compare paths element by element, so /etc/passwd sorts before /etc-old
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Replace(paths[i], "/", "\x00", -1) < strings.Replace(paths[j], "/", "\x00", -1)
+	})
+	var skipped []string
+	for _, p := range paths {
+		skip := false
+		for _, s := range skipped {
+			if within(p, s) {
+				skip = true
+				break
+			}
+		}
+		if skip {
+			continue
+		}
+		info := headers[p].FileInfo()
+		if err := fn(p, info, nil); err != nil {
+			if err != filepath.SkipDir {
+				return err
+			}
+			if info.IsDir() {
+				skipped = append(skipped, p)
+			} else {
+				// skip the rest of the containing directory
+				skipped = append(skipped, path.Dir(p))
+			}
+		}
+	}
+	return nil
+}
+
+// hostFileInfo converts a file info from the local filesystem into one backed
+// by a tar header, so that ownership, link targets and extended attributes are
+// exposed the same way as in the other drivers.
+func hostFileInfo(p string, info os.FileInfo) (os.FileInfo, error) {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(p); err != nil {
+			return nil, err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = p
+	if link == "" {
+		// filesystems without extended attribute support just have none
+		attrs, _ := readXattrs(p)
+		for k, v := range attrs {
+			if header.PAXRecords == nil {
+				header.PAXRecords = map[string]string{}
+			}
+			header.PAXRecords[paxXattrPrefix+k] = v
+		}
+	}
+	return header.FileInfo(), nil
+}
+
+// walkHost walks the local filesystem, converting file infos with hostFileInfo.
+func walkHost(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fn(p, info, err)
+		}
+		info, err = hostFileInfo(p, info)
+		return fn(p, info, err)
+	})
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkgutil "github.com/GoogleContainerTools/container-diff/pkg/util"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func walkTestTar(t *testing.T, headers ...*tar.Header) *tar.Reader {
+	t.Helper()
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, h := range headers {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	return tar.NewReader(&b)
+}
+
+func testTreeHeaders() []*tar.Header {
+	return []*tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "etc/ssl/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "etc/ssl/cert.pem", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "etc-old/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644, Uid: 1, Gid: 2},
+		{Name: "etc/localtime", Typeflag: tar.TypeSymlink, Linkname: "/usr/share/zoneinfo/UTC", Mode: 0777},
+	}
+}
+
+func TestWalkTar(t *testing.T) {
+	var paths []string
+	err := walkTar(walkTestTar(t, testTreeHeaders()...), "/", "/etc", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		header := info.Sys().(*tar.Header)
+		switch p {
+		case "/etc/passwd":
+			testutil.CheckDeepEqual(t, 1, header.Uid)
+			testutil.CheckDeepEqual(t, 2, header.Gid)
+		case "/etc/localtime":
+			testutil.CheckDeepEqual(t, "/usr/share/zoneinfo/UTC", header.Linkname)
+			testutil.CheckDeepEqual(t, os.ModeSymlink, info.Mode()&os.ModeSymlink)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []string{"/etc", "/etc/localtime", "/etc/passwd", "/etc/ssl", "/etc/ssl/cert.pem"}, paths)
+}
+
+func TestWalkTarSkipDir(t *testing.T) {
+	var paths []string
+	err := walkTar(walkTestTar(t, testTreeHeaders()...), "/", "/", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		if p == "/etc/ssl" || p == "/etc/localtime" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the root is synthesized, and skipping a file skips the rest of its directory
+	testutil.CheckDeepEqual(t, []string{"/", "/etc", "/etc/localtime", "/etc-old"}, paths)
+}
+
+func TestWalkTarMissingRoot(t *testing.T) {
+	err := walkTar(walkTestTar(t, testTreeHeaders()...), "/", "/var", func(p string, info os.FileInfo, err error) error {
+		return err
+	})
+	if !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestReadTarDir(t *testing.T) {
+	infos, err := readTarDir(walkTestTar(t, testTreeHeaders()...), "/", "/etc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	// regular files and symlinks too, but not the contents of subdirectories
+	testutil.CheckDeepEqual(t, []string{"ssl", "passwd", "localtime"}, names)
+}
+
+func TestReadTarDirTruncated(t *testing.T) {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	tw.WriteHeader(&tar.Header{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 100})
+	tw.Write(make([]byte, 100))
+	tw.Close()
+	if _, err := readTarDir(tar.NewReader(bytes.NewReader(b.Bytes()[:600])), "/", "/etc"); err == nil {
+		t.Error("expected error reading truncated tar")
+	}
+}
+
+func TestWalkHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	err = walkHost(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		header, ok := info.Sys().(*tar.Header)
+		if !ok {
+			t.Fatalf("expected tar header for %s", p)
+		}
+		if p == filepath.Join(dir, "link") {
+			testutil.CheckDeepEqual(t, "file", header.Linkname)
+		}
+		testutil.CheckDeepEqual(t, os.Getuid(), header.Uid)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, []string{dir, filepath.Join(dir, "file"), filepath.Join(dir, "link")}, paths)
+}
+
+func TestTarDriverWalk(t *testing.T) {
+	dir := newTestLayout(t)
+	defer os.RemoveAll(dir)
+
+	img, err := OCIImageFromLayout("oci:"+dir, "linux/amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := &TarDriver{Image: pkgutil.Image{Image: img}}
+	var paths []string
+	if err := driver.Walk("/", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// whiteouts are applied, as when the image is unpacked
+	testutil.CheckDeepEqual(t, []string{"/", "/etc", "/etc/config", "/opaque", "/opaque/new"}, paths)
+}
+
+func TestWalkTarXattrs(t *testing.T) {
+	capability := "\x01\x00\x00\x02\x00\x04\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	tr := walkTestTar(t, &tar.Header{
+		Name:       "bin/server",
+		Typeflag:   tar.TypeReg,
+		Mode:       0755,
+		PAXRecords: map[string]string{"SCHILY.xattr.security.capability": capability, "mtime": "1"},
+	})
+	var attrs map[string]string
+	if err := walkTar(tr, "/", "/bin/server", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		attrs = Xattrs(info)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, map[string]string{"security.capability": capability}, attrs)
+}
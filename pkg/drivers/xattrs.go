@@ -0,0 +1,66 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extended attributes are stored in tar headers as PAX records with this prefix
+const paxXattrPrefix = "SCHILY.xattr."
+
+// Xattrs returns the extended attributes of a path from the tar header backing
+// its file info.
+func Xattrs(info os.FileInfo) map[string]string {
+	attrs := map[string]string{}
+	header, ok := info.Sys().(*tar.Header)
+	if !ok {
+		return attrs
+	}
+	for k, v := range header.PAXRecords {
+		if strings.HasPrefix(k, paxXattrPrefix) {
+			attrs[strings.TrimPrefix(k, paxXattrPrefix)] = v
+		}
+	}
+	return attrs
+}
+
+// FullInfo describes a path after following symlinks, using Walk rather than
+// StatFile, since only Walk returns the extended attributes of the path.
+func FullInfo(d Driver, p string) (os.FileInfo, error) {
+	resolved, err := Resolve(d, p)
+	if err != nil {
+		return nil, err
+	}
+	var info os.FileInfo
+	if err := d.Walk(resolved, func(_ string, i os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		info = i
+		// only the path itself is needed, not its contents
+		return filepath.SkipDir
+	}); err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, fmt.Errorf("File %s not found in image", p)
+	}
+	return info, nil
+}
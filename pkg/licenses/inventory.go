@@ -0,0 +1,200 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package licenses
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/packages"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+// supported inventory formats
+const (
+	CSV  = "csv"
+	SPDX = "spdx"
+)
+
+var Formats = []string{CSV, SPDX}
+
+// Entry is a Debian package along with the licenses detected in its copyright file.
+type Entry struct {
+	Package       string
+	Version       string   // empty if the package isn't in the dpkg database
+	Licenses      []string // empty if the copyright file is missing or not machine readable
+	CopyrightFile string   // empty if the package has no copyright file
+}
+
+// Inventory lists the Debian packages in the image, from both the dpkg database
+// and the copyright files under utils.DebianRoot, sorted by name.
+func Inventory(r packages.FileReader) ([]Entry, error) {
+	entries := map[string]*Entry{}
+	_, pkgs, err := packages.List(r, packages.Dpkg)
+	if err != nil {
+		// images without dpkg can still ship copyright files
+		logrus.Warnf("unable to read package versions: %s", err)
+	}
+	for _, p := range pkgs {
+		entries[p.Name] = &Entry{Package: p.Name, Version: p.Version}
+	}
+
+	dirs, err := r.ReadDir(utils.DebianRoot)
+	if err != nil && len(entries) == 0 {
+		return nil, errors.Wrap(err, "reading copyright files")
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		copyrightFile := path.Join(utils.DebianRoot, dir.Name(), utils.LicenseFile)
+		contents, err := r.ReadFile(copyrightFile)
+		if err != nil {
+			continue
+		}
+		e, ok := entries[dir.Name()]
+		if !ok {
+			e = &Entry{Package: dir.Name()}
+			entries[dir.Name()] = e
+		}
+		e.CopyrightFile = copyrightFile
+		e.Licenses, _ = Detect(contents)
+	}
+
+	var res []Entry
+	for _, e := range entries {
+		res = append(res, *e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Package < res[j].Package
+	})
+	return res, nil
+}
+
+// WriteCSV writes the inventory as CSV, with a header row. multiple licenses
+// are separated by semicolons.
+func WriteCSV(out io.Writer, entries []Entry) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"package", "version", "licenses", "copyright_file"})
+	for _, e := range entries {
+		w.Write([]string{e.Package, e.Version, strings.Join(e.Licenses, ";"), e.CopyrightFile})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+type spdxDocument struct {
+	SPDXVersion       string           `json:"spdxVersion"`
+	DataLicense       string           `json:"dataLicense"`
+	SPDXID            string           `json:"SPDXID"`
+	Name              string           `json:"name"`
+	DocumentNamespace string           `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo `json:"creationInfo"`
+	Packages          []spdxPackage    `json:"packages"`
+	ExtractedLicenses []spdxLicense    `json:"hasExtractedLicensingInfos,omitempty"`
+}
+
+// spdxLicense describes a license that isn't on the SPDX license list.
+type spdxLicense struct {
+	LicenseID     string `json:"licenseId"`
+	Name          string `json:"name"`
+	ExtractedText string `json:"extractedText"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string `json:"SPDXID"`
+	Name             string `json:"name"`
+	VersionInfo      string `json:"versionInfo,omitempty"`
+	DownloadLocation string `json:"downloadLocation"`
+	FilesAnalyzed    bool   `json:"filesAnalyzed"`
+	LicenseConcluded string `json:"licenseConcluded"`
+	LicenseDeclared  string `json:"licenseDeclared"`
+	CopyrightText    string `json:"copyrightText"`
+	SourceInfo       string `json:"sourceInfo,omitempty"`
+}
+
+const noAssertion = "NOASSERTION"
+
+// WriteSPDX writes the inventory as an SPDX JSON document describing the image.
+// the Debian short names from the copyright files are converted to SPDX license
+// identifiers, and licenses not on the SPDX license list are declared as
+// LicenseRefs.
+func WriteSPDX(out io.Writer, entries []Entry, image string, tool string, created time.Time) error {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.2",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              image,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%d", strings.NewReplacer("/", "-", ":", "-", "@", "-").Replace(image), created.Unix()),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + tool},
+		},
+		Packages: []spdxPackage{},
+	}
+	extracted := map[string]bool{}
+	for i, e := range entries {
+		declared := noAssertion
+		if len(e.Licenses) > 0 {
+			var ids []string
+			for _, l := range e.Licenses {
+				id, listed := SPDXLicense(l)
+				ids = append(ids, id)
+				if !listed && !extracted[id] {
+					extracted[id] = true
+					doc.ExtractedLicenses = append(doc.ExtractedLicenses, spdxLicense{
+						LicenseID:     id,
+						Name:          l,
+						ExtractedText: fmt.Sprintf("The %s license, as named in the Debian copyright file %s", l, e.CopyrightFile),
+					})
+				}
+			}
+			declared = strings.Join(ids, " AND ")
+		}
+		p := spdxPackage{
+			SPDXID:           fmt.Sprintf("SPDXRef-Package-%d", i+1),
+			Name:             e.Package,
+			VersionInfo:      e.Version,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  declared,
+			CopyrightText:    noAssertion,
+		}
+		if e.CopyrightFile != "" {
+			p.SourceInfo = "licenses detected from " + e.CopyrightFile
+		}
+		doc.Packages = append(doc.Packages, p)
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling SPDX document")
+	}
+	_, err = out.Write(append(b, '\n'))
+	return err
+}
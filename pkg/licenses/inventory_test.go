@@ -0,0 +1,131 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package licenses
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/packages/packagestest"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+const dpkgStatus = `Package: libc6
+Status: install ok installed
+Version: 2.24-11+deb9u4
+
+Package: tzdata
+Status: install ok installed
+Version: 2019c-0+deb9u1
+`
+
+func testInventory() []Entry {
+	return []Entry{
+		{Package: "base-files", Licenses: []string{"GPL"}, CopyrightFile: "/usr/share/doc/base-files/copyright"},
+		{Package: "libc6", Version: "2.24-11+deb9u4", Licenses: []string{"BSD-3-clause", "Expat", "GPL-2+", "LGPL-2.1"}, CopyrightFile: "/usr/share/doc/libc6/copyright"},
+		{Package: "tzdata", Version: "2019c-0+deb9u1"},
+	}
+}
+
+func TestInventory(t *testing.T) {
+	fs := packagestest.FS{
+		"/var/lib/dpkg/status":                dpkgStatus,
+		"/usr/share/doc/libc6/copyright":      machineReadable,
+		"/usr/share/doc/libc6/changelog.gz":   "",
+		"/usr/share/doc/base-files/copyright": "Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/\n\nFiles: *\nLicense: GPL\n",
+		"/usr/share/doc/tzdata/README":        "",
+	}
+	entries, err := Inventory(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, testInventory(), entries)
+
+	if _, err := Inventory(packagestest.FS{}); err == nil {
+		t.Errorf("expected error for an image without packages")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, testInventory()); err != nil {
+		t.Fatal(err)
+	}
+	expected := `package,version,licenses,copyright_file
+base-files,,GPL,/usr/share/doc/base-files/copyright
+libc6,2.24-11+deb9u4,BSD-3-clause;Expat;GPL-2+;LGPL-2.1,/usr/share/doc/libc6/copyright
+tzdata,2019c-0+deb9u1,,
+`
+	testutil.CheckDeepEqual(t, expected, buf.String())
+}
+
+func TestWriteSPDX(t *testing.T) {
+	var buf bytes.Buffer
+	created := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	entries := testInventory()
+	entries[1].Licenses = append(entries[1].Licenses, "public-domain")
+	if err := WriteSPDX(&buf, entries, "gcr.io/distroless/base:latest", "container-structure-test-v1.8.0", created); err != nil {
+		t.Fatal(err)
+	}
+	var doc spdxDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "https://spdx.org/spdxdocs/gcr.io-distroless-base-latest-1569931200", doc.DocumentNamespace)
+	testutil.CheckDeepEqual(t, "2019-10-01T12:00:00Z", doc.CreationInfo.Created)
+	testutil.CheckDeepEqual(t, []string{"Tool: container-structure-test-v1.8.0"}, doc.CreationInfo.Creators)
+	if len(doc.Packages) != 3 {
+		t.Fatalf("expected 3 packages, got %d", len(doc.Packages))
+	}
+	testutil.CheckDeepEqual(t, "GPL-1.0-or-later", doc.Packages[0].LicenseDeclared)
+	testutil.CheckDeepEqual(t, "BSD-3-Clause AND MIT AND GPL-2.0-or-later AND LGPL-2.1-only AND LicenseRef-public-domain", doc.Packages[1].LicenseDeclared)
+	testutil.CheckDeepEqual(t, "2.24-11+deb9u4", doc.Packages[1].VersionInfo)
+	testutil.CheckDeepEqual(t, "licenses detected from /usr/share/doc/libc6/copyright", doc.Packages[1].SourceInfo)
+	testutil.CheckDeepEqual(t, "NOASSERTION", doc.Packages[2].LicenseDeclared)
+	testutil.CheckDeepEqual(t, "", doc.Packages[2].SourceInfo)
+	testutil.CheckDeepEqual(t, []spdxLicense{{
+		LicenseID:     "LicenseRef-public-domain",
+		Name:          "public-domain",
+		ExtractedText: "The public-domain license, as named in the Debian copyright file /usr/share/doc/libc6/copyright",
+	}}, doc.ExtractedLicenses)
+}
+
+func TestSPDXLicense(t *testing.T) {
+	tables := []struct {
+		license  string
+		expected string
+		listed   bool
+	}{
+		{"GPL-2+", "GPL-2.0-or-later", true},
+		{"GPL-2", "GPL-2.0-only", true},
+		{"LGPL-2.1+", "LGPL-2.1-or-later", true},
+		{"lgpl-3", "LGPL-3.0-only", true},
+		{"GPL", "GPL-1.0-or-later", true},
+		{"GFDL-1.3+", "GFDL-1.3-or-later", true},
+		{"Expat", "MIT", true},
+		{"BSD-3-clause", "BSD-3-Clause", true},
+		{"Apache-2.0", "Apache-2.0", true},
+		{"MPL-1.1+", "MPL-1.1+", true},
+		{"public-domain", "LicenseRef-public-domain", false},
+		{"Unicode data files", "LicenseRef-Unicode-data-files", false},
+	}
+	for _, table := range tables {
+		id, listed := SPDXLicense(table.license)
+		testutil.CheckDeepEqual(t, table.expected, id)
+		testutil.CheckDeepEqual(t, table.listed, listed)
+	}
+}
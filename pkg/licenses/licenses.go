@@ -0,0 +1,100 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package licenses detects the licenses declared in copyright files.
+package licenses
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// separates the licenses in a license expression, e.g. "GPL-2+ or Artistic"
+	expressionSeparator = regexp.MustCompile(`(?i)\s+(or|and)\s+|\s*[,|&]\s*`)
+	// exceptions to a license, e.g. "GPL-2+ with OpenSSL exception"
+	licenseException = regexp.MustCompile(`(?i)\s+with\s+.*$`)
+)
+
+// Detect returns the licenses declared by the License fields of a Debian machine
+// readable copyright file, sorted and without duplicates. the second return value
+// is false if the file isn't machine readable, in which case no licenses are detected.
+func Detect(copyright []byte) ([]string, bool) {
+	lines := strings.Split(strings.Replace(string(copyright), "\r\n", "\n", -1), "\n")
+	machineReadable := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		// the first field of a machine readable file is the format URL
+		machineReadable = strings.HasPrefix(line, "Format:") &&
+			(strings.Contains(line, "copyright-format") || strings.Contains(line, "dep5"))
+		break
+	}
+	if !machineReadable {
+		return nil, false
+	}
+
+	seen := map[string]bool{}
+	for _, line := range lines {
+		// only the first line of a License field holds the expression, the rest is license text
+		if !strings.HasPrefix(line, "License:") {
+			continue
+		}
+		expression := strings.TrimSpace(strings.TrimPrefix(line, "License:"))
+		for _, id := range ParseExpression(expression) {
+			seen[id] = true
+		}
+	}
+	ids := []string{}
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, true
+}
+
+// ParseExpression splits a license expression into the licenses it names,
+// dropping any exceptions.
+func ParseExpression(expression string) []string {
+	var ids []string
+	for _, part := range expressionSeparator.Split(expression, -1) {
+		part = strings.Trim(part, " ()")
+		part = licenseException.ReplaceAllString(part, "")
+		part = strings.Trim(part, " ()")
+		if part != "" {
+			ids = append(ids, part)
+		}
+	}
+	return ids
+}
+
+// Matches returns whether a license matches an entry of a license policy. matching
+// is case insensitive, and an entry also matches versions of the license, so GPL
+// matches GPL-2 and GPL-3+, and GPL-2 matches GPL-2+ and GPL-2.0, but not LGPL-2.
+func Matches(license, entry string) bool {
+	license, entry = strings.ToLower(license), strings.ToLower(entry)
+	if license == entry {
+		return true
+	}
+	if !strings.HasPrefix(license, entry) {
+		return false
+	}
+	switch license[len(entry)] {
+	case '-', '+', '.':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package licenses
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+const machineReadable = `Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: example
+
+Files: *
+Copyright: 2019 Someone
+License: GPL-2+ with OpenSSL exception
+
+Files: lib/*
+License: LGPL-2.1 or (BSD-3-clause, Expat)
+
+License: GPL-2+
+ This program is free software; unlike the AGPL, this text is not a License: field.
+`
+
+func TestDetect(t *testing.T) {
+	ids, ok := Detect([]byte(machineReadable))
+	if !ok {
+		t.Fatal("expected copyright file to be machine readable")
+	}
+	testutil.CheckDeepEqual(t, []string{"BSD-3-clause", "Expat", "GPL-2+", "LGPL-2.1"}, ids)
+
+	ids, ok = Detect([]byte("This package is licensed under the AGPL.\n"))
+	if ok {
+		t.Errorf("expected free form copyright file not to be machine readable")
+	}
+	testutil.CheckDeepEqual(t, []string(nil), ids)
+}
+
+func TestMatches(t *testing.T) {
+	tables := []struct {
+		license string
+		entry   string
+		matches bool
+	}{
+		{"GPL-2", "GPL-2", true},
+		{"gpl-2", "GPL-2", true},
+		{"GPL-2+", "GPL", true},
+		{"GPL-2.0", "GPL-2", true},
+		{"GPL-3", "GPL-2", false},
+		{"LGPL-2", "GPL", false},
+		{"AGPL-3", "GPL", false},
+		{"GPLv2", "GPL", false},
+	}
+
+	for _, table := range tables {
+		if Matches(table.license, table.entry) != table.matches {
+			t.Errorf("expected %s matching %s to be %t", table.license, table.entry, table.matches)
+		}
+	}
+}
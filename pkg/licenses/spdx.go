@@ -0,0 +1,89 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package licenses
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// the GNU licenses are versioned as GPL-2 and GPL-2+ by Debian, and as
+	// GPL-2.0-only and GPL-2.0-or-later by SPDX
+	gnuLicense = regexp.MustCompile(`(?i)^(GPL|LGPL|AGPL|GFDL)(?:-(\d+(?:\.\d+)?))?(\+)?$`)
+	// the version a GNU license without one refers to, which is any version
+	gnuFirstVersion = map[string]string{"GPL": "1.0", "LGPL": "2.0", "AGPL": "3.0", "GFDL": "1.1"}
+
+	// SPDX identifiers of the other licenses with a Debian short name, see
+	// https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/#license-short-name
+	spdxIDs = map[string]string{}
+	// Debian short names that differ from the SPDX identifier
+	debianAliases = map[string]string{
+		"expat":    "MIT",
+		"artistic": "Artistic-1.0-Perl",
+		"psf-2":    "PSF-2.0",
+		"zope-2.1": "ZPL-2.1",
+	}
+	// characters not allowed in a LicenseRef
+	licenseRefInvalid = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+)
+
+func init() {
+	for _, id := range []string{
+		"Apache-1.0", "Apache-1.1", "Apache-2.0", "Artistic-1.0", "Artistic-2.0",
+		"BSD-2-Clause", "BSD-3-Clause", "BSD-4-Clause", "BSL-1.0",
+		"CC-BY-1.0", "CC-BY-2.0", "CC-BY-2.5", "CC-BY-3.0", "CC-BY-4.0",
+		"CC-BY-SA-1.0", "CC-BY-SA-2.0", "CC-BY-SA-2.5", "CC-BY-SA-3.0", "CC-BY-SA-4.0", "CC0-1.0",
+		"CDDL-1.0", "CDDL-1.1", "EPL-1.0", "EPL-2.0", "ISC", "LPPL-1.3c", "MIT",
+		"MPL-1.0", "MPL-1.1", "MPL-2.0", "OpenSSL", "Python-2.0", "Unlicense", "WTFPL",
+		"X11", "Zlib", "ZPL-2.1",
+	} {
+		spdxIDs[strings.ToLower(id)] = id
+	}
+	for name, id := range debianAliases {
+		spdxIDs[name] = id
+	}
+}
+
+// SPDXLicense returns the SPDX license identifier for a Debian license short
+// name, e.g. GPL-2.0-or-later for GPL-2+. the second return value is false if
+// the license isn't on the SPDX license list, in which case a LicenseRef
+// identifier is returned.
+func SPDXLicense(license string) (string, bool) {
+	if m := gnuLicense.FindStringSubmatch(license); m != nil {
+		family, version, later := strings.ToUpper(m[1]), m[2], m[3] != ""
+		if version == "" {
+			version, later = gnuFirstVersion[family], true
+		}
+		if !strings.Contains(version, ".") {
+			version += ".0"
+		}
+		if later {
+			return fmt.Sprintf("%s-%s-or-later", family, version), true
+		}
+		return fmt.Sprintf("%s-%s-only", family, version), true
+	}
+	// other licenses use the + operator for later versions
+	base := strings.TrimSuffix(license, "+")
+	if id, ok := spdxIDs[strings.ToLower(base)]; ok {
+		return id + license[len(base):], true
+	}
+	ref := strings.Trim(licenseRefInvalid.ReplaceAllString(license, "-"), "-")
+	if ref == "" {
+		ref = "unknown"
+	}
+	return "LicenseRef-" + ref, false
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr,omitempty"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr,omitempty"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr,omitempty"`
+	Contents string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// junitReport groups the results into one test suite per config file,
+// in the order the files were run.
+func junitReport(result types.SummaryObject) junitTestSuites {
+	report := junitTestSuites{
+		Tests:    result.Total,
+		Failures: result.Fail,
+		Skipped:  result.Skipped + result.XFail,
+	}
+	var total time.Duration
+	suites := map[string]int{}
+	suiteTimes := map[string]time.Duration{}
+	for _, r := range result.Results {
+		i, ok := suites[r.File]
+		if !ok {
+			i = len(report.Suites)
+			suites[r.File] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: r.File})
+		}
+		testCase := junitTestCase{
+			Name:      r.Name,
+			Classname: r.File,
+			Time:      junitTime(r.Duration),
+			SystemOut: r.Stdout,
+			SystemErr: r.Stderr,
+		}
+		report.Suites[i].Tests++
+		switch r.State() {
+		case types.StatusSkip:
+			report.Suites[i].Skipped++
+			testCase.Skipped = &junitSkipped{Message: r.Reason}
+		case types.StatusXFail:
+			// junit has no expected failures, they're reported as skipped like pytest does
+			report.Suites[i].Skipped++
+			testCase.Skipped = &junitSkipped{Message: "expected failure: " + r.Reason}
+		case types.StatusFail, types.StatusXPass:
+			report.Suites[i].Failures++
+			testCase.Failure = &junitFailure{
+				Message:  fmt.Sprintf("%d error(s)", len(r.Errors)),
+				Contents: strings.Join(r.Errors, "\n"),
+			}
+			if r.TimedOut {
+				testCase.Failure.Type = "timeout"
+			}
+		}
+		report.Suites[i].TestCases = append(report.Suites[i].TestCases, testCase)
+		suiteTimes[r.File] += r.Duration
+		total += r.Duration
+	}
+	for i := range report.Suites {
+		report.Suites[i].Time = junitTime(suiteTimes[report.Suites[i].Name])
+	}
+	report.Time = junitTime(total)
+	return report
+}
+
+func junitResults(out io.Writer, result types.SummaryObject) error {
+	res, err := xml.MarshalIndent(junitReport(result), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling xml")
+	}
+	res = append([]byte(xml.Header), res...)
+	res = append(res, []byte("\n")...)
+	_, err = out.Write(res)
+	return err
+}
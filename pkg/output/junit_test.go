@@ -0,0 +1,112 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestJunitReport(t *testing.T) {
+	summary := types.SummaryObject{
+		Pass:  2,
+		Fail:  1,
+		Total: 3,
+		Results: []*types.TestResult{
+			{Name: "first", Pass: true, File: "a.yaml", Stdout: "out", Duration: time.Second},
+			{Name: "second", Pass: false, File: "b.yaml", Stderr: "err", Errors: []string{"one", "two"}, Duration: 500 * time.Millisecond},
+			{Name: "third", Pass: true, File: "a.yaml", Duration: 250 * time.Millisecond},
+		},
+	}
+
+	expected := junitTestSuites{
+		Tests:    3,
+		Failures: 1,
+		Time:     "1.750",
+		Suites: []junitTestSuite{
+			{
+				Name:  "a.yaml",
+				Tests: 2,
+				Time:  "1.250",
+				TestCases: []junitTestCase{
+					{Name: "first", Classname: "a.yaml", Time: "1.000", SystemOut: "out"},
+					{Name: "third", Classname: "a.yaml", Time: "0.250"},
+				},
+			},
+			{
+				Name:     "b.yaml",
+				Tests:    1,
+				Failures: 1,
+				Time:     "0.500",
+				TestCases: []junitTestCase{
+					{
+						Name:      "second",
+						Classname: "b.yaml",
+						Time:      "0.500",
+						SystemErr: "err",
+						Failure:   &junitFailure{Message: "2 error(s)", Contents: "one\ntwo"},
+					},
+				},
+			},
+		},
+	}
+	testutil.CheckDeepEqual(t, expected, junitReport(summary))
+
+	var b bytes.Buffer
+	if err := FinalResults(&b, JUnit, summary); err != nil {
+		t.Fatalf("did not expect error writing junit results but got %s", err)
+	}
+	for _, s := range []string{"<?xml", `<testsuite name="b.yaml" tests="1" failures="1"`, "<system-err>err</system-err>"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected %q in junit output but got:\n%s", s, b.String())
+		}
+	}
+}
+
+func TestJunitReportStates(t *testing.T) {
+	xfail := &types.TestResult{Name: "xfail", Errors: []string{"broken"}}
+	xfail.ExpectFailure("bug 12")
+	xpass := &types.TestResult{Name: "xpass", Pass: true}
+	xpass.ExpectFailure("bug 34")
+	summary := types.SummaryObject{
+		Pass:    1,
+		Fail:    1,
+		Skipped: 1,
+		XFail:   1,
+		XPass:   1,
+		Total:   4,
+		Results: []*types.TestResult{
+			{Name: "run", Pass: true},
+			types.Skipped("filtered", "tag slow is excluded"),
+			xfail,
+			xpass,
+		},
+	}
+	report := junitReport(summary)
+	testutil.CheckDeepEqual(t, 2, report.Skipped)
+	testutil.CheckDeepEqual(t, 2, report.Suites[0].Skipped)
+	testutil.CheckDeepEqual(t, 1, report.Suites[0].Failures)
+	cases := report.Suites[0].TestCases
+	testutil.CheckDeepEqual(t, &junitSkipped{Message: "tag slow is excluded"}, cases[1].Skipped)
+	testutil.CheckDeepEqual(t, &junitSkipped{Message: "expected failure: bug 12"}, cases[2].Skipped)
+	if cases[3].Failure == nil {
+		t.Errorf("expected an unexpected pass to be reported as a failure")
+	}
+}
@@ -27,14 +27,35 @@ import (
 	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 )
 
+// supported formats for test results
+const (
+	Text  = "text"
+	JSON  = "json"
+	JUnit = "junit"
+)
+
+var Formats = []string{Text, JSON, JUnit}
+
 var bannerLength = 27 // default banner length
 
 func OutputResult(out io.Writer, result *types.TestResult) {
 	color.Default.Fprintf(out, "=== RUN: %s\n", result.Name)
-	if result.Pass {
+	switch result.State() {
+	case types.StatusSkip:
+		color.Cyan.Fprintf(out, "--- SKIP: %s\n", result.Reason)
+		return
+	case types.StatusXFail:
+		color.Yellow.Fprintf(out, "--- XFAIL: %s\n", result.Reason)
+	case types.StatusXPass:
+		color.Red.Fprintf(out, "--- XPASS: %s\n", result.Reason)
+	case types.StatusPass:
 		color.Green.Fprintln(out, "--- PASS")
-	} else {
-		color.Red.Fprintln(out, "--- FAIL")
+	default:
+		if result.TimedOut {
+			color.Red.Fprintln(out, "--- FAIL (timed out)")
+		} else {
+			color.Red.Fprintln(out, "--- FAIL")
+		}
 	}
 	if result.Stdout != "" {
 		color.Blue.Fprintf(out, "stdout: %s\n", result.Stdout)
@@ -55,8 +76,11 @@ func Banner(out io.Writer, filename string) {
 	color.Purple.Fprintln(out, strings.Repeat("=", bannerLength))
 }
 
-func FinalResults(out io.Writer, jsonOut bool, result types.SummaryObject) error {
-	if jsonOut {
+func FinalResults(out io.Writer, format string, result types.SummaryObject) error {
+	switch format {
+	case JUnit:
+		return junitResults(out, result)
+	case JSON:
 		res, err := json.Marshal(result)
 		if err != nil {
 			return errors.Wrap(err, "marshalling json")
@@ -78,6 +102,15 @@ func FinalResults(out io.Writer, jsonOut bool, result types.SummaryObject) error
 	color.Default.Fprintln(out, strings.Repeat("=", bannerLength))
 	color.LightGreen.Fprintf(out, "Passes:      %d\n", result.Pass)
 	color.LightRed.Fprintf(out, "Failures:    %d\n", result.Fail)
+	if result.Skipped > 0 {
+		color.Cyan.Fprintf(out, "Skipped:     %d\n", result.Skipped)
+	}
+	if result.XFail > 0 {
+		color.Yellow.Fprintf(out, "Expected failures:  %d\n", result.XFail)
+	}
+	if result.XPass > 0 {
+		color.LightRed.Fprintf(out, "Unexpected passes:  %d\n", result.XPass)
+	}
 	color.Cyan.Fprintf(out, "Total tests: %d\n", result.Total)
 	color.Default.Fprintln(out, "")
 	if result.Fail == 0 {
@@ -0,0 +1,64 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const apkInstalled = "/lib/apk/db/installed"
+
+func detectApk(r FileReader) bool {
+	return exists(r, apkInstalled)
+}
+
+func listApk(r FileReader) ([]Package, error) {
+	installed, err := r.ReadFile(apkInstalled)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading apk database")
+	}
+	return parseApkInstalled(string(installed)), nil
+}
+
+// parseApkInstalled parses the apk database, where each package is a block of
+// single letter fields, e.g. P:musl for the name and V:1.1.20-r4 for the version.
+func parseApkInstalled(installed string) []Package {
+	var pkgs []Package
+	var p Package
+	for _, line := range strings.Split(installed+"\n", "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			if p.Name != "" {
+				pkgs = append(pkgs, p)
+			}
+			p = Package{}
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		switch line[0] {
+		case 'P':
+			p.Name = line[2:]
+		case 'V':
+			p.Version = line[2:]
+		case 'A':
+			p.Arch = line[2:]
+		}
+	}
+	return pkgs
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dpkgStatus = "/var/lib/dpkg/status"
+	// distroless images have no dpkg, and record each package in its own file here
+	dpkgStatusDir = "/var/lib/dpkg/status.d"
+)
+
+func detectDpkg(r FileReader) bool {
+	return exists(r, dpkgStatus) || exists(r, dpkgStatusDir)
+}
+
+func listDpkg(r FileReader) ([]Package, error) {
+	var pkgs []Package
+	if exists(r, dpkgStatus) {
+		status, err := r.ReadFile(dpkgStatus)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading dpkg status")
+		}
+		pkgs = append(pkgs, parseDpkgStatus(string(status))...)
+	}
+	if exists(r, dpkgStatusDir) {
+		infos, err := r.ReadDir(dpkgStatusDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading dpkg status directory")
+		}
+		for _, info := range infos {
+			if info.IsDir() || strings.HasSuffix(info.Name(), ".md5sums") {
+				continue
+			}
+			status, err := r.ReadFile(path.Join(dpkgStatusDir, info.Name()))
+			if err != nil {
+				return nil, errors.Wrap(err, "reading dpkg status")
+			}
+			pkgs = append(pkgs, parseDpkgStatus(string(status))...)
+		}
+	}
+	return pkgs, nil
+}
+
+// parseDpkgStatus parses the installed packages from a dpkg status file. entries
+// without a status are assumed to be installed, as in distroless images.
+func parseDpkgStatus(status string) []Package {
+	var pkgs []Package
+	for _, stanza := range strings.Split(strings.Replace(status, "\r\n", "\n", -1), "\n\n") {
+		fields := map[string]string{}
+		for _, line := range strings.Split(stanza, "\n") {
+			// continuation lines start with whitespace, and none of the fields we use have them
+			if line == "" || line[0] == ' ' || line[0] == '\t' {
+				continue
+			}
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			fields[parts[0]] = strings.TrimSpace(parts[1])
+		}
+		if fields["Package"] == "" {
+			continue
+		}
+		// the status is "want flag status", e.g. "install ok installed"
+		if status, ok := fields["Status"]; ok {
+			words := strings.Fields(status)
+			if len(words) != 3 || words[2] != "installed" {
+				continue
+			}
+		}
+		pkgs = append(pkgs, Package{
+			Name:    fields["Package"],
+			Version: fields["Version"],
+			Arch:    fields["Architecture"],
+		})
+	}
+	return pkgs
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ndb database constants, from lib/backend/ndb/rpmpkg.c in rpm
+const (
+	ndbMagic          = 'R' | 'p'<<8 | 'm'<<16 | 'P'<<24
+	ndbSlotMagic      = 'S' | 'l'<<8 | 'o'<<16 | 't'<<24
+	ndbBlobMagic      = 'B' | 'l'<<8 | 'b'<<16 | 'S'<<24
+	ndbHeaderSize     = 32
+	ndbSlotPages      = 12
+	ndbPageSize       = 4096
+	ndbSlotSize       = 16
+	ndbBlockSize      = 16
+	ndbBlobHeaderSize = 16
+)
+
+// ndbValues returns the package headers stored in an ndb database, as used by
+// rpm on SUSE. the database starts with a table of slots, each holding the
+// offset of a package header stored as a blob in the rest of the file.
+func ndbValues(db []byte) ([][]byte, error) {
+	order := binary.LittleEndian
+	if len(db) < ndbHeaderSize || order.Uint32(db) != ndbMagic {
+		return nil, errors.New("not an ndb database")
+	}
+	slotsEnd := int(order.Uint32(db[ndbSlotPages:])) * ndbPageSize
+	if slotsEnd < ndbHeaderSize || slotsEnd > len(db) {
+		return nil, errors.New("invalid slot table size")
+	}
+
+	var values [][]byte
+	// the header takes the place of the first slots
+	for off := ndbHeaderSize; off < slotsEnd; off += ndbSlotSize {
+		slot := db[off:]
+		if order.Uint32(slot) != ndbSlotMagic {
+			return nil, fmt.Errorf("invalid slot at offset %d", off)
+		}
+		pkgIdx := order.Uint32(slot[4:])
+		start := int(order.Uint32(slot[8:])) * ndbBlockSize
+		if pkgIdx == 0 || start == 0 {
+			// a free slot
+			continue
+		}
+		if start+ndbBlobHeaderSize > len(db) {
+			return nil, fmt.Errorf("package %d out of range", pkgIdx)
+		}
+		blob := db[start:]
+		if order.Uint32(blob) != ndbBlobMagic || order.Uint32(blob[4:]) != pkgIdx {
+			return nil, fmt.Errorf("invalid blob for package %d", pkgIdx)
+		}
+		length := int(order.Uint32(blob[12:]))
+		if start+ndbBlobHeaderSize+length > len(db) {
+			return nil, fmt.Errorf("package %d out of range", pkgIdx)
+		}
+		values = append(values, blob[ndbBlobHeaderSize:ndbBlobHeaderSize+length])
+	}
+	return values, nil
+}
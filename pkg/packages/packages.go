@@ -0,0 +1,114 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package packages lists the packages installed in an image by reading the
+// dpkg, apk or rpm database, and compares versions the way each package
+// manager does.
+package packages
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+const (
+	Dpkg = "dpkg"
+	Apk  = "apk"
+	Rpm  = "rpm"
+)
+
+// FileReader is the part of the driver API used to read package databases.
+type FileReader interface {
+	StatFile(path string) (os.FileInfo, error)
+	ReadFile(path string) ([]byte, error)
+	ReadDir(path string) ([]os.FileInfo, error)
+}
+
+type Package struct {
+	Name    string
+	Version string // full version as the package manager reports it, e.g. 1:2.3-4 for dpkg and rpm
+	Arch    string
+}
+
+// Key identifies an installed package as name:arch, since multi-arch systems
+// can have a package installed for several architectures, e.g. libc6:amd64
+// and libc6:i386.
+func (p Package) Key() string {
+	if p.Arch == "" {
+		return p.Name
+	}
+	return p.Name + ":" + p.Arch
+}
+
+// Matches returns whether p is the package called name, which can include an
+// architecture as in name:arch to only match the package for that architecture.
+func (p Package) Matches(name string) bool {
+	return p.Name == name || p.Arch != "" && p.Key() == name
+}
+
+type lister struct {
+	manager string
+	detect  func(FileReader) bool
+	list    func(FileReader) ([]Package, error)
+}
+
+// package managers in the order they are detected in
+var listers = []lister{
+	{Dpkg, detectDpkg, listDpkg},
+	{Apk, detectApk, listApk},
+	{Rpm, detectRpm, listRpm},
+}
+
+func exists(r FileReader, path string) bool {
+	_, err := r.StatFile(path)
+	return err == nil
+}
+
+// List returns the packages installed by the given package manager, sorted by
+// name and architecture.
+// if manager is empty, the first package manager with a database in the image
+// is used. the package manager used is returned along with the packages.
+func List(r FileReader, manager string) (string, []Package, error) {
+	for _, l := range listers {
+		if manager == "" && !l.detect(r) || manager != "" && manager != l.manager {
+			continue
+		}
+		pkgs, err := l.list(r)
+		if err != nil {
+			return l.manager, nil, err
+		}
+		sort.Slice(pkgs, func(i, j int) bool {
+			if pkgs[i].Name != pkgs[j].Name {
+				return pkgs[i].Name < pkgs[j].Name
+			}
+			return pkgs[i].Arch < pkgs[j].Arch
+		})
+		return l.manager, pkgs, nil
+	}
+	if manager != "" {
+		return "", nil, fmt.Errorf("unsupported package manager %s, expected one of %s, %s or %s", manager, Dpkg, Apk, Rpm)
+	}
+	return "", nil, fmt.Errorf("no %s, %s or %s package database found", Dpkg, Apk, Rpm)
+}
+
+// IsSupported returns whether packages installed by the package manager can be listed.
+func IsSupported(manager string) bool {
+	for _, l := range listers {
+		if l.manager == manager {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,372 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/packages/packagestest"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+const dpkgStatusFile = `Package: libc6
+Status: install ok installed
+Priority: required
+Architecture: amd64
+Version: 2.24-11+deb9u4
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries that are used by nearly all programs on
+ the system.
+
+Package: removed
+Status: deinstall ok config-files
+Version: 1.0
+
+Package: openssl
+Status: install ok installed
+Architecture: amd64
+Version: 1.1.0l-1~deb9u1
+`
+
+const apkInstalledFile = `C:Q1abc=
+P:musl
+V:1.1.22-r3
+A:x86_64
+T:the musl c library (libc) implementation
+
+C:Q1def=
+P:busybox
+V:1.30.1-r2
+A:x86_64
+`
+
+type rpmTag struct {
+	tag   uint32
+	typ   uint32
+	value interface{}
+}
+
+func rpmHeader(tags ...rpmTag) []byte {
+	var index, data bytes.Buffer
+	for _, t := range tags {
+		binary.Write(&index, binary.BigEndian, []uint32{t.tag, t.typ, uint32(data.Len()), 1})
+		switch v := t.value.(type) {
+		case string:
+			data.WriteString(v + "\x00")
+		case uint32:
+			binary.Write(&data, binary.BigEndian, v)
+		}
+	}
+	var h bytes.Buffer
+	binary.Write(&h, binary.BigEndian, []uint32{uint32(len(tags)), uint32(data.Len())})
+	h.Write(index.Bytes())
+	h.Write(data.Bytes())
+	return h.Bytes()
+}
+
+// bdbHashDatabase builds a single bucket hash database with the given values, storing
+// values too large for the bucket page in chains of overflow pages.
+func bdbHashDatabase(values [][]byte) []byte {
+	const pageSize = 512
+	var overflow [][]byte
+	var items [][]byte
+	for i, v := range values {
+		key := make([]byte, 5)
+		key[0] = bdbKeyData
+		binary.LittleEndian.PutUint32(key[1:], uint32(i+1))
+		items = append(items, key)
+		if len(v) < 100 {
+			items = append(items, append([]byte{bdbKeyData}, v...))
+			continue
+		}
+		item := make([]byte, bdbOffPageSize)
+		item[0] = bdbOffPage
+		binary.LittleEndian.PutUint32(item[4:], uint32(2+len(overflow)))
+		binary.LittleEndian.PutUint32(item[8:], uint32(len(v)))
+		items = append(items, item)
+		for len(v) > 0 {
+			n := pageSize - bdbPageHeaderSize
+			if n > len(v) {
+				n = len(v)
+			}
+			p := make([]byte, pageSize)
+			p[bdbPageType] = bdbOverflow
+			binary.LittleEndian.PutUint16(p[bdbPageHighFreeOff:], uint16(n))
+			copy(p[bdbPageHeaderSize:], v[:n])
+			v = v[n:]
+			if len(v) > 0 {
+				binary.LittleEndian.PutUint32(p[bdbPageNextPage:], uint32(2+len(overflow)+1))
+			}
+			overflow = append(overflow, p)
+		}
+	}
+
+	meta := make([]byte, pageSize)
+	binary.LittleEndian.PutUint32(meta[bdbMetaMagic:], bdbHashMagic)
+	binary.LittleEndian.PutUint32(meta[bdbMetaPageSize:], pageSize)
+	binary.LittleEndian.PutUint32(meta[bdbMetaLastPage:], uint32(1+len(overflow)))
+
+	bucket := make([]byte, pageSize)
+	bucket[bdbPageType] = bdbHash
+	binary.LittleEndian.PutUint16(bucket[bdbPageEntries:], uint16(len(items)))
+	end := pageSize
+	for i, item := range items {
+		end -= len(item)
+		copy(bucket[end:], item)
+		binary.LittleEndian.PutUint16(bucket[bdbPageHeaderSize+2*i:], uint16(end))
+	}
+
+	db := append(meta, bucket...)
+	for _, p := range overflow {
+		db = append(db, p...)
+	}
+	return db
+}
+
+func testRpmDatabase() string {
+	return string(bdbHashDatabase([][]byte{
+		// rpm keeps the next package instance number in the database alongside the headers
+		{3, 0, 0, 0},
+		rpmHeader(
+			rpmTag{rpmTagName, rpmTypeString, "zlib"},
+			rpmTag{rpmTagVersion, rpmTypeString, "1.2"},
+		),
+		rpmHeader(
+			rpmTag{rpmTagName, rpmTypeString, "bash"},
+			rpmTag{rpmTagVersion, rpmTypeString, "4.4.19"},
+			rpmTag{rpmTagRelease, rpmTypeString, "8.el8_0"},
+			rpmTag{rpmTagArch, rpmTypeString, "x86_64"},
+		),
+		rpmHeader(
+			rpmTag{rpmTagName, rpmTypeString, "openssl-libs"},
+			rpmTag{rpmTagEpoch, rpmTypeInt32, uint32(1)},
+			rpmTag{rpmTagVersion, rpmTypeString, "1.1.1c"},
+			rpmTag{rpmTagRelease, rpmTypeString, "2.el8"},
+			rpmTag{rpmTagArch, rpmTypeString, "x86_64"},
+			// pad the header out so it is stored in overflow pages
+			rpmTag{1004, rpmTypeString, strings.Repeat("a general purpose cryptography library ", 30)},
+		),
+	}))
+}
+
+// ndbDatabase builds an ndb database with one slot page holding the given
+// values, skipping a free slot.
+func ndbDatabase(values [][]byte) []byte {
+	db := make([]byte, ndbPageSize)
+	order := binary.LittleEndian
+	order.PutUint32(db, ndbMagic)
+	order.PutUint32(db[ndbSlotPages:], 1)
+	for off := ndbHeaderSize; off < ndbPageSize; off += ndbSlotSize {
+		order.PutUint32(db[off:], ndbSlotMagic)
+	}
+	for i, v := range values {
+		slot := db[ndbHeaderSize+ndbSlotSize*(2*i+1):]
+		order.PutUint32(slot[4:], uint32(i+1))
+		order.PutUint32(slot[8:], uint32(len(db)/ndbBlockSize))
+		blob := make([]byte, ndbBlobHeaderSize+len(v))
+		order.PutUint32(blob, ndbBlobMagic)
+		order.PutUint32(blob[4:], uint32(i+1))
+		order.PutUint32(blob[12:], uint32(len(v)))
+		copy(blob[ndbBlobHeaderSize:], v)
+		// blobs are followed by a tail, which isn't read, and padded to whole blocks
+		size := (len(blob) + 12 + ndbBlockSize - 1) / ndbBlockSize * ndbBlockSize
+		blob = append(blob, make([]byte, size-len(blob))...)
+		db = append(db, blob...)
+	}
+	return db
+}
+
+func testNdbDatabase() string {
+	return string(ndbDatabase([][]byte{
+		rpmHeader(
+			rpmTag{rpmTagName, rpmTypeString, "zlib"},
+			rpmTag{rpmTagVersion, rpmTypeString, "1.2"},
+		),
+		rpmHeader(
+			rpmTag{rpmTagName, rpmTypeString, "bash"},
+			rpmTag{rpmTagVersion, rpmTypeString, "4.4.19"},
+			rpmTag{rpmTagRelease, rpmTypeString, "8.el8_0"},
+			rpmTag{rpmTagArch, rpmTypeString, "x86_64"},
+		),
+		rpmHeader(
+			rpmTag{rpmTagName, rpmTypeString, "openssl-libs"},
+			rpmTag{rpmTagEpoch, rpmTypeInt32, uint32(1)},
+			rpmTag{rpmTagVersion, rpmTypeString, "1.1.1c"},
+			rpmTag{rpmTagRelease, rpmTypeString, "2.el8"},
+			rpmTag{rpmTagArch, rpmTypeString, "x86_64"},
+		),
+	}))
+}
+
+func TestList(t *testing.T) {
+	tables := []struct {
+		name     string
+		fs       packagestest.FS
+		manager  string
+		expected string
+		packages []Package
+		err      bool
+	}{
+		{
+			name:     "dpkg",
+			fs:       packagestest.FS{dpkgStatus: dpkgStatusFile},
+			expected: Dpkg,
+			packages: []Package{
+				{Name: "libc6", Version: "2.24-11+deb9u4", Arch: "amd64"},
+				{Name: "openssl", Version: "1.1.0l-1~deb9u1", Arch: "amd64"},
+			},
+		},
+		{
+			name: "multi-arch dpkg",
+			fs: packagestest.FS{dpkgStatus: dpkgStatusFile + `
+Package: libc6
+Status: install ok installed
+Architecture: i386
+Version: 2.24-11+deb9u4
+`},
+			expected: Dpkg,
+			packages: []Package{
+				{Name: "libc6", Version: "2.24-11+deb9u4", Arch: "amd64"},
+				{Name: "libc6", Version: "2.24-11+deb9u4", Arch: "i386"},
+				{Name: "openssl", Version: "1.1.0l-1~deb9u1", Arch: "amd64"},
+			},
+		},
+		{
+			name: "distroless dpkg",
+			fs: packagestest.FS{
+				dpkgStatusDir + "/libc6":         "Package: libc6\nVersion: 2.24-11+deb9u4\nArchitecture: amd64\n",
+				dpkgStatusDir + "/libc6.md5sums": "0123 lib/libc.so.6\n",
+			},
+			expected: Dpkg,
+			packages: []Package{{Name: "libc6", Version: "2.24-11+deb9u4", Arch: "amd64"}},
+		},
+		{
+			name:     "apk",
+			fs:       packagestest.FS{apkInstalled: apkInstalledFile},
+			expected: Apk,
+			packages: []Package{
+				{Name: "busybox", Version: "1.30.1-r2", Arch: "x86_64"},
+				{Name: "musl", Version: "1.1.22-r3", Arch: "x86_64"},
+			},
+		},
+		{
+			name:     "rpm",
+			fs:       packagestest.FS{"/var/lib/rpm/Packages": testRpmDatabase()},
+			expected: Rpm,
+			packages: []Package{
+				{Name: "bash", Version: "4.4.19-8.el8_0", Arch: "x86_64"},
+				{Name: "openssl-libs", Version: "1:1.1.1c-2.el8", Arch: "x86_64"},
+				{Name: "zlib", Version: "1.2"},
+			},
+		},
+		{
+			name:    "explicit manager",
+			fs:      packagestest.FS{dpkgStatus: dpkgStatusFile, apkInstalled: apkInstalledFile},
+			manager: Apk,
+			packages: []Package{
+				{Name: "busybox", Version: "1.30.1-r2", Arch: "x86_64"},
+				{Name: "musl", Version: "1.1.22-r3", Arch: "x86_64"},
+			},
+			expected: Apk,
+		},
+		{
+			name:     "ndb rpm",
+			fs:       packagestest.FS{"/usr/lib/sysimage/rpm/Packages.db": testNdbDatabase()},
+			expected: Rpm,
+			packages: []Package{
+				{Name: "bash", Version: "4.4.19-8.el8_0", Arch: "x86_64"},
+				{Name: "openssl-libs", Version: "1:1.1.1c-2.el8", Arch: "x86_64"},
+				{Name: "zlib", Version: "1.2"},
+			},
+		},
+		{
+			name:     "corrupt sqlite rpm database",
+			fs:       packagestest.FS{"/var/lib/rpm/rpmdb.sqlite": "not a database"},
+			expected: Rpm,
+			err:      true,
+		},
+		{
+			name: "no database",
+			fs:   packagestest.FS{},
+			err:  true,
+		},
+	}
+
+	for _, table := range tables {
+		manager, pkgs, err := List(table.fs, table.manager)
+		if table.err {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", table.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", table.name, err)
+			continue
+		}
+		testutil.CheckDeepEqual(t, table.expected, manager)
+		testutil.CheckDeepEqual(t, table.packages, pkgs)
+	}
+}
+
+func TestPackageMatches(t *testing.T) {
+	p := Package{Name: "libc6", Version: "2.24-11+deb9u4", Arch: "i386"}
+	testutil.CheckDeepEqual(t, "libc6:i386", p.Key())
+	testutil.CheckDeepEqual(t, true, p.Matches("libc6"))
+	testutil.CheckDeepEqual(t, true, p.Matches("libc6:i386"))
+	testutil.CheckDeepEqual(t, false, p.Matches("libc6:amd64"))
+	testutil.CheckDeepEqual(t, "zlib", Package{Name: "zlib"}.Key())
+}
+
+// testdata/rpmdb.sqlite was created by sqlite with the schema rpm uses and 512
+// byte pages, so the packages table spans several pages and one header is
+// stored in overflow pages.
+func TestListSqliteRpm(t *testing.T) {
+	db, err := ioutil.ReadFile("testdata/rpmdb.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, pkgs, err := List(packagestest.FS{"/var/lib/rpm/rpmdb.sqlite": string(db)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, Rpm, manager)
+	testutil.CheckDeepEqual(t, 22, len(pkgs))
+	testutil.CheckDeepEqual(t, Package{Name: "bash", Version: "5.1.8-4.el9", Arch: "x86_64"}, pkgs[0])
+	testutil.CheckDeepEqual(t, Package{Name: "openssl-libs", Version: "1:3.0.1-41.el9", Arch: "x86_64"}, pkgs[1])
+	testutil.CheckDeepEqual(t, Package{Name: "pkg19", Version: "1.19-1.el9", Arch: "noarch"}, pkgs[21])
+}
+
+func TestSqliteVarint(t *testing.T) {
+	tables := []struct {
+		encoded  []byte
+		expected int64
+		length   int
+	}{
+		{[]byte{0x7f}, 127, 1},
+		{[]byte{0x81, 0x00}, 128, 2},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -1, 9},
+		{[]byte{0x81}, 0, 0},
+	}
+	for _, table := range tables {
+		v, n := sqliteVarint(table.encoded)
+		testutil.CheckDeepEqual(t, table.expected, v)
+		testutil.CheckDeepEqual(t, table.length, n)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package packagestest provides an in memory packages.FileReader for tests.
+package packagestest
+
+import (
+	"archive/tar"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FS is a packages.FileReader over an in memory set of files, keyed by their
+// absolute paths. directories exist as long as there are files under them.
+type FS map[string]string
+
+func (fs FS) StatFile(p string) (os.FileInfo, error) {
+	if _, ok := fs[p]; ok {
+		return (&tar.Header{Name: path.Base(p), Mode: 0644, Size: int64(len(fs[p]))}).FileInfo(), nil
+	}
+	for f := range fs {
+		if strings.HasPrefix(f, p+"/") {
+			return (&tar.Header{Name: path.Base(p), Mode: 0755, Typeflag: tar.TypeDir}).FileInfo(), nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (fs FS) ReadFile(p string) ([]byte, error) {
+	contents, ok := fs[p]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(contents), nil
+}
+
+// ReadDir returns the files and directories directly under p, sorted by name.
+func (fs FS) ReadDir(p string) ([]os.FileInfo, error) {
+	names := map[string]bool{}
+	for f := range fs {
+		if strings.HasPrefix(f, p+"/") {
+			names[strings.SplitN(strings.TrimPrefix(f, p+"/"), "/", 2)[0]] = true
+		}
+	}
+	if len(names) == 0 {
+		return nil, os.ErrNotExist
+	}
+	var infos []os.FileInfo
+	for name := range names {
+		info, _ := fs.StatFile(path.Join(p, name))
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
@@ -0,0 +1,287 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// the rpm database lives in one of these directories, depending on the distribution
+var rpmDirs = []string{"/var/lib/rpm", "/usr/lib/sysimage/rpm"}
+
+type rpmBackend struct {
+	file   string
+	values func([]byte) ([][]byte, error)
+}
+
+// the database formats rpm has used, newest first so that a database left behind
+// by an older rpm isn't read instead of the one in use
+var rpmBackends = []rpmBackend{
+	// rpm 4.16 and later, e.g. Fedora 33 and RHEL 9
+	{"rpmdb.sqlite", sqlitePackages},
+	// rpm 4.16 and later on SUSE
+	{"Packages.db", ndbValues},
+	// Berkeley DB, used by older rpm versions
+	{"Packages", bdbHashValues},
+}
+
+func detectRpm(r FileReader) bool {
+	for _, dir := range rpmDirs {
+		for _, b := range rpmBackends {
+			if exists(r, path.Join(dir, b.file)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func listRpm(r FileReader) ([]Package, error) {
+	for _, dir := range rpmDirs {
+		for _, b := range rpmBackends {
+			db := path.Join(dir, b.file)
+			if !exists(r, db) {
+				continue
+			}
+			contents, err := r.ReadFile(db)
+			if err != nil {
+				return nil, errors.Wrap(err, "reading rpm database")
+			}
+			values, err := b.values(contents)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading rpm database %s", db)
+			}
+			var pkgs []Package
+			for _, v := range values {
+				p, ok := parseRpmHeader(v)
+				if ok {
+					pkgs = append(pkgs, p)
+				}
+			}
+			return pkgs, nil
+		}
+	}
+	return nil, errors.New("no rpm database found")
+}
+
+// sqlitePackages returns the package headers stored in a sqlite rpm database,
+// in the blob column of the Packages table.
+func sqlitePackages(contents []byte) ([][]byte, error) {
+	db, err := newSqliteDB(contents)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.table("Packages")
+	if err != nil {
+		return nil, err
+	}
+	var values [][]byte
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		if blob, ok := row[1].([]byte); ok {
+			values = append(values, blob)
+		}
+	}
+	return values, nil
+}
+
+// Berkeley DB hash database constants, from db_page.h
+const (
+	bdbHashMagic       = 0x061561
+	bdbPageHeaderSize  = 26
+	bdbHashUnsorted    = 2
+	bdbOverflow        = 7
+	bdbHash            = 13
+	bdbKeyData         = 1
+	bdbOffPage         = 3
+	bdbOffPageSize     = 12
+	bdbMetaPageSize    = 20
+	bdbMetaMagic       = 12
+	bdbMetaLastPage    = 32
+	bdbPageNextPage    = 16
+	bdbPageEntries     = 20
+	bdbPageHighFreeOff = 22
+	bdbPageType        = 25
+)
+
+// bdbHashValues returns every value stored in a Berkeley DB hash database,
+// as used by rpm before version 4.16.
+func bdbHashValues(db []byte) ([][]byte, error) {
+	if len(db) < 512 {
+		return nil, errors.New("database too short")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint32(db[bdbMetaMagic:]) != bdbHashMagic {
+		order = binary.BigEndian
+		if order.Uint32(db[bdbMetaMagic:]) != bdbHashMagic {
+			return nil, errors.New("not a Berkeley DB hash database")
+		}
+	}
+	pageSize := int(order.Uint32(db[bdbMetaPageSize:]))
+	if pageSize < 512 || pageSize > 64*1024 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+	lastPage := int(order.Uint32(db[bdbMetaLastPage:]))
+
+	page := func(n int) ([]byte, error) {
+		if n < 0 || n > lastPage || (n+1)*pageSize > len(db) {
+			return nil, fmt.Errorf("page %d out of range", n)
+		}
+		return db[n*pageSize : (n+1)*pageSize], nil
+	}
+
+	var values [][]byte
+	for n := 1; n <= lastPage; n++ {
+		p, err := page(n)
+		if err != nil {
+			return nil, err
+		}
+		if p[bdbPageType] != bdbHash && p[bdbPageType] != bdbHashUnsorted {
+			continue
+		}
+		entries := int(order.Uint16(p[bdbPageEntries:]))
+		if bdbPageHeaderSize+2*entries > pageSize {
+			return nil, fmt.Errorf("invalid entry count on page %d", n)
+		}
+		// entries alternate between keys and values, and are stored from the end
+		// of the page backwards, so each ends where the previous one starts
+		for i := 1; i < entries; i += 2 {
+			start := int(order.Uint16(p[bdbPageHeaderSize+2*i:]))
+			end := int(order.Uint16(p[bdbPageHeaderSize+2*(i-1):]))
+			if start >= end || end > pageSize {
+				return nil, fmt.Errorf("invalid entry on page %d", n)
+			}
+			item := p[start:end]
+			switch item[0] {
+			case bdbKeyData:
+				values = append(values, item[1:])
+			case bdbOffPage:
+				if len(item) < bdbOffPageSize {
+					return nil, fmt.Errorf("invalid overflow entry on page %d", n)
+				}
+				v, err := bdbOverflowValue(page, order, int(order.Uint32(item[4:])), int(order.Uint32(item[8:])))
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+			}
+		}
+	}
+	return values, nil
+}
+
+// bdbOverflowValue reads a value stored in a chain of overflow pages.
+func bdbOverflowValue(page func(int) ([]byte, error), order binary.ByteOrder, n int, length int) ([]byte, error) {
+	value := make([]byte, 0, length)
+	for n != 0 && len(value) < length {
+		p, err := page(n)
+		if err != nil {
+			return nil, err
+		}
+		if p[bdbPageType] != bdbOverflow {
+			return nil, fmt.Errorf("expected overflow page at page %d", n)
+		}
+		// on overflow pages, the high free offset is the length of the data
+		size := int(order.Uint16(p[bdbPageHighFreeOff:]))
+		if bdbPageHeaderSize+size > len(p) {
+			return nil, fmt.Errorf("invalid overflow page %d", n)
+		}
+		value = append(value, p[bdbPageHeaderSize:bdbPageHeaderSize+size]...)
+		n = int(order.Uint32(p[bdbPageNextPage:]))
+	}
+	if len(value) != length {
+		return nil, fmt.Errorf("overflow value is %d bytes, expected %d", len(value), length)
+	}
+	return value, nil
+}
+
+// rpm header tags and types
+const (
+	rpmTagName    = 1000
+	rpmTagVersion = 1001
+	rpmTagRelease = 1002
+	rpmTagEpoch   = 1003
+	rpmTagArch    = 1022
+
+	rpmTypeInt32  = 4
+	rpmTypeString = 6
+)
+
+// parseRpmHeader reads the name and version of a package from its header, as
+// stored in the rpm database. it returns false for records that aren't headers.
+func parseRpmHeader(h []byte) (Package, bool) {
+	if len(h) < 8 {
+		return Package{}, false
+	}
+	indexCount := int(binary.BigEndian.Uint32(h))
+	dataLen := int(binary.BigEndian.Uint32(h[4:]))
+	dataStart := 8 + 16*indexCount
+	if indexCount <= 0 || dataLen < 0 || dataStart+dataLen > len(h) {
+		return Package{}, false
+	}
+	data := h[dataStart : dataStart+dataLen]
+
+	var p Package
+	var version, release string
+	epoch := -1
+	for i := 0; i < indexCount; i++ {
+		entry := h[8+16*i:]
+		tag := binary.BigEndian.Uint32(entry)
+		typ := binary.BigEndian.Uint32(entry[4:])
+		offset := int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || offset >= len(data) {
+			continue
+		}
+		if typ == rpmTypeInt32 && tag == rpmTagEpoch && offset+4 <= len(data) {
+			epoch = int(binary.BigEndian.Uint32(data[offset:]))
+			continue
+		}
+		if typ != rpmTypeString {
+			continue
+		}
+		value := data[offset:]
+		if end := bytes.IndexByte(value, 0); end >= 0 {
+			value = value[:end]
+		}
+		switch tag {
+		case rpmTagName:
+			p.Name = string(value)
+		case rpmTagVersion:
+			version = string(value)
+		case rpmTagRelease:
+			release = string(value)
+		case rpmTagArch:
+			p.Arch = string(value)
+		}
+	}
+	if p.Name == "" {
+		return Package{}, false
+	}
+	p.Version = version
+	if release != "" {
+		p.Version += "-" + release
+	}
+	if epoch >= 0 {
+		p.Version = fmt.Sprintf("%d:%s", epoch, p.Version)
+	}
+	return p, true
+}
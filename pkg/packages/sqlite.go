@@ -0,0 +1,285 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// sqlite file format constants, from https://www.sqlite.org/fileformat.html
+const (
+	sqliteMagic          = "SQLite format 3\x00"
+	sqliteHeaderSize     = 100
+	sqlitePageSize       = 16
+	sqliteReservedSpace  = 20
+	sqliteInteriorTable  = 0x05
+	sqliteLeafTable      = 0x0d
+	sqliteLeafHeaderSize = 8
+	sqliteCellCount      = 3
+	sqliteRightPointer   = 8
+)
+
+// sqliteDB reads tables from a sqlite database, as used by rpm since version 4.16.
+type sqliteDB struct {
+	db       []byte
+	pageSize int
+	usable   int // page size less the space reserved at the end of each page
+}
+
+func newSqliteDB(db []byte) (*sqliteDB, error) {
+	if len(db) < sqliteHeaderSize || string(db[:len(sqliteMagic)]) != sqliteMagic {
+		return nil, errors.New("not a sqlite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(db[sqlitePageSize:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+	return &sqliteDB{
+		db:       db,
+		pageSize: pageSize,
+		usable:   pageSize - int(db[sqliteReservedSpace]),
+	}, nil
+}
+
+// page returns page n, numbered from 1.
+func (s *sqliteDB) page(n int) ([]byte, error) {
+	if n < 1 || n*s.pageSize > len(s.db) {
+		return nil, fmt.Errorf("page %d out of range", n)
+	}
+	return s.db[(n-1)*s.pageSize : n*s.pageSize], nil
+}
+
+// table returns the rows of the named table. each row holds the values of its
+// columns, which are nil, int64, float64, string or []byte. a column that is
+// the INTEGER PRIMARY KEY of the table is always nil.
+func (s *sqliteDB) table(name string) ([][]interface{}, error) {
+	// the schema table is stored at page 1, with rows of type, name,
+	// tbl_name, rootpage and sql
+	schema, err := s.rows(1)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading schema")
+	}
+	for _, row := range schema {
+		if len(row) < 4 || row[0] != "table" || row[1] != name {
+			continue
+		}
+		root, ok := row[3].(int64)
+		if !ok {
+			return nil, fmt.Errorf("invalid root page for table %s", name)
+		}
+		rows, err := s.rows(int(root))
+		return rows, errors.Wrapf(err, "reading table %s", name)
+	}
+	return nil, fmt.Errorf("no table %s", name)
+}
+
+// rows returns the rows of the table b-tree with its root at the given page.
+func (s *sqliteDB) rows(root int) ([][]interface{}, error) {
+	var rows [][]interface{}
+	visited := map[int]bool{}
+	var walk func(n int) error
+	walk = func(n int) error {
+		if visited[n] {
+			return fmt.Errorf("page %d is referenced twice", n)
+		}
+		visited[n] = true
+		p, err := s.page(n)
+		if err != nil {
+			return err
+		}
+		header := p
+		if n == 1 {
+			header = p[sqliteHeaderSize:]
+		}
+		cells := int(binary.BigEndian.Uint16(header[sqliteCellCount:]))
+		pointers := sqliteLeafHeaderSize
+		if header[0] == sqliteInteriorTable {
+			pointers += 4
+		}
+		if len(p)-len(header)+pointers+2*cells > s.usable {
+			return fmt.Errorf("invalid cell count on page %d", n)
+		}
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(header[pointers+2*i:]))
+			if offset >= s.usable {
+				return fmt.Errorf("invalid cell on page %d", n)
+			}
+			cell := p[offset:s.usable]
+			switch header[0] {
+			case sqliteInteriorTable:
+				if len(cell) < 4 {
+					return fmt.Errorf("invalid cell on page %d", n)
+				}
+				if err := walk(int(binary.BigEndian.Uint32(cell))); err != nil {
+					return err
+				}
+			case sqliteLeafTable:
+				payload, err := s.payload(cell)
+				if err != nil {
+					return errors.Wrapf(err, "reading cell on page %d", n)
+				}
+				row, err := sqliteRecord(payload)
+				if err != nil {
+					return errors.Wrapf(err, "reading cell on page %d", n)
+				}
+				rows = append(rows, row)
+			default:
+				return fmt.Errorf("page %d is not a table b-tree page", n)
+			}
+		}
+		if header[0] == sqliteInteriorTable {
+			return walk(int(binary.BigEndian.Uint32(header[sqliteRightPointer:])))
+		}
+		return nil
+	}
+	return rows, walk(root)
+}
+
+// payload returns the record stored in a table leaf cell, reading the part
+// that doesn't fit in the page from its overflow pages.
+func (s *sqliteDB) payload(cell []byte) ([]byte, error) {
+	size, n := sqliteVarint(cell)
+	if n == 0 {
+		return nil, errors.New("truncated payload size")
+	}
+	cell = cell[n:]
+	// the rowid
+	if _, n = sqliteVarint(cell); n == 0 {
+		return nil, errors.New("truncated rowid")
+	}
+	cell = cell[n:]
+
+	// how much of the payload is stored in the page is worked out as in btreeParseCellPtr
+	local := int(size)
+	if max := s.usable - 35; local > max {
+		min := (s.usable-12)*32/255 - 23
+		local = min + (int(size)-min)%(s.usable-4)
+		if local > max {
+			local = min
+		}
+	}
+	if local > len(cell) {
+		return nil, errors.New("truncated payload")
+	}
+	payload := append([]byte{}, cell[:local]...)
+	if local == int(size) {
+		return payload, nil
+	}
+	if local+4 > len(cell) {
+		return nil, errors.New("truncated overflow page number")
+	}
+	next := int(binary.BigEndian.Uint32(cell[local:]))
+	for len(payload) < int(size) {
+		if next == 0 {
+			return nil, errors.New("overflow chain ends early")
+		}
+		p, err := s.page(next)
+		if err != nil {
+			return nil, err
+		}
+		data := p[4:s.usable]
+		if remaining := int(size) - len(payload); len(data) > remaining {
+			data = data[:remaining]
+		}
+		payload = append(payload, data...)
+		next = int(binary.BigEndian.Uint32(p))
+	}
+	return payload, nil
+}
+
+// sqliteVarint decodes a variable length integer, returning it along with its
+// length, or a length of 0 if it is truncated.
+func sqliteVarint(b []byte) (int64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			// the ninth byte contributes all eight bits
+			return int64(v<<8 | uint64(b[i])), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return int64(v), i + 1
+		}
+	}
+	return 0, 0
+}
+
+// sqliteRecord decodes the column values of a record.
+func sqliteRecord(record []byte) ([]interface{}, error) {
+	headerSize, n := sqliteVarint(record)
+	if n == 0 || headerSize < int64(n) || headerSize > int64(len(record)) {
+		return nil, errors.New("invalid record header")
+	}
+	header := record[n:headerSize]
+	body := record[headerSize:]
+	var values []interface{}
+	for len(header) > 0 {
+		serialType, n := sqliteVarint(header)
+		if n == 0 {
+			return nil, errors.New("invalid record header")
+		}
+		header = header[n:]
+
+		var size int
+		switch {
+		case serialType >= 1 && serialType <= 4:
+			size = int(serialType)
+		case serialType == 5:
+			size = 6
+		case serialType == 6 || serialType == 7:
+			size = 8
+		case serialType >= 12:
+			size = int(serialType-12) / 2
+		}
+		if size > len(body) {
+			return nil, errors.New("truncated record")
+		}
+		data := body[:size]
+		body = body[size:]
+
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType <= 6:
+			// big endian two's complement integers
+			var v uint64
+			for _, b := range data {
+				v = v<<8 | uint64(b)
+			}
+			shift := uint(64 - 8*size)
+			values = append(values, int64(v<<shift)>>shift)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(data)))
+		case serialType == 8:
+			values = append(values, int64(0))
+		case serialType == 9:
+			values = append(values, int64(1))
+		case serialType >= 12 && serialType%2 == 0:
+			values = append(values, data)
+		case serialType >= 13:
+			values = append(values, string(data))
+		default:
+			return nil, fmt.Errorf("invalid serial type %d", serialType)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,385 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Compare compares two versions using the ordering of the given package manager,
+// returning a negative number if a is older than b, 0 if they are equal and a
+// positive number if a is newer.
+func Compare(manager, a, b string) int {
+	switch manager {
+	case Apk:
+		return compareApk(a, b)
+	case Rpm:
+		return compareRpm(a, b)
+	default:
+		return compareDpkg(a, b)
+	}
+}
+
+// Constraint is a set of version requirements that must all hold, e.g. ">= 1.2, < 2".
+type Constraint []requirement
+
+type requirement struct {
+	op      string
+	version string
+}
+
+// ParseConstraint parses a comma separated list of requirements, each an operator
+// (=, !=, <, <=, > or >=) followed by a version. a version without an operator
+// must match exactly.
+func ParseConstraint(constraint string) (Constraint, error) {
+	var c Constraint
+	for _, part := range strings.Split(constraint, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("invalid version constraint '%s': empty requirement", constraint)
+		}
+		op := "="
+		for _, o := range []string{"==", "!=", "<=", ">=", "=", "<", ">"} {
+			if strings.HasPrefix(part, o) {
+				op = o
+				if o == "==" {
+					op = "="
+				}
+				part = strings.TrimSpace(part[len(o):])
+				break
+			}
+		}
+		if part == "" {
+			return nil, fmt.Errorf("invalid version constraint '%s': missing version", constraint)
+		}
+		c = append(c, requirement{op: op, version: part})
+	}
+	return c, nil
+}
+
+// Matches returns whether the version satisfies every requirement.
+func (c Constraint) Matches(manager, version string) bool {
+	for _, r := range c {
+		cmp := Compare(manager, version, r.version)
+		var ok bool
+		switch r.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitEpoch splits a version into its numeric epoch, defaulting to 0, and the rest.
+func splitEpoch(v string) (int, string) {
+	if i := strings.Index(v, ":"); i >= 0 {
+		epoch, err := strconv.Atoi(v[:i])
+		if err == nil {
+			return epoch, v[i+1:]
+		}
+	}
+	return 0, v
+}
+
+// splitRevision splits a version at its last hyphen into the upstream version
+// and the revision or release.
+func splitRevision(v string) (string, string) {
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// compareDigits compares two strings of digits numerically, without overflowing.
+func compareDigits(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// compareDpkg implements the version ordering described in deb-version(7).
+func compareDpkg(a, b string) int {
+	epochA, a := splitEpoch(a)
+	epochB, b := splitEpoch(b)
+	if c := compareInts(epochA, epochB); c != 0 {
+		return c
+	}
+	upstreamA, revisionA := splitRevision(a)
+	upstreamB, revisionB := splitRevision(b)
+	if c := compareDpkgPart(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return compareDpkgPart(revisionA, revisionB)
+}
+
+// dpkgOrder sorts ~ before the end of the string, and letters before other characters.
+func dpkgOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+func compareDpkgPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isDigit(a[i]) || j < len(b) && !isDigit(b[j]) {
+			ac, bc := dpkgOrder(a, i), dpkgOrder(b, j)
+			if ac != bc {
+				return compareInts(ac, bc)
+			}
+			i++
+			j++
+		}
+		startA, startB := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		if c := compareDigits(a[startA:i], b[startB:j]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareRpm compares epoch:version-release strings the way rpm does.
+func compareRpm(a, b string) int {
+	epochA, a := splitEpoch(a)
+	epochB, b := splitEpoch(b)
+	if c := compareInts(epochA, epochB); c != 0 {
+		return c
+	}
+	versionA, releaseA := splitRevision(a)
+	versionB, releaseB := splitRevision(b)
+	if c := rpmvercmp(versionA, versionB); c != 0 {
+		return c
+	}
+	// a version without a release matches any release
+	if releaseA == "" || releaseB == "" {
+		return 0
+	}
+	return rpmvercmp(releaseA, releaseB)
+}
+
+// rpmvercmp is a port of rpm's rpmvercmp, which compares alternating runs of
+// digits and letters, ignoring separators. ~ sorts before anything, even the
+// end of the version, and ^ sorts after the end of the version but before anything else.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSeparator := func(c byte) bool {
+		return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^'
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && isSeparator(a[i]) {
+			i++
+		}
+		for j < len(b) && isSeparator(b[j]) {
+			j++
+		}
+		if i < len(a) && a[i] == '~' || j < len(b) && b[j] == '~' {
+			if i >= len(a) || a[i] != '~' {
+				return 1
+			}
+			if j >= len(b) || b[j] != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if i < len(a) && a[i] == '^' || j < len(b) && b[j] == '^' {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if a[i] != '^' {
+				return 1
+			}
+			if b[j] != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+		startA, startB := i, j
+		isNum := isDigit(a[i])
+		match := isAlpha
+		if isNum {
+			match = isDigit
+		}
+		for i < len(a) && match(a[i]) {
+			i++
+		}
+		for j < len(b) && match(b[j]) {
+			j++
+		}
+		// numeric segments are newer than alphabetic ones
+		if startB == j {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+		var c int
+		if isNum {
+			c = compareDigits(a[startA:i], b[startB:j])
+		} else {
+			c = strings.Compare(a[startA:i], b[startB:j])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i < len(a):
+		return 1
+	}
+	return -1
+}
+
+// apk suffixes, in order. versions without a suffix sort between rc and cvs.
+var apkSuffixes = map[string]int{
+	"alpha": -4,
+	"beta":  -3,
+	"pre":   -2,
+	"rc":    -1,
+	"cvs":   1,
+	"svn":   2,
+	"git":   3,
+	"hg":    4,
+	"p":     5,
+}
+
+type apkVersion struct {
+	numbers  []string
+	letter   byte
+	suffixes [][2]string // suffix name and number
+	revision string
+}
+
+func parseApk(v string) apkVersion {
+	var p apkVersion
+	if i := strings.LastIndex(v, "-r"); i >= 0 {
+		p.revision = v[i+2:]
+		v = v[:i]
+	}
+	parts := strings.Split(v, "_")
+	main := parts[0]
+	if len(main) > 0 && isAlpha(main[len(main)-1]) {
+		p.letter = main[len(main)-1]
+		main = main[:len(main)-1]
+	}
+	p.numbers = strings.Split(main, ".")
+	for _, s := range parts[1:] {
+		i := len(s)
+		for i > 0 && isDigit(s[i-1]) {
+			i--
+		}
+		p.suffixes = append(p.suffixes, [2]string{s[:i], s[i:]})
+	}
+	return p
+}
+
+// compareApk compares versions of the form 1.2.3a_rc1-r2, following apk's
+// ordering of numbers, letters, suffixes and then the package revision.
+func compareApk(a, b string) int {
+	va, vb := parseApk(a), parseApk(b)
+	for k := 0; k < len(va.numbers) && k < len(vb.numbers); k++ {
+		if c := compareDigits(va.numbers[k], vb.numbers[k]); c != 0 {
+			return c
+		}
+	}
+	if c := compareInts(len(va.numbers), len(vb.numbers)); c != 0 {
+		return c
+	}
+	if c := compareInts(int(va.letter), int(vb.letter)); c != 0 {
+		return c
+	}
+	for k := 0; k < len(va.suffixes) || k < len(vb.suffixes); k++ {
+		var sa, sb [2]string
+		if k < len(va.suffixes) {
+			sa = va.suffixes[k]
+		}
+		if k < len(vb.suffixes) {
+			sb = vb.suffixes[k]
+		}
+		if c := compareInts(apkSuffixes[sa[0]], apkSuffixes[sb[0]]); c != 0 {
+			return c
+		}
+		if c := compareDigits(sa[1], sb[1]); c != 0 {
+			return c
+		}
+	}
+	return compareDigits(va.revision, vb.revision)
+}
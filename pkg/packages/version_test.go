@@ -0,0 +1,109 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tables := []struct {
+		manager string
+		a, b    string
+		result  int
+	}{
+		{Dpkg, "1.0", "1.0", 0},
+		{Dpkg, "1.0", "1.1", -1},
+		{Dpkg, "1.10", "1.9", 1},
+		{Dpkg, "1.0~rc1", "1.0", -1},
+		{Dpkg, "1.0", "1.0+deb9u1", -1},
+		{Dpkg, "1:0.1", "2.0", 1},
+		{Dpkg, "1.1.0l-1~deb9u1", "1.1.0l-1", -1},
+		{Dpkg, "2.24-11+deb9u4", "2.24-11+deb9u3", 1},
+		{Dpkg, "1.0a", "1.0-", 1},
+
+		{Rpm, "1.0-1", "1.0-1", 0},
+		{Rpm, "1.0-1", "1.0-2", -1},
+		{Rpm, "1.10-1", "1.9-1", 1},
+		{Rpm, "1.0~rc1-1", "1.0-1", -1},
+		{Rpm, "1.0^git1-1", "1.0-1", 1},
+		{Rpm, "1.0a-1", "1.0.1-1", -1},
+		{Rpm, "1:1.0-1", "2.0-1", 1},
+		{Rpm, "1.1.1c-2.el8", "1.1.1c", 0},
+
+		{Apk, "1.1.22-r3", "1.1.22-r3", 0},
+		{Apk, "1.1.22-r3", "1.1.22-r10", -1},
+		{Apk, "1.2", "1.2.1", -1},
+		{Apk, "1.2_rc1", "1.2", -1},
+		{Apk, "1.2_alpha2", "1.2_beta1", -1},
+		{Apk, "1.2_p1", "1.2", 1},
+		{Apk, "1.2a", "1.2b", -1},
+		{Apk, "1.10", "1.9", 1},
+	}
+
+	for _, table := range tables {
+		result := Compare(table.manager, table.a, table.b)
+		if sign(result) != table.result {
+			t.Errorf("%s: comparing %s to %s: expected %d, got %d", table.manager, table.a, table.b, table.result, result)
+		}
+		if reverse := Compare(table.manager, table.b, table.a); sign(reverse) != -table.result {
+			t.Errorf("%s: comparing %s to %s: expected %d, got %d", table.manager, table.b, table.a, -table.result, reverse)
+		}
+	}
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestConstraint(t *testing.T) {
+	tables := []struct {
+		constraint string
+		version    string
+		matches    bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.4", false},
+		{"== 1.2.3", "1.2.3", true},
+		{">= 1.2, < 2", "1.9.9", true},
+		{">= 1.2, < 2", "2.0", false},
+		{">=1.2,<2", "1.1", false},
+		{"!= 1.0", "1.1", true},
+		{"> 1.0", "1.0", false},
+		{"<= 1.0", "1.0", true},
+	}
+
+	for _, table := range tables {
+		c, err := ParseConstraint(table.constraint)
+		if err != nil {
+			t.Fatalf("parsing %s: %s", table.constraint, err)
+		}
+		if c.Matches(Dpkg, table.version) != table.matches {
+			t.Errorf("expected %s matching %s to be %t", table.version, table.constraint, table.matches)
+		}
+	}
+
+	for _, invalid := range []string{"", ">=", ">= 1.0,", "< 2, , > 1"} {
+		if _, err := ParseConstraint(invalid); err == nil {
+			t.Errorf("expected error parsing constraint '%s'", invalid)
+		}
+	}
+}
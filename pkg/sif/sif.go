@@ -0,0 +1,365 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sif reads singularity image format (SIF) containers directly, without
+// the singularity binary. The root filesystem is read from the squashfs primary
+// system partition, and image metadata from the label and JSON descriptors.
+package sif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sifMagic   = "SIF_MAGIC"
+	sifVersion = "01"
+
+	// where singularity stores image metadata inside the container filesystem
+	labelsFile = "/.singularity.d/labels.json"
+	envDir     = "/.singularity.d/env"
+)
+
+// descriptor data types
+const (
+	dataDeffile = iota + 0x4001
+	dataEnvVar
+	dataLabels
+	dataPartition
+	dataSignature
+	dataGenericJSON
+	dataGeneric
+	dataCryptoMessage
+)
+
+// partition filesystem types
+const (
+	fsSquash = iota + 1
+	fsExt3
+	fsImmuObj
+	fsRaw
+	fsEncryptedSquash
+)
+
+// partition types
+const (
+	partSystem = iota + 1
+	partPrimSys
+	partData
+	partOverlay
+)
+
+// SIF architecture codes, mapped to their GOARCH names
+var archs = map[string]string{
+	"01": "386",
+	"02": "amd64",
+	"03": "arm",
+	"04": "arm64",
+	"05": "ppc64",
+	"06": "ppc64le",
+	"07": "mips",
+	"08": "mipsle",
+	"09": "mips64",
+	"10": "mips64le",
+	"11": "s390x",
+}
+
+var fsTypes = map[int32]string{
+	fsSquash:          "squashfs",
+	fsExt3:            "ext3",
+	fsImmuObj:         "immutable object",
+	fsRaw:             "raw",
+	fsEncryptedSquash: "encrypted squashfs",
+}
+
+type header struct {
+	Launch   [32]byte
+	Magic    [10]byte
+	Version  [3]byte
+	Arch     [3]byte
+	ID       [16]byte
+	Ctime    int64
+	Mtime    int64
+	Dfree    int64
+	Dtotal   int64
+	Descroff int64
+	Descrlen int64
+	Dataoff  int64
+	Datalen  int64
+}
+
+type descriptor struct {
+	Datatype int32
+	Used     bool
+	ID       uint32
+	Groupid  uint32
+	Link     uint32
+	Fileoff  int64
+	Filelen  int64
+	Storelen int64
+	Ctime    int64
+	Mtime    int64
+	UID      int64
+	GID      int64
+	Name     [128]byte
+	Extra    [384]byte
+}
+
+type partition struct {
+	Fstype   int32
+	Parttype int32
+	Arch     [3]byte
+}
+
+func (d descriptor) partition() partition {
+	var p partition
+	binary.Read(bytes.NewReader(d.Extra[:]), binary.LittleEndian, &p)
+	return p
+}
+
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// Image is an opened SIF container.
+type Image struct {
+	f           *os.File
+	header      header
+	descriptors []descriptor
+	fs          *SquashFS
+}
+
+// Open reads the descriptors of the SIF container at the given path and
+// opens its root filesystem.
+func Open(name string) (*Image, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	img, err := newImage(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "reading SIF image %s", name)
+	}
+	return img, nil
+}
+
+func newImage(f *os.File) (*Image, error) {
+	var h header
+	if err := binary.Read(f, binary.LittleEndian, &h); err != nil {
+		return nil, errors.Wrap(err, "reading header")
+	}
+	if cstring(h.Magic[:]) != sifMagic {
+		return nil, errors.New("not a SIF file")
+	}
+	if v := cstring(h.Version[:]); v != sifVersion {
+		return nil, fmt.Errorf("unsupported SIF version %s", v)
+	}
+
+	img := &Image{f: f, header: h}
+	r := io.NewSectionReader(f, h.Descroff, h.Descrlen)
+	for i := int64(0); i < h.Dtotal; i++ {
+		var d descriptor
+		if err := binary.Read(r, binary.LittleEndian, &d); err != nil {
+			return nil, errors.Wrap(err, "reading descriptors")
+		}
+		if d.Used {
+			img.descriptors = append(img.descriptors, d)
+		}
+	}
+
+	var root *descriptor
+	for i, d := range img.descriptors {
+		if d.Datatype == dataPartition && d.partition().Parttype == partPrimSys {
+			root = &img.descriptors[i]
+			break
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no primary system partition found")
+	}
+	if fstype := root.partition().Fstype; fstype != fsSquash {
+		name, ok := fsTypes[fstype]
+		if !ok {
+			name = fmt.Sprintf("unknown (%d)", fstype)
+		}
+		return nil, fmt.Errorf("unsupported %s root filesystem, only squashfs is supported", name)
+	}
+	fs, err := OpenSquashFS(io.NewSectionReader(f, root.Fileoff, root.Filelen))
+	if err != nil {
+		return nil, err
+	}
+	img.fs = fs
+	return img, nil
+}
+
+// Close closes the underlying SIF file.
+func (i *Image) Close() error {
+	return i.f.Close()
+}
+
+// RootFS returns the container's root filesystem.
+func (i *Image) RootFS() *SquashFS {
+	return i.fs
+}
+
+// Arch returns the GOARCH name of the architecture the image was built for,
+// or "" if it is unknown.
+func (i *Image) Arch() string {
+	return archs[cstring(i.header.Arch[:])]
+}
+
+// Created returns the time the image was created.
+func (i *Image) Created() time.Time {
+	return time.Unix(i.header.Ctime, 0).UTC()
+}
+
+func (i *Image) data(d descriptor) ([]byte, error) {
+	b := make([]byte, d.Filelen)
+	if _, err := i.f.ReadAt(b, d.Fileoff); err != nil {
+		return nil, errors.Wrapf(err, "reading descriptor %s", cstring(d.Name[:]))
+	}
+	return b, nil
+}
+
+// Labels returns the image labels. these are read from the labels file singularity
+// writes into the container, overridden by any label or JSON metadata descriptors.
+func (i *Image) Labels() (map[string]string, error) {
+	labels := map[string]string{}
+	if b, err := i.fs.ReadFile(labelsFile); err == nil {
+		if err := json.Unmarshal(b, &labels); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", labelsFile)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, d := range i.descriptors {
+		if d.Datatype != dataLabels && d.Datatype != dataGenericJSON {
+			continue
+		}
+		b, err := i.data(d)
+		if err != nil {
+			return nil, err
+		}
+		var l map[string]string
+		if d.Datatype == dataLabels {
+			if err := json.Unmarshal(b, &l); err != nil {
+				return nil, errors.Wrapf(err, "parsing labels descriptor %s", cstring(d.Name[:]))
+			}
+		} else {
+			l = metadataLabels(b)
+		}
+		for k, v := range l {
+			labels[k] = v
+		}
+	}
+	return labels, nil
+}
+
+// metadataLabels extracts labels from a JSON metadata descriptor, which may
+// hold them at the top level or in the attributes singularity inspect reports.
+// descriptors that don't hold labels are ignored.
+func metadataLabels(b []byte) map[string]string {
+	var metadata struct {
+		Labels map[string]string `json:"labels"`
+		Data   struct {
+			Attributes struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return nil
+	}
+	if metadata.Labels != nil {
+		return metadata.Labels
+	}
+	return metadata.Data.Attributes.Labels
+}
+
+// Environment returns the environment variables exported by the scripts singularity
+// sources from /.singularity.d/env when running the container.
+func (i *Image) Environment() (map[string]string, error) {
+	env := map[string]string{}
+	infos, err := i.fs.ReadDir(envDir)
+	if os.IsNotExist(err) {
+		return env, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var scripts []string
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".sh") {
+			scripts = append(scripts, info.Name())
+		}
+	}
+	sort.Strings(scripts)
+	for _, script := range scripts {
+		b, err := i.fs.ReadFile(path.Join(envDir, script))
+		if err != nil {
+			return nil, err
+		}
+		parseEnvScript(b, env)
+	}
+	return env, nil
+}
+
+// parseEnvScript picks out the simple `export KEY=value` statements of an environment
+// script, expanding references to variables exported before them. anything more
+// involved can only be evaluated by a shell in the container, and is skipped.
+func parseEnvScript(script []byte, env map[string]string) {
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "export ") {
+			continue
+		}
+		pair := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "export ")), "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+		key, value := pair[0], pair[1]
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			env[key] = value[1 : len(value)-1]
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		env[key] = os.Expand(value, func(name string) string {
+			// docker converted images use ${VAR:-"default"} to not override the host
+			parts := strings.SplitN(name, ":-", 2)
+			if v := env[parts[0]]; v != "" || len(parts) == 1 {
+				return v
+			}
+			return strings.Trim(parts[1], `"`)
+		})
+	}
+}
@@ -0,0 +1,525 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+const testBlockSize = 4096
+
+type testFile struct {
+	path     string
+	mode     uint16
+	uid, gid uint32
+	contents []byte
+	link     string
+	dir      bool
+}
+
+type testNode struct {
+	file     testFile
+	children map[string]*testNode
+
+	// where the file's data was written
+	blocksStart    uint32
+	blockSizes     []uint32
+	fragment       uint32
+	fragmentOffset uint32
+}
+
+func compress(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// metadataWriter writes a stream of compressed metadata blocks. since a block's
+// position only depends on the blocks before it, references can be taken while writing.
+type metadataWriter struct {
+	t   *testing.T
+	out bytes.Buffer
+	buf []byte
+}
+
+func (w *metadataWriter) pos() (uint32, uint16) {
+	return uint32(w.out.Len()), uint16(len(w.buf))
+}
+
+func (w *metadataWriter) write(v interface{}) {
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, v); err != nil {
+		w.t.Fatal(err)
+	}
+	w.buf = append(w.buf, b.Bytes()...)
+	for len(w.buf) >= metadataBlockSize {
+		w.writeBlock(w.buf[:metadataBlockSize])
+		w.buf = w.buf[metadataBlockSize:]
+	}
+}
+
+func (w *metadataWriter) writeBlock(b []byte) {
+	c := compress(w.t, b)
+	binary.Write(&w.out, binary.LittleEndian, uint16(len(c)))
+	w.out.Write(c)
+}
+
+func (w *metadataWriter) finish() []byte {
+	if len(w.buf) > 0 {
+		w.writeBlock(w.buf)
+		w.buf = nil
+	}
+	return w.out.Bytes()
+}
+
+// buildSquashFS writes a gzip compressed squashfs image holding the given files.
+// file tails are packed into a single fragment block.
+func buildSquashFS(t *testing.T, files []testFile) []byte {
+	root := &testNode{file: testFile{mode: 0755, dir: true}, children: map[string]*testNode{}}
+	for _, f := range files {
+		parent := root
+		parts := splitPath(f.path)
+		for _, part := range parts[:len(parts)-1] {
+			parent = parent.children[part]
+		}
+		node := &testNode{file: f}
+		if f.dir {
+			node.children = map[string]*testNode{}
+		}
+		parent.children[parts[len(parts)-1]] = node
+	}
+
+	data := bytes.NewBuffer(make([]byte, 96))
+	var fragment []byte
+	var regular []*testNode
+	var collect func(n *testNode)
+	collect = func(n *testNode) {
+		if !n.file.dir && n.file.link == "" {
+			regular = append(regular, n)
+		}
+		for _, name := range sortedChildren(n) {
+			collect(n.children[name])
+		}
+	}
+	collect(root)
+	for _, n := range regular {
+		n.blocksStart = uint32(data.Len())
+		contents := n.file.contents
+		for len(contents) >= testBlockSize {
+			block := contents[:testBlockSize]
+			contents = contents[testBlockSize:]
+			if c := compress(t, block); len(c) < len(block) {
+				data.Write(c)
+				n.blockSizes = append(n.blockSizes, uint32(len(c)))
+			} else {
+				data.Write(block)
+				n.blockSizes = append(n.blockSizes, uint32(len(block))|dataUncompressed)
+			}
+		}
+		n.fragment = noFragment
+		if len(contents) > 0 {
+			n.fragment = 0
+			n.fragmentOffset = uint32(len(fragment))
+			fragment = append(fragment, contents...)
+		}
+	}
+	fragmentStart := uint64(data.Len())
+	compressedFragment := compress(t, fragment)
+	data.Write(compressedFragment)
+
+	ids := map[uint32]uint16{}
+	var idList []uint32
+	id := func(i uint32) uint16 {
+		if _, ok := ids[i]; !ok {
+			ids[i] = uint16(len(idList))
+			idList = append(idList, i)
+		}
+		return ids[i]
+	}
+
+	inodes := &metadataWriter{t: t}
+	dirs := &metadataWriter{t: t}
+	var count uint32
+	var writeNode func(n *testNode) (uint64, uint32, uint16)
+	writeNode = func(n *testNode) (uint64, uint32, uint16) {
+		f := n.file
+		var typ uint16
+		var listingBlock uint32
+		var listingOffset uint16
+		var listingSize int
+		if f.dir {
+			typ = dirType
+			type child struct {
+				name   string
+				ref    uint64
+				number uint32
+				typ    uint16
+			}
+			var children []child
+			for _, name := range sortedChildren(n) {
+				ref, number, typ := writeNode(n.children[name])
+				children = append(children, child{name, ref, number, typ})
+			}
+			listingBlock, listingOffset = dirs.pos()
+			for _, c := range children {
+				dirs.write([]uint32{0, uint32(c.ref >> 16), c.number})
+				dirs.write([]uint16{uint16(c.ref & 0xffff), 0, c.typ, uint16(len(c.name) - 1)})
+				dirs.write([]byte(c.name))
+				listingSize += 20 + len(c.name)
+			}
+		} else if f.link != "" {
+			typ = symlinkType
+		} else {
+			typ = fileType
+		}
+
+		count++
+		block, offset := inodes.pos()
+		inodes.write(inodeHeader{
+			Type:        typ,
+			Permissions: f.mode,
+			UIDIndex:    id(f.uid),
+			GIDIndex:    id(f.gid),
+			Mtime:       1500000000,
+			InodeNumber: count,
+		})
+		switch typ {
+		case dirType:
+			inodes.write([]uint32{listingBlock, 2})
+			inodes.write([]uint16{uint16(listingSize + 3), listingOffset})
+			inodes.write(uint32(0))
+		case symlinkType:
+			inodes.write([]uint32{1, uint32(len(f.link))})
+			inodes.write([]byte(f.link))
+		case fileType:
+			inodes.write([]uint32{n.blocksStart, n.fragment, n.fragmentOffset, uint32(len(f.contents))})
+			inodes.write(n.blockSizes)
+		}
+		return uint64(block)<<16 | uint64(offset), count, typ
+	}
+	rootRef, _, _ := writeNode(root)
+
+	sb := superblock{
+		Magic:              squashfsMagic,
+		InodeCount:         count,
+		ModificationTime:   1500000000,
+		BlockSize:          testBlockSize,
+		FragmentEntryCount: 1,
+		CompressionID:      1,
+		BlockLog:           12,
+		IDCount:            uint16(len(idList)),
+		VersionMajor:       4,
+		RootInodeRef:       rootRef,
+		XattrIDTableStart:  ^uint64(0),
+		ExportTableStart:   ^uint64(0),
+	}
+	sb.InodeTableStart = uint64(data.Len())
+	data.Write(inodes.finish())
+	sb.DirectoryTableStart = uint64(data.Len())
+	data.Write(dirs.finish())
+
+	fragmentTable := &metadataWriter{t: t}
+	fragmentTable.write(struct {
+		Start  uint64
+		Size   uint32
+		Unused uint32
+	}{fragmentStart, uint32(len(compressedFragment)), 0})
+	fragmentBlock := uint64(data.Len())
+	data.Write(fragmentTable.finish())
+	sb.FragmentTableStart = uint64(data.Len())
+	binary.Write(data, binary.LittleEndian, fragmentBlock)
+
+	idTable := &metadataWriter{t: t}
+	idTable.write(idList)
+	idBlock := uint64(data.Len())
+	data.Write(idTable.finish())
+	sb.IDTableStart = uint64(data.Len())
+	binary.Write(data, binary.LittleEndian, idBlock)
+	sb.BytesUsed = uint64(data.Len())
+
+	b := data.Bytes()
+	var header bytes.Buffer
+	binary.Write(&header, binary.LittleEndian, sb)
+	copy(b, header.Bytes())
+	return b
+}
+
+func sortedChildren(n *testNode) []string {
+	var names []string
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type testDescriptor struct {
+	datatype  int32
+	partition *partition
+	data      []byte
+}
+
+// buildSIF writes a SIF file with the given descriptors and returns its path.
+const testCtime = 1546300800
+
+func buildSIF(t *testing.T, descs []testDescriptor) string {
+	const descriptorSize = 585
+	h := header{
+		Dtotal:   int64(len(descs)),
+		Descroff: 128,
+		Descrlen: int64(len(descs)) * descriptorSize,
+	}
+	copy(h.Magic[:], sifMagic)
+	copy(h.Version[:], sifVersion)
+	copy(h.Arch[:], "02")
+	h.Ctime = testCtime
+	h.Dataoff = h.Descroff + h.Descrlen
+
+	var descriptors, data bytes.Buffer
+	for i, d := range descs {
+		raw := descriptor{
+			Datatype: d.datatype,
+			Used:     true,
+			ID:       uint32(i + 1),
+			Fileoff:  h.Dataoff + int64(data.Len()),
+			Filelen:  int64(len(d.data)),
+		}
+		if d.partition != nil {
+			var extra bytes.Buffer
+			binary.Write(&extra, binary.LittleEndian, d.partition)
+			copy(raw.Extra[:], extra.Bytes())
+		}
+		binary.Write(&descriptors, binary.LittleEndian, raw)
+		data.Write(d.data)
+	}
+	h.Datalen = int64(data.Len())
+
+	f, err := ioutil.TempFile("", "test-*.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	binary.Write(f, binary.LittleEndian, h)
+	f.Write(descriptors.Bytes())
+	f.Write(data.Bytes())
+	return f.Name()
+}
+
+func testFiles() []testFile {
+	random := make([]byte, 2*testBlockSize+100)
+	rand.New(rand.NewSource(1)).Read(random)
+	files := []testFile{
+		{path: "etc", mode: 0755, dir: true},
+		{path: "etc/config", mode: 0640, uid: 1000, gid: 100, contents: []byte("key=value\n")},
+		{path: "etc/empty", mode: 0644},
+		{path: "usr", mode: 0755, dir: true},
+		{path: "usr/bin", mode: 0755, dir: true},
+		{path: "usr/bin/tool", mode: 04755, contents: []byte(strings.Repeat("tool", 3000))},
+		{path: "usr/bin/random", mode: 0755, contents: random},
+		{path: "bin", mode: 0777, link: "/usr/bin"},
+		{path: "etc/link", mode: 0777, link: "../etc/config"},
+		{path: "many", mode: 0755, dir: true},
+		{path: ".singularity.d", mode: 0755, dir: true},
+		{path: ".singularity.d/labels.json", mode: 0644, contents: []byte(`{"maintainer": "someone", "version": "1"}`)},
+		{path: ".singularity.d/env", mode: 0755, dir: true},
+		{path: ".singularity.d/env/10-docker2singularity.sh", mode: 0755, contents: []byte(
+			"#!/bin/sh\nexport PATH=\"/usr/local/bin:/usr/bin\"\nexport LANG=\"${LANG:-\"C.UTF-8\"}\"\n")},
+		{path: ".singularity.d/env/90-environment.sh", mode: 0755, contents: []byte(
+			"#!/bin/sh\n# custom environment\nexport PATH=\"/opt/app/bin:$PATH\"\nexport GREETING='hello $USER'\nexport\nif true; then\n  export INDENTED=yes\nfi\n")},
+	}
+	// enough entries for the inode and directory tables to span several metadata blocks
+	for i := 0; i < 400; i++ {
+		files = append(files, testFile{path: fmt.Sprintf("many/file-%03d", i), mode: 0644, contents: []byte(fmt.Sprint(i))})
+	}
+	return files
+}
+
+func TestSquashFS(t *testing.T) {
+	files := testFiles()
+	fs, err := OpenSquashFS(bytes.NewReader(buildSquashFS(t, files)))
+	if err != nil {
+		t.Fatalf("opening squashfs: %s", err)
+	}
+
+	for _, f := range files {
+		if f.dir || f.link != "" {
+			continue
+		}
+		contents, err := fs.ReadFile(f.path)
+		if err != nil {
+			t.Errorf("reading %s: %s", f.path, err)
+			continue
+		}
+		if !bytes.Equal(contents, f.contents) {
+			t.Errorf("incorrect contents for %s: got %d bytes, expected %d", f.path, len(contents), len(f.contents))
+		}
+		rc, err := fs.Open(f.path)
+		if err != nil {
+			t.Errorf("opening %s: %s", f.path, err)
+			continue
+		}
+		contents, err = ioutil.ReadAll(iotest.OneByteReader(rc))
+		rc.Close()
+		if err != nil {
+			t.Errorf("streaming %s: %s", f.path, err)
+		} else if !bytes.Equal(contents, f.contents) {
+			t.Errorf("incorrect streamed contents for %s: got %d bytes, expected %d", f.path, len(contents), len(f.contents))
+		}
+	}
+
+	info, err := fs.Stat("/etc/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "-rw-r-----", info.Mode().String())
+	testutil.CheckDeepEqual(t, int64(10), info.Size())
+	header := info.Sys().(*tar.Header)
+	testutil.CheckDeepEqual(t, 1000, header.Uid)
+	testutil.CheckDeepEqual(t, 100, header.Gid)
+
+	info, err = fs.Stat("/bin/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "urwxr-xr-x", info.Mode().String())
+
+	info, err = fs.Lstat("/bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, os.ModeSymlink, info.Mode()&os.ModeType)
+	target, err := fs.Readlink("/bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "/usr/bin", target)
+
+	contents, err := fs.ReadFile("/etc/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "key=value\n", string(contents))
+
+	infos, err := fs.ReadDir("/many")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, 400, len(infos))
+	testutil.CheckDeepEqual(t, "file-399", infos[399].Name())
+
+	infos, err = fs.ReadDir("/bin/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	testutil.CheckDeepEqual(t, []string{"random", "tool"}, names)
+
+	if _, err := fs.Stat("/etc/missing"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error for missing file, got %v", err)
+	}
+	if _, err := fs.ReadFile("/etc"); err == nil {
+		t.Errorf("expected error reading directory")
+	}
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	b := buildSquashFS(t, nil)
+	// compression id is at offset 20 in the superblock
+	binary.LittleEndian.PutUint16(b[20:], 4)
+	_, err := OpenSquashFS(bytes.NewReader(b))
+	if err == nil || !strings.Contains(err.Error(), "xz") {
+		t.Errorf("expected unsupported xz compression error, got %v", err)
+	}
+}
+
+func TestImage(t *testing.T) {
+	path := buildSIF(t, []testDescriptor{
+		{datatype: dataDeffile, data: []byte("bootstrap: docker\nfrom: alpine\n")},
+		{datatype: dataPartition, partition: &partition{Fstype: fsSquash, Parttype: partPrimSys}, data: buildSquashFS(t, testFiles())},
+		{datatype: dataLabels, data: []byte(`{"version": "2"}`)},
+		{datatype: dataGenericJSON, data: []byte(`{"data": {"attributes": {"labels": {"org.label-schema.name": "test"}}}}`)},
+	})
+	defer os.Remove(path)
+
+	img, err := Open(path)
+	if err != nil {
+		t.Fatalf("opening image: %s", err)
+	}
+	defer img.Close()
+
+	testutil.CheckDeepEqual(t, "amd64", img.Arch())
+	testutil.CheckDeepEqual(t, time.Unix(testCtime, 0).UTC(), img.Created())
+
+	labels, err := img.Labels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, map[string]string{
+		"maintainer":            "someone",
+		"version":               "2",
+		"org.label-schema.name": "test",
+	}, labels)
+
+	env, err := img.Environment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, map[string]string{
+		"PATH":     "/opt/app/bin:/usr/local/bin:/usr/bin",
+		"LANG":     "C.UTF-8",
+		"GREETING": "hello $USER",
+		"INDENTED": "yes",
+	}, env)
+
+	contents, err := img.RootFS().ReadFile("/etc/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, "key=value\n", string(contents))
+}
+
+func TestImageWithoutSquashFS(t *testing.T) {
+	path := buildSIF(t, []testDescriptor{
+		{datatype: dataPartition, partition: &partition{Fstype: fsExt3, Parttype: partPrimSys}, data: []byte("ext3")},
+	})
+	defer os.Remove(path)
+
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "ext3") {
+		t.Errorf("expected unsupported ext3 error, got %v", err)
+	}
+}
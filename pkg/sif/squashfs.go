@@ -0,0 +1,754 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	squashfsMagic = 0x73717368
+
+	// metadata blocks are at most 8KiB uncompressed, with a two byte header
+	metadataBlockSize    = 8192
+	metadataUncompressed = 0x8000
+
+	dataUncompressed = 1 << 24
+	noFragment       = 0xffffffff
+
+	fragmentEntrySize       = 16
+	fragmentEntriesPerBlock = metadataBlockSize / fragmentEntrySize
+
+	// symlinks are followed at most this many times when resolving a path
+	maxSymlinks = 40
+)
+
+// inode types
+const (
+	dirType = iota + 1
+	fileType
+	symlinkType
+	blockDevType
+	charDevType
+	fifoType
+	socketType
+	extDirType
+	extFileType
+	extSymlinkType
+	extBlockDevType
+	extCharDevType
+	extFifoType
+	extSocketType
+)
+
+var compressors = map[uint16]string{
+	1: "gzip",
+	2: "lzma",
+	3: "lzo",
+	4: "xz",
+	5: "lz4",
+	6: "zstd",
+}
+
+type superblock struct {
+	Magic               uint32
+	InodeCount          uint32
+	ModificationTime    uint32
+	BlockSize           uint32
+	FragmentEntryCount  uint32
+	CompressionID       uint16
+	BlockLog            uint16
+	Flags               uint16
+	IDCount             uint16
+	VersionMajor        uint16
+	VersionMinor        uint16
+	RootInodeRef        uint64
+	BytesUsed           uint64
+	IDTableStart        uint64
+	XattrIDTableStart   uint64
+	InodeTableStart     uint64
+	DirectoryTableStart uint64
+	FragmentTableStart  uint64
+	ExportTableStart    uint64
+}
+
+type inodeHeader struct {
+	Type        uint16
+	Permissions uint16
+	UIDIndex    uint16
+	GIDIndex    uint16
+	Mtime       uint32
+	InodeNumber uint32
+}
+
+type inode struct {
+	inodeHeader
+	uid, gid uint32
+
+	// directories
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32
+
+	// regular files
+	blocksStart    uint64
+	fileSize       uint64
+	fragment       uint32
+	fragmentOffset uint32
+	blockSizes     []uint32
+
+	// symlinks
+	target string
+
+	// devices
+	device uint32
+}
+
+func (in *inode) isDir() bool {
+	return in.Type == dirType || in.Type == extDirType
+}
+
+func (in *inode) isSymlink() bool {
+	return in.Type == symlinkType || in.Type == extSymlinkType
+}
+
+// header describes the inode as a tar header, so that the returned file infos
+// carry ownership information in the same way as the other drivers.
+func (in *inode) header(name string) *tar.Header {
+	h := &tar.Header{
+		Name:    name,
+		Mode:    int64(in.Permissions & 07777),
+		Uid:     int(in.uid),
+		Gid:     int(in.gid),
+		ModTime: time.Unix(int64(in.Mtime), 0),
+	}
+	switch in.Type {
+	case dirType, extDirType:
+		h.Typeflag = tar.TypeDir
+	case fileType, extFileType:
+		h.Typeflag = tar.TypeReg
+		h.Size = int64(in.fileSize)
+	case symlinkType, extSymlinkType:
+		h.Typeflag = tar.TypeSymlink
+		h.Linkname = in.target
+	case blockDevType, extBlockDevType:
+		h.Typeflag = tar.TypeBlock
+	case charDevType, extCharDevType:
+		h.Typeflag = tar.TypeChar
+	case fifoType, extFifoType:
+		h.Typeflag = tar.TypeFifo
+	}
+	if h.Typeflag == tar.TypeBlock || h.Typeflag == tar.TypeChar {
+		// device numbers use the same encoding as the linux kernel's new_encode_dev
+		h.Devmajor = int64((in.device & 0xfff00) >> 8)
+		h.Devminor = int64((in.device & 0xff) | ((in.device >> 12) & 0xfff00))
+	}
+	return h
+}
+
+type fileInfo struct {
+	os.FileInfo
+	header *tar.Header
+}
+
+func (fi fileInfo) Sys() interface{} {
+	return fi.header
+}
+
+func (in *inode) fileInfo(name string) os.FileInfo {
+	h := in.header(name)
+	fi := fileInfo{FileInfo: h.FileInfo(), header: h}
+	if in.Type == socketType || in.Type == extSocketType {
+		return socketInfo{fi}
+	}
+	return fi
+}
+
+// tar has no socket type, so sockets report their mode directly
+type socketInfo struct {
+	fileInfo
+}
+
+func (fi socketInfo) Mode() os.FileMode {
+	return fi.fileInfo.Mode()&os.ModePerm | os.ModeSocket
+}
+
+type dirEntry struct {
+	name  string
+	inode uint64
+}
+
+// SquashFS reads files from a squashfs filesystem image. Only gzip compressed
+// images, the default for singularity, are supported.
+type SquashFS struct {
+	r   io.ReaderAt
+	sb  superblock
+	ids []uint32
+}
+
+// OpenSquashFS reads the superblock and id table of the squashfs image in r.
+func OpenSquashFS(r io.ReaderAt) (*SquashFS, error) {
+	fs := &SquashFS{r: r}
+	if err := binary.Read(io.NewSectionReader(r, 0, 96), binary.LittleEndian, &fs.sb); err != nil {
+		return nil, errors.Wrap(err, "reading squashfs superblock")
+	}
+	if fs.sb.Magic != squashfsMagic {
+		return nil, errors.New("not a squashfs filesystem")
+	}
+	if fs.sb.VersionMajor != 4 {
+		return nil, fmt.Errorf("unsupported squashfs version %d.%d", fs.sb.VersionMajor, fs.sb.VersionMinor)
+	}
+	if fs.sb.CompressionID != 1 {
+		name, ok := compressors[fs.sb.CompressionID]
+		if !ok {
+			name = fmt.Sprintf("unknown (%d)", fs.sb.CompressionID)
+		}
+		return nil, fmt.Errorf("unsupported squashfs compression %s, only gzip is supported", name)
+	}
+	if err := fs.readIDs(); err != nil {
+		return nil, errors.Wrap(err, "reading squashfs id table")
+	}
+	return fs, nil
+}
+
+func (fs *SquashFS) decompress(b []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// readMetadataBlock returns the contents of the metadata block at pos, along with
+// the position of the block following it.
+func (fs *SquashFS) readMetadataBlock(pos int64) ([]byte, int64, error) {
+	var header [2]byte
+	if _, err := fs.r.ReadAt(header[:], pos); err != nil {
+		return nil, 0, err
+	}
+	h := binary.LittleEndian.Uint16(header[:])
+	size := int64(h &^ metadataUncompressed)
+	data := make([]byte, size)
+	if _, err := fs.r.ReadAt(data, pos+2); err != nil {
+		return nil, 0, err
+	}
+	next := pos + 2 + size
+	if h&metadataUncompressed != 0 {
+		return data, next, nil
+	}
+	data, err := fs.decompress(data)
+	return data, next, err
+}
+
+// metadataReader reads a stream of consecutive metadata blocks.
+type metadataReader struct {
+	fs   *SquashFS
+	next int64
+	buf  []byte
+}
+
+func (fs *SquashFS) metadataReader(pos int64, offset uint16) (*metadataReader, error) {
+	data, next, err := fs.readMetadataBlock(pos)
+	if err != nil {
+		return nil, err
+	}
+	if int(offset) > len(data) {
+		return nil, fmt.Errorf("metadata offset %d out of range", offset)
+	}
+	return &metadataReader{fs: fs, next: next, buf: data[offset:]}, nil
+}
+
+func (m *metadataReader) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		data, next, err := m.fs.readMetadataBlock(m.next)
+		if err != nil {
+			return 0, err
+		}
+		m.buf, m.next = data, next
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+func (m *metadataReader) read(v interface{}) error {
+	return binary.Read(m, binary.LittleEndian, v)
+}
+
+func (fs *SquashFS) readIDs() error {
+	if fs.sb.IDCount == 0 {
+		return nil
+	}
+	var loc [8]byte
+	if _, err := fs.r.ReadAt(loc[:], int64(fs.sb.IDTableStart)); err != nil {
+		return err
+	}
+	// the id blocks are stored back to back, so they can be read as one stream
+	m, err := fs.metadataReader(int64(binary.LittleEndian.Uint64(loc[:])), 0)
+	if err != nil {
+		return err
+	}
+	fs.ids = make([]uint32, fs.sb.IDCount)
+	return m.read(fs.ids)
+}
+
+func (fs *SquashFS) id(i uint16) (uint32, error) {
+	if int(i) >= len(fs.ids) {
+		return 0, fmt.Errorf("id index %d out of range", i)
+	}
+	return fs.ids[i], nil
+}
+
+func (fs *SquashFS) readInode(ref uint64) (*inode, error) {
+	m, err := fs.metadataReader(int64(fs.sb.InodeTableStart+ref>>16), uint16(ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+	in := &inode{}
+	if err := m.read(&in.inodeHeader); err != nil {
+		return nil, err
+	}
+	if in.uid, err = fs.id(in.UIDIndex); err != nil {
+		return nil, err
+	}
+	if in.gid, err = fs.id(in.GIDIndex); err != nil {
+		return nil, err
+	}
+
+	switch in.Type {
+	case dirType:
+		var d struct {
+			BlockIndex  uint32
+			LinkCount   uint32
+			FileSize    uint16
+			BlockOffset uint16
+			ParentInode uint32
+		}
+		err = m.read(&d)
+		in.dirBlock, in.dirOffset, in.dirSize = d.BlockIndex, d.BlockOffset, uint32(d.FileSize)
+	case extDirType:
+		var d struct {
+			LinkCount   uint32
+			FileSize    uint32
+			BlockIndex  uint32
+			ParentInode uint32
+			IndexCount  uint16
+			BlockOffset uint16
+			XattrIndex  uint32
+		}
+		err = m.read(&d)
+		in.dirBlock, in.dirOffset, in.dirSize = d.BlockIndex, d.BlockOffset, d.FileSize
+	case fileType:
+		var f struct {
+			BlocksStart    uint32
+			Fragment       uint32
+			FragmentOffset uint32
+			FileSize       uint32
+		}
+		if err = m.read(&f); err == nil {
+			in.blocksStart, in.fileSize = uint64(f.BlocksStart), uint64(f.FileSize)
+			in.fragment, in.fragmentOffset = f.Fragment, f.FragmentOffset
+			err = fs.readBlockSizes(m, in)
+		}
+	case extFileType:
+		var f struct {
+			BlocksStart    uint64
+			FileSize       uint64
+			Sparse         uint64
+			LinkCount      uint32
+			Fragment       uint32
+			FragmentOffset uint32
+			XattrIndex     uint32
+		}
+		if err = m.read(&f); err == nil {
+			in.blocksStart, in.fileSize = f.BlocksStart, f.FileSize
+			in.fragment, in.fragmentOffset = f.Fragment, f.FragmentOffset
+			err = fs.readBlockSizes(m, in)
+		}
+	case symlinkType, extSymlinkType:
+		var s struct {
+			LinkCount  uint32
+			TargetSize uint32
+		}
+		if err = m.read(&s); err == nil {
+			target := make([]byte, s.TargetSize)
+			_, err = io.ReadFull(m, target)
+			in.target = string(target)
+		}
+	case blockDevType, charDevType, extBlockDevType, extCharDevType:
+		var d struct {
+			LinkCount uint32
+			Device    uint32
+		}
+		err = m.read(&d)
+		in.device = d.Device
+	case fifoType, socketType, extFifoType, extSocketType:
+	default:
+		return nil, fmt.Errorf("unknown inode type %d", in.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading inode %d", in.InodeNumber)
+	}
+	return in, nil
+}
+
+func (fs *SquashFS) readBlockSizes(m *metadataReader, in *inode) error {
+	blockSize := uint64(fs.sb.BlockSize)
+	count := in.fileSize / blockSize
+	if in.fragment == noFragment && in.fileSize%blockSize != 0 {
+		count++
+	}
+	in.blockSizes = make([]uint32, count)
+	return m.read(in.blockSizes)
+}
+
+func (fs *SquashFS) readDir(in *inode) ([]dirEntry, error) {
+	// the stored size includes the implicit . and .. entries
+	if in.dirSize <= 3 {
+		return nil, nil
+	}
+	m, err := fs.metadataReader(int64(fs.sb.DirectoryTableStart)+int64(in.dirBlock), in.dirOffset)
+	if err != nil {
+		return nil, err
+	}
+	lr := io.LimitReader(m, int64(in.dirSize-3))
+	var entries []dirEntry
+	for {
+		var header struct {
+			Count       uint32
+			Start       uint32
+			InodeNumber uint32
+		}
+		if err := binary.Read(lr, binary.LittleEndian, &header); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return nil, err
+		}
+		for i := uint32(0); i <= header.Count; i++ {
+			var entry struct {
+				Offset      uint16
+				InodeOffset int16
+				Type        uint16
+				NameSize    uint16
+			}
+			if err := binary.Read(lr, binary.LittleEndian, &entry); err != nil {
+				return nil, err
+			}
+			name := make([]byte, int(entry.NameSize)+1)
+			if _, err := io.ReadFull(lr, name); err != nil {
+				return nil, err
+			}
+			entries = append(entries, dirEntry{
+				name:  string(name),
+				inode: uint64(header.Start)<<16 | uint64(entry.Offset),
+			})
+		}
+	}
+}
+
+func (fs *SquashFS) readFragment(index uint32) ([]byte, error) {
+	var loc [8]byte
+	if _, err := fs.r.ReadAt(loc[:], int64(fs.sb.FragmentTableStart)+8*int64(index/fragmentEntriesPerBlock)); err != nil {
+		return nil, err
+	}
+	m, err := fs.metadataReader(int64(binary.LittleEndian.Uint64(loc[:])), uint16(index%fragmentEntriesPerBlock*fragmentEntrySize))
+	if err != nil {
+		return nil, err
+	}
+	var entry struct {
+		Start  uint64
+		Size   uint32
+		Unused uint32
+	}
+	if err := m.read(&entry); err != nil {
+		return nil, err
+	}
+	return fs.readDataBlock(int64(entry.Start), entry.Size)
+}
+
+func (fs *SquashFS) readDataBlock(pos int64, size uint32) ([]byte, error) {
+	data := make([]byte, size&^dataUncompressed)
+	if _, err := fs.r.ReadAt(data, pos); err != nil {
+		return nil, err
+	}
+	if size&dataUncompressed != 0 {
+		return data, nil
+	}
+	return fs.decompress(data)
+}
+
+// fileReader reads the contents of a file one data block at a time, followed
+// by its tail end in a fragment block.
+type fileReader struct {
+	fs           *SquashFS
+	in           *inode
+	block        int    // index of the next data block
+	pos          int64  // position of the next data block in the image
+	read         uint64 // bytes of the file read so far
+	fragmentRead bool
+	buf          []byte
+}
+
+func (fs *SquashFS) newFileReader(in *inode) *fileReader {
+	return &fileReader{fs: fs, in: in, pos: int64(in.blocksStart)}
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// next fills the buffer with the next block of the file.
+func (r *fileReader) next() error {
+	if r.read > r.in.fileSize {
+		return fmt.Errorf("read %d bytes but expected %d", r.read, r.in.fileSize)
+	}
+	if r.block < len(r.in.blockSizes) {
+		size := r.in.blockSizes[r.block]
+		r.block++
+		if size&^dataUncompressed == 0 {
+			// sparse block
+			n := r.in.fileSize - r.read
+			if n > uint64(r.fs.sb.BlockSize) {
+				n = uint64(r.fs.sb.BlockSize)
+			}
+			r.buf = make([]byte, n)
+		} else {
+			data, err := r.fs.readDataBlock(r.pos, size)
+			if err != nil {
+				return err
+			}
+			r.buf = data
+			r.pos += int64(size &^ dataUncompressed)
+		}
+		r.read += uint64(len(r.buf))
+		return nil
+	}
+	if r.in.fragment != noFragment && !r.fragmentRead {
+		r.fragmentRead = true
+		data, err := r.fs.readFragment(r.in.fragment)
+		if err != nil {
+			return errors.Wrap(err, "reading fragment")
+		}
+		end := uint64(r.in.fragmentOffset) + r.in.fileSize - r.read
+		if end > uint64(len(data)) {
+			return errors.New("fragment out of range")
+		}
+		r.buf = data[r.in.fragmentOffset:end]
+		r.read += uint64(len(r.buf))
+		return nil
+	}
+	if r.read != r.in.fileSize {
+		return fmt.Errorf("read %d bytes but expected %d", r.read, r.in.fileSize)
+	}
+	return io.EOF
+}
+
+func (fs *SquashFS) readFile(in *inode) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, in.fileSize))
+	if _, err := out.ReadFrom(fs.newFileReader(in)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// lookup resolves a path to its inode, following symlinks in every component
+// but the last unless follow is set. symlinks can't escape the root.
+func (fs *SquashFS) lookup(name string, follow bool) (*inode, error) {
+	in, err := fs.readInode(fs.sb.RootInodeRef)
+	if err != nil {
+		return nil, err
+	}
+	var dir []*inode
+	parts := splitPath(name)
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case ".":
+			continue
+		case "..":
+			if len(dir) > 0 {
+				in, dir = dir[len(dir)-1], dir[:len(dir)-1]
+			}
+			continue
+		}
+		if !in.isDir() {
+			return nil, errors.New("not a directory")
+		}
+		entries, err := fs.readDir(in)
+		if err != nil {
+			return nil, err
+		}
+		var child *inode
+		for _, e := range entries {
+			if e.name == part {
+				if child, err = fs.readInode(e.inode); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+		if child == nil {
+			return nil, os.ErrNotExist
+		}
+		if child.isSymlink() && (len(parts) > 0 || follow) {
+			links++
+			if links > maxSymlinks {
+				return nil, errors.New("too many levels of symbolic links")
+			}
+			if strings.HasPrefix(child.target, "/") {
+				root, err := fs.readInode(fs.sb.RootInodeRef)
+				if err != nil {
+					return nil, err
+				}
+				in, dir = root, nil
+			}
+			parts = append(splitPath(child.target), parts...)
+			continue
+		}
+		dir = append(dir, in)
+		in = child
+	}
+	return in, nil
+}
+
+func splitPath(name string) []string {
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func pathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// Stat returns a file info describing the named file, following symlinks.
+func (fs *SquashFS) Stat(name string) (os.FileInfo, error) {
+	in, err := fs.lookup(name, true)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return in.fileInfo(path.Base(name)), nil
+}
+
+// Lstat returns a file info describing the named file, without following a
+// symlink in the last path component.
+func (fs *SquashFS) Lstat(name string) (os.FileInfo, error) {
+	in, err := fs.lookup(name, false)
+	if err != nil {
+		return nil, pathError("lstat", name, err)
+	}
+	return in.fileInfo(path.Base(name)), nil
+}
+
+// regularFile resolves the named file, failing if it isn't a regular file.
+func (fs *SquashFS) regularFile(name string) (*inode, error) {
+	in, err := fs.lookup(name, true)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if in.isDir() {
+		return nil, pathError("read", name, errors.New("is a directory"))
+	}
+	if in.Type != fileType && in.Type != extFileType {
+		return nil, pathError("read", name, errors.New("not a regular file"))
+	}
+	return in, nil
+}
+
+// Open returns a reader for the contents of the named file, which reads the
+// file a block at a time rather than all at once.
+func (fs *SquashFS) Open(name string) (io.ReadCloser, error) {
+	in, err := fs.regularFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(fs.newFileReader(in)), nil
+}
+
+// ReadFile returns the contents of the named file.
+func (fs *SquashFS) ReadFile(name string) ([]byte, error) {
+	in, err := fs.regularFile(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := fs.readFile(in)
+	if err != nil {
+		return nil, pathError("read", name, err)
+	}
+	return b, nil
+}
+
+// ReadDir returns file infos for the entries of the named directory, sorted by name.
+func (fs *SquashFS) ReadDir(name string) ([]os.FileInfo, error) {
+	in, err := fs.lookup(name, true)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if !in.isDir() {
+		return nil, pathError("readdirent", name, errors.New("not a directory"))
+	}
+	entries, err := fs.readDir(in)
+	if err != nil {
+		return nil, pathError("readdirent", name, err)
+	}
+	var infos []os.FileInfo
+	for _, e := range entries {
+		child, err := fs.readInode(e.inode)
+		if err != nil {
+			return nil, pathError("readdirent", name, err)
+		}
+		infos = append(infos, child.fileInfo(e.name))
+	}
+	return infos, nil
+}
+
+// Readlink returns the target of the named symlink.
+func (fs *SquashFS) Readlink(name string) (string, error) {
+	in, err := fs.lookup(name, false)
+	if err != nil {
+		return "", pathError("readlink", name, err)
+	}
+	if !in.isSymlink() {
+		return "", pathError("readlink", name, errors.New("invalid argument"))
+	}
+	return in.target, nil
+}
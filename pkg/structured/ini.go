@@ -0,0 +1,74 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package structured
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseINI parses an INI file into an object of sections, each an object of
+// string values. keys before the first section are at the top level. as in
+// python's configparser, lines starting with ; or # are comments, keys and
+// values can be separated by = or :, keys may have no value, and indented
+// lines continue the previous value.
+func parseINI(s string) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	section := root
+	lastKey := ""
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if lastKey != "" && (line[0] == ' ' || line[0] == '\t') {
+			section[lastKey] = strings.TrimPrefix(section[lastKey].(string)+"\n"+trimmed, "\n")
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			if !strings.HasSuffix(trimmed, "]") {
+				return nil, fmt.Errorf("line %d: invalid section header %s", i+1, trimmed)
+			}
+			name := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			// sections repeated later in the file are merged
+			existing, ok := root[name].(map[string]interface{})
+			if !ok {
+				existing = map[string]interface{}{}
+				root[name] = existing
+			}
+			section = existing
+			lastKey = ""
+			continue
+		}
+		key, value := trimmed, ""
+		if sep := strings.IndexAny(trimmed, "=:"); sep >= 0 {
+			key, value = strings.TrimSpace(trimmed[:sep]), strings.TrimSpace(trimmed[sep+1:])
+		}
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", i+1)
+		}
+		section[key] = unquote(value)
+		lastKey = key
+	}
+	return root, nil
+}
+
+// unquote removes matching quotes around a value.
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package structured
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type step struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// Query selects values in a document with a subset of JSONPath: an optional
+// leading $, followed by .key, ['key'], [index] (negative from the end), and
+// .* or [*] to select every element. the leading $. can be left out, as in
+// server.port.
+type Query struct {
+	expr  string
+	steps []step
+}
+
+// ParseQuery parses a query expression.
+func ParseQuery(expr string) (*Query, error) {
+	q := &Query{expr: expr}
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+	} else if s != "" && s[0] != '.' && s[0] != '[' {
+		s = "." + s
+	}
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			key := s[:end]
+			s = s[end:]
+			switch key {
+			case "":
+				return nil, fmt.Errorf("invalid query %s: empty key", expr)
+			case "*":
+				q.steps = append(q.steps, step{wildcard: true})
+			default:
+				q.steps = append(q.steps, step{key: key})
+			}
+		case '[':
+			if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+				end := strings.Index(s[2:], string(s[1])+"]")
+				if end < 0 {
+					return nil, fmt.Errorf("invalid query %s: unterminated key", expr)
+				}
+				q.steps = append(q.steps, step{key: s[2 : 2+end]})
+				s = s[2+end+2:]
+				continue
+			}
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid query %s: missing ]", expr)
+			}
+			sub := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			if sub == "*" {
+				q.steps = append(q.steps, step{wildcard: true})
+				continue
+			}
+			i, err := strconv.Atoi(sub)
+			if err != nil {
+				return nil, fmt.Errorf("invalid query %s: invalid index %s", expr, sub)
+			}
+			q.steps = append(q.steps, step{index: i, isIndex: true})
+		default:
+			return nil, fmt.Errorf("invalid query %s: unexpected %q", expr, s[0])
+		}
+	}
+	return q, nil
+}
+
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Find returns every value in a normalized document selected by the query,
+// which is empty if none are.
+func (q *Query) Find(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+	for _, st := range q.steps {
+		var next []interface{}
+		for _, v := range current {
+			next = append(next, st.apply(v)...)
+		}
+		current = next
+	}
+	return current
+}
+
+func (st step) apply(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if st.wildcard {
+			return values(v)
+		}
+		if e, ok := v[st.key]; ok && !st.isIndex {
+			return []interface{}{e}
+		}
+	case []interface{}:
+		if st.wildcard {
+			return v
+		}
+		if st.isIndex {
+			i := st.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				return []interface{}{v[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// values returns the values of an object ordered by key, so results are stable.
+func values(m map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]interface{}, len(keys))
+	for i, k := range keys {
+		res[i] = m[k]
+	}
+	return res
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package structured parses JSON, YAML, TOML and INI files into a common
+// representation and queries values in them, so configuration files can be
+// checked field by field rather than with regexes over their contents.
+package structured
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	JSON = "json"
+	YAML = "yaml"
+	TOML = "toml"
+	INI  = "ini"
+)
+
+var Formats = []string{JSON, YAML, TOML, INI}
+
+var extensions = map[string]string{
+	".json": JSON,
+	".yaml": YAML,
+	".yml":  YAML,
+	".toml": TOML,
+	".ini":  INI,
+	".cfg":  INI,
+	".conf": INI,
+}
+
+// FormatFor returns the format of a file from its extension, or an empty
+// string if it isn't recognized.
+func FormatFor(p string) string {
+	return extensions[strings.ToLower(path.Ext(p))]
+}
+
+// ValidFormat returns whether format is one of Formats.
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses a document in the given format. documents are represented the
+// same way as by encoding/json: objects are map[string]interface{}, arrays are
+// []interface{} and all numbers are float64. dates in TOML and every value in
+// INI files are strings.
+func Parse(format string, data []byte) (interface{}, error) {
+	var doc interface{}
+	var err error
+	switch format {
+	case JSON:
+		err = json.Unmarshal(data, &doc)
+	case YAML:
+		err = yaml.Unmarshal(data, &doc)
+	case TOML:
+		doc, err = parseTOML(string(data))
+	case INI:
+		doc, err = parseINI(string(data))
+	default:
+		return nil, fmt.Errorf("unsupported format %s, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", format)
+	}
+	return Normalize(doc), nil
+}
+
+// Normalize converts a value decoded by any of the parsers, or from a test
+// config, into the representation returned by Parse.
+func Normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = Normalize(e)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = Normalize(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = Normalize(e)
+		}
+		return s
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return v
+}
+
+// TypeOf returns the JSON type of a normalized value: string, number, boolean,
+// array, object or null.
+func TypeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Types are the names returned by TypeOf.
+var Types = []string{"string", "number", "boolean", "array", "object", "null"}
+
+// Summarize formats a value for an error message, abbreviating it if it's long
+// so whole documents don't end up in test output.
+func Summarize(v interface{}) string {
+	const max = 80
+	var s string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		s = fmt.Sprintf("object with keys [%s]", strings.Join(keys, ", "))
+	case []interface{}:
+		s = fmt.Sprintf("array of %d elements", len(v))
+	case string:
+		s = fmt.Sprintf("%q", v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package structured
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestParse(t *testing.T) {
+	expected := map[string]interface{}{
+		"server": map[string]interface{}{
+			"port":  float64(8080),
+			"hosts": []interface{}{"a", "b"},
+		},
+	}
+	tables := []struct {
+		format string
+		data   string
+	}{
+		{format: JSON, data: `{"server": {"port": 8080, "hosts": ["a", "b"]}}`},
+		{format: YAML, data: "server:\n  port: 8080\n  hosts: [a, b]\n"},
+		{format: TOML, data: "[server]\nport = 8080\nhosts = [\"a\", 'b']\n"},
+	}
+	for _, table := range tables {
+		doc, err := Parse(table.format, []byte(table.data))
+		if err != nil {
+			t.Errorf("parsing %s: %s", table.format, err)
+			continue
+		}
+		testutil.CheckDeepEqual(t, expected, doc)
+	}
+	if _, err := Parse("xml", []byte("<a/>")); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+	if _, err := Parse(JSON, []byte("{")); err == nil {
+		t.Errorf("expected error for invalid json")
+	}
+}
+
+func TestParseINI(t *testing.T) {
+	doc, err := Parse(INI, []byte(`; global settings
+user = nobody
+
+[server]
+port: 8080
+name = "web"
+flags =
+  -v
+  -x
+debug
+
+[server]
+# merged with the first
+workers = 4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, map[string]interface{}{
+		"user": "nobody",
+		"server": map[string]interface{}{
+			"port":    "8080",
+			"name":    "web",
+			"flags":   "-v\n-x",
+			"debug":   "",
+			"workers": "4",
+		},
+	}, doc)
+}
+
+func TestFormatFor(t *testing.T) {
+	testutil.CheckDeepEqual(t, YAML, FormatFor("/etc/app/config.YML"))
+	testutil.CheckDeepEqual(t, INI, FormatFor("/etc/php.conf"))
+	testutil.CheckDeepEqual(t, "", FormatFor("/etc/hosts"))
+}
+
+func TestQuery(t *testing.T) {
+	doc := Normalize(map[string]interface{}{
+		"servers": []interface{}{
+			map[string]interface{}{"name": "a", "port": 80},
+			map[string]interface{}{"name": "b", "port": 443},
+		},
+		"dotted.key": true,
+	})
+	tables := []struct {
+		query    string
+		expected []interface{}
+	}{
+		{query: "$", expected: []interface{}{doc}},
+		{query: "$.servers[0].name", expected: []interface{}{"a"}},
+		{query: "servers[-1].port", expected: []interface{}{float64(443)}},
+		{query: "$.servers[*].port", expected: []interface{}{float64(80), float64(443)}},
+		{query: "$.servers[0].*", expected: []interface{}{"a", float64(80)}},
+		{query: "$['dotted.key']", expected: []interface{}{true}},
+		{query: `$["servers"][1]["name"]`, expected: []interface{}{"b"}},
+		{query: "$.servers[2]", expected: nil},
+		{query: "$.missing.key", expected: nil},
+		{query: "$.servers.name", expected: nil},
+	}
+	for _, table := range tables {
+		q, err := ParseQuery(table.query)
+		if err != nil {
+			t.Errorf("parsing %s: %s", table.query, err)
+			continue
+		}
+		testutil.CheckDeepEqual(t, table.expected, q.Find(doc))
+	}
+	for _, invalid := range []string{"$..a", "$.a[", "$.a[x]", "$['a", "$a"} {
+		if _, err := ParseQuery(invalid); err == nil {
+			t.Errorf("expected error parsing %s", invalid)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	testutil.CheckDeepEqual(t, "object with keys [a, b]", Summarize(map[string]interface{}{"b": 1, "a": 2}))
+	testutil.CheckDeepEqual(t, "array of 3 elements", Summarize([]interface{}{1, 2, 3}))
+	long := Summarize(string(make([]byte, 200)))
+	if len(long) > 100 {
+		t.Errorf("expected long value to be abbreviated, got %d characters", len(long))
+	}
+}
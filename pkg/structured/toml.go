@@ -0,0 +1,517 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package structured
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	tomlDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	tomlDateTime = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}[Tt ])?\d{2}:\d{2}(:\d{2})?`)
+)
+
+var tomlEscapes = map[byte]string{'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", 'e': "\x1b", '"': `"`, '\\': `\`}
+
+// tomlParser parses TOML documents into maps, arrays and scalars. datetimes
+// are kept as strings, since they can only be compared textually in tests.
+// it is meant for reading valid documents, so doesn't reject all invalid ones,
+// e.g. tables defined twice.
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func parseTOML(s string) (map[string]interface{}, error) {
+	p := &tomlParser{s: s, line: 1}
+	root := map[string]interface{}{}
+	current := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			current, err = p.tableHeader(root)
+		} else {
+			err = p.keyValue(current)
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if !p.eof() && !p.consumeNewline() {
+			return nil, p.errorf("expected newline, got %q", p.peek())
+		}
+	}
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *tomlParser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(p.s[p.pos:], prefix)
+}
+
+func (p *tomlParser) consumeNewline() bool {
+	switch {
+	case p.hasPrefix("\n"):
+		p.pos++
+	case p.hasPrefix("\r\n"):
+		p.pos += 2
+	default:
+		return false
+	}
+	p.line++
+	return true
+}
+
+// skipBlank skips whitespace and comments, and newlines too if requested.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case newlines && p.consumeNewline():
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) tableHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	array := p.hasPrefix("[[")
+	if array {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+	p.skipBlank(false)
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank(false)
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !p.hasPrefix(closing) {
+		return nil, p.errorf("expected %s after table name", closing)
+	}
+	p.pos += len(closing)
+
+	table, err := p.descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	if array {
+		existing, ok := table[last]
+		if !ok {
+			existing = []interface{}{}
+		}
+		tables, ok := existing.([]interface{})
+		if !ok {
+			return nil, p.errorf("%s is already defined and isn't an array of tables", strings.Join(keys, "."))
+		}
+		next := map[string]interface{}{}
+		table[last] = append(tables, next)
+		return next, nil
+	}
+	return p.descend(table, keys[len(keys)-1:])
+}
+
+// descend returns the table at keys below table, creating any that are
+// missing. an array of tables refers to its last table.
+func (p *tomlParser) descend(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for i, k := range keys {
+		switch next := table[k].(type) {
+		case nil:
+			created := map[string]interface{}{}
+			table[k] = created
+			table = created
+		case map[string]interface{}:
+			table = next
+		case []interface{}:
+			last, ok := lastTable(next)
+			if !ok {
+				return nil, p.errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+			}
+			table = last
+		default:
+			return nil, p.errorf("%s is not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return table, nil
+}
+
+func lastTable(a []interface{}) (map[string]interface{}, bool) {
+	if len(a) == 0 {
+		return nil, false
+	}
+	t, ok := a[len(a)-1].(map[string]interface{})
+	return t, ok
+}
+
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if p.eof() || p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	table, err = p.descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := table[last]; ok {
+		return p.errorf("key %s is defined more than once", strings.Join(keys, "."))
+	}
+	table[last] = value
+	return nil
+}
+
+// key parses a possibly dotted key into its parts.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, p.errorf("expected key")
+		}
+		var k string
+		var err error
+		switch p.peek() {
+		case '"':
+			p.pos++
+			k, err = p.basicString(false)
+		case '\'':
+			p.pos++
+			k, err = p.literalString(false)
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("invalid key character %q", p.peek())
+			}
+			k = p.s[start:p.pos]
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		p.skipBlank(false)
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("expected value")
+	}
+	switch {
+	case p.hasPrefix(`"""`):
+		p.pos += 3
+		return p.basicString(true)
+	case p.hasPrefix(`"`):
+		p.pos++
+		return p.basicString(false)
+	case p.hasPrefix("'''"):
+		p.pos += 3
+		return p.literalString(true)
+	case p.hasPrefix("'"):
+		p.pos++
+		return p.literalString(false)
+	case p.hasPrefix("["):
+		p.pos++
+		return p.array()
+	case p.hasPrefix("{"):
+		p.pos++
+		return p.inlineTable()
+	}
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	token := p.s[start:p.pos]
+	// a date can be followed by a time separated by a space
+	if tomlDate.MatchString(token) && p.hasPrefix(" ") && p.pos+1 < len(p.s) && p.s[p.pos+1] >= '0' && p.s[p.pos+1] <= '9' {
+		p.pos++
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+			p.pos++
+		}
+		token = p.s[start:p.pos]
+	}
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	case "":
+		return nil, p.errorf("expected value, got %q", p.peek())
+	}
+	if tomlDate.MatchString(token) || tomlDateTime.MatchString(token) {
+		return token, nil
+	}
+	return p.number(token)
+}
+
+func (p *tomlParser) number(token string) (interface{}, error) {
+	n := strings.Replace(token, "_", "", -1)
+	sign := ""
+	if strings.HasPrefix(n, "+") || strings.HasPrefix(n, "-") {
+		sign, n = n[:1], n[1:]
+	}
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(n, prefix) {
+			i, err := strconv.ParseInt(sign+n[2:], base, 64)
+			if err != nil {
+				return nil, p.errorf("invalid number %s", token)
+			}
+			return i, nil
+		}
+	}
+	if strings.ContainsAny(n, ".eE") {
+		f, err := strconv.ParseFloat(sign+n, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", token)
+		}
+		return f, nil
+	}
+	i, err := strconv.ParseInt(sign+n, 10, 64)
+	if err != nil {
+		return nil, p.errorf("invalid value %s", token)
+	}
+	return i, nil
+}
+
+func (p *tomlParser) basicString(multiline bool) (string, error) {
+	var b strings.Builder
+	if multiline {
+		// a newline immediately after the opening delimiter is trimmed
+		p.consumeNewline()
+	}
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		switch {
+		case multiline && p.hasPrefix(`"""`):
+			// up to two quotes can directly precede the closing delimiter
+			n := 3
+			for n < 5 && p.pos+n < len(p.s) && p.s[p.pos+n] == '"' {
+				n++
+			}
+			b.WriteString(strings.Repeat(`"`, n-3))
+			p.pos += n
+			return b.String(), nil
+		case !multiline && c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\':
+			p.pos++
+			if err := p.escape(&b, multiline); err != nil {
+				return "", err
+			}
+		case c == '\n' || c == '\r':
+			if !multiline || !p.consumeNewline() {
+				return "", p.errorf("newline in string")
+			}
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) escape(b *strings.Builder, multiline bool) error {
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	if s, ok := tomlEscapes[c]; ok {
+		b.WriteString(s)
+		return nil
+	}
+	switch c {
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return p.errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid unicode escape %s", p.s[p.pos:p.pos+n])
+		}
+		b.WriteRune(rune(r))
+		p.pos += n
+		return nil
+	case ' ', '\t', '\r', '\n':
+		if multiline {
+			// a line ending backslash trims all whitespace up to the next content
+			p.pos--
+			for !p.eof() {
+				if c := p.peek(); c == ' ' || c == '\t' {
+					p.pos++
+				} else if !p.consumeNewline() {
+					break
+				}
+			}
+			return nil
+		}
+	}
+	return p.errorf("invalid escape \\%c", c)
+}
+
+func (p *tomlParser) literalString(multiline bool) (string, error) {
+	if multiline {
+		p.consumeNewline()
+	}
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		switch {
+		case multiline && p.hasPrefix("'''"):
+			n := 3
+			for n < 5 && p.pos+n < len(p.s) && p.s[p.pos+n] == '\'' {
+				n++
+			}
+			b.WriteString(strings.Repeat("'", n-3))
+			p.pos += n
+			return b.String(), nil
+		case !multiline && c == '\'':
+			p.pos++
+			return b.String(), nil
+		case c == '\n' || c == '\r':
+			if !multiline || !p.consumeNewline() {
+				return "", p.errorf("newline in string")
+			}
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) array() ([]interface{}, error) {
+	res := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return res, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array, got %q", p.peek())
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	table := map[string]interface{}{}
+	p.skipBlank(false)
+	if !p.eof() && p.peek() == '}' {
+		p.pos++
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table, got %q", p.peek())
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package structured
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestParseTOML(t *testing.T) {
+	doc, err := parseTOML(`# a comment
+title = "TOML \"example\"" # trailing comment
+path = 'C:\Users'
+hex = 0xff
+big = 1_000_000
+pi = 3.14
+negative = -2e-3
+enabled = true
+dob = 1979-05-27 07:32:00Z
+day = 1979-05-27
+site."google.com" = true
+description = """
+first \
+  second
+"""
+raw = '''
+line'''
+nested = [[1, 2], ["a"],
+  # comment in an array
+]
+point = { x = 1, y = { z = 2 } }
+
+[owner]
+name = "Tom"
+
+[database.connection]
+max = 5
+
+[[products]]
+name = "Hammer"
+
+[[products]]
+name = "Nail"
+
+[products.details]
+size = "small"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.CheckDeepEqual(t, map[string]interface{}{
+		"title":       `TOML "example"`,
+		"path":        `C:\Users`,
+		"hex":         int64(255),
+		"big":         int64(1000000),
+		"pi":          3.14,
+		"negative":    -0.002,
+		"enabled":     true,
+		"dob":         "1979-05-27 07:32:00Z",
+		"day":         "1979-05-27",
+		"site":        map[string]interface{}{"google.com": true},
+		"description": "first second\n",
+		"raw":         "line",
+		"nested":      []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"a"}},
+		"point":       map[string]interface{}{"x": int64(1), "y": map[string]interface{}{"z": int64(2)}},
+		"owner":       map[string]interface{}{"name": "Tom"},
+		"database":    map[string]interface{}{"connection": map[string]interface{}{"max": int64(5)}},
+		"products": []interface{}{
+			map[string]interface{}{"name": "Hammer"},
+			map[string]interface{}{"name": "Nail", "details": map[string]interface{}{"size": "small"}},
+		},
+	}, doc)
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, invalid := range []string{
+		"a = ",
+		"a = 1\na = 2",
+		"a = \"unterminated",
+		"a = [1, 2",
+		"a = 1 b = 2",
+		"a = 1\n[a]",
+		"a = \"\\q\"",
+	} {
+		if _, err := parseTOML(invalid); err == nil {
+			t.Errorf("expected error parsing %q", invalid)
+		}
+	}
+}
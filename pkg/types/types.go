@@ -16,6 +16,7 @@ package types
 
 import (
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/v1"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/types/v2"
 )
@@ -23,9 +24,19 @@ import (
 type StructureTest interface {
 	SetDriverImpl(func(drivers.DriverConfig) (drivers.Driver, error), drivers.DriverConfig)
 	NewDriver() (drivers.Driver, error)
+	SetParallelism(int)
+	SetFilter(*unversioned.TestFilter)
 	RunAll(chan interface{}, string)
 }
 
+// Includer is implemented by schema versions whose config files can include
+// other config files. Merge is passed the StructureTest parsed from each
+// included file, along with the path to the file.
+type Includer interface {
+	Includes() []string
+	Merge(included interface{}, file string) error
+}
+
 var SchemaVersions map[string]func() StructureTest = map[string]func() StructureTest{
 	"1.0.0": func() StructureTest { return new(v1.StructureTest) },
 	"2.0.0": func() StructureTest { return new(v2.StructureTest) },
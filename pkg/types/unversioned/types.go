@@ -15,8 +15,11 @@
 package unversioned
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 )
 
 type EnvVar struct {
@@ -39,23 +42,78 @@ type Config struct {
 	Workdir      string
 	ExposedPorts []string
 	Labels       map[string]string
+	User         string
+	Healthcheck  *Healthcheck // nil if the image doesn't define one
+	StopSignal   string
+	Shell        []string
+	OnBuild      []string
+	OS           string
+	Architecture string
+	Variant      string
+	Author       string
+	Created      time.Time
 }
 
+type Healthcheck struct {
+	Test        []string
+	Interval    time.Duration
+	Timeout     time.Duration
+	StartPeriod time.Duration
+	Retries     int
+}
+
+// Layer describes a filesystem layer of an image, along with the changes it makes
+// to the filesystem of the layers below it. paths are absolute.
+type Layer struct {
+	Digest           string
+	CreatedBy        string // command from the image history that created the layer, if known
+	Size             int64  // compressed size
+	UncompressedSize int64
+	Added            []string
+	Modified         []string
+	Deleted          []string // paths removed by whiteouts, including the contents of removed directories
+}
+
+// Status is the outcome of a test.
+type Status string
+
+const (
+	StatusPass  Status = "pass"
+	StatusFail  Status = "fail"
+	StatusSkip  Status = "skip"
+	StatusXFail Status = "xfail" // failed as expected
+	StatusXPass Status = "xpass" // passed although expected to fail, which counts as a failure
+)
+
 type TestResult struct {
-	Name   string
-	Pass   bool
-	Stdout string   `json:",omitempty"`
-	Stderr string   `json:",omitempty"`
-	Errors []string `json:",omitempty"`
+	Name     string
+	Pass     bool          // whether the test's checks passed
+	Status   Status        `json:",omitempty"` // outcome of the test, see State
+	Reason   string        `json:",omitempty"` // why the test was skipped or is expected to fail
+	File     string        `json:",omitempty"` // config file the test was defined in
+	Stdout   string        `json:",omitempty"`
+	Stderr   string        `json:",omitempty"`
+	Errors   []string      `json:",omitempty"`
+	Duration time.Duration `json:",omitempty"` // in seconds in json output
+	TimedOut bool          `json:",omitempty"` // a command run by the test was killed for exceeding its timeout
+}
+
+// MarshalJSON writes the duration in seconds, which is easier to consume than
+// the nanoseconds of a time.Duration.
+func (t TestResult) MarshalJSON() ([]byte, error) {
+	type result TestResult
+	return json.Marshal(struct {
+		result
+		Duration float64 `json:",omitempty"`
+	}{result(t), t.Duration.Seconds()})
 }
 
 func (t *TestResult) String() string {
 	strRepr := fmt.Sprintf("\nTest Name:%s", t.Name)
-	testStatus := "Fail"
-	if t.IsPass() {
-		testStatus = "Pass"
+	strRepr += fmt.Sprintf("\nTest Status:%s", strings.Title(string(t.State())))
+	if t.Reason != "" {
+		strRepr += fmt.Sprintf("\nReason:%s", t.Reason)
 	}
-	strRepr += fmt.Sprintf("\nTest Status:%s", testStatus)
 	if t.Stdout != "" {
 		strRepr += fmt.Sprintf("\nStdout:%s", t.Stdout)
 	}
@@ -82,9 +140,81 @@ func (t *TestResult) IsPass() bool {
 	return t.Pass
 }
 
+// State returns the outcome of the test, which is pass or fail unless the
+// test was skipped or expected to fail.
+func (t *TestResult) State() Status {
+	if t.Status != "" {
+		return t.Status
+	}
+	if t.Pass {
+		return StatusPass
+	}
+	return StatusFail
+}
+
+// ExpectFailure marks the result of a test that is expected to fail.
+func (t *TestResult) ExpectFailure(reason string) {
+	t.Reason = reason
+	if !t.Pass {
+		t.Status = StatusXFail
+		return
+	}
+	t.Status = StatusXPass
+	t.Errorf("Test was expected to fail (%s) but passed", reason)
+}
+
+// Skipped returns the result of a test that wasn't run.
+func Skipped(name, reason string) *TestResult {
+	return &TestResult{
+		Name:   name,
+		Status: StatusSkip,
+		Reason: reason,
+	}
+}
+
 type SummaryObject struct {
 	Pass    int
-	Fail    int
+	Fail    int // includes unexpected passes
+	Skipped int `json:",omitempty"`
+	XFail   int `json:",omitempty"` // expected failures
+	XPass   int `json:",omitempty"` // unexpected passes
 	Total   int
 	Results []*TestResult `json:",omitempty"`
 }
+
+// TestFilter selects the tests to run by name and tags. tests that aren't
+// selected are reported as skipped.
+type TestFilter struct {
+	IncludeTags []string       // run only tests with at least one of these tags
+	ExcludeTags []string       // skip tests with any of these tags
+	Run         *regexp.Regexp // run only tests whose names match
+}
+
+// Skip returns why a test with the given name and tags shouldn't be run, or
+// an empty string if it should. a nil filter selects every test.
+func (f *TestFilter) Skip(name string, tags []string) string {
+	if f == nil {
+		return ""
+	}
+	if f.Run != nil && !f.Run.MatchString(name) {
+		return fmt.Sprintf("name does not match --run %s", f.Run)
+	}
+	for _, tag := range tags {
+		for _, excluded := range f.ExcludeTags {
+			if tag == excluded {
+				return fmt.Sprintf("tag %s is excluded", tag)
+			}
+		}
+	}
+	if len(f.IncludeTags) == 0 {
+		return ""
+	}
+	for _, tag := range tags {
+		for _, included := range f.IncludeTags {
+			if tag == included {
+				return ""
+			}
+		}
+	}
+	return fmt.Sprintf("no tag in --include-tags %s", strings.Join(f.IncludeTags, ","))
+}
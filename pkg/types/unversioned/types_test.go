@@ -0,0 +1,76 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package unversioned
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestFilterSkip(t *testing.T) {
+	filter := &TestFilter{
+		IncludeTags: []string{"base", "users"},
+		ExcludeTags: []string{"slow"},
+		Run:         regexp.MustCompile("^File"),
+	}
+	tables := []struct {
+		name string
+		tags []string
+		skip bool
+	}{
+		{name: "File Existence Test: passwd", tags: []string{"users"}},
+		{name: "File Existence Test: passwd", tags: []string{"base", "slow"}, skip: true},
+		{name: "File Existence Test: passwd", tags: nil, skip: true},
+		{name: "Command Test: whoami", tags: []string{"users"}, skip: true},
+	}
+	for _, table := range tables {
+		reason := filter.Skip(table.name, table.tags)
+		if (reason != "") != table.skip {
+			t.Errorf("%s with tags %v: expected skip %t, got reason %q", table.name, table.tags, table.skip, reason)
+		}
+	}
+	var none *TestFilter
+	if reason := none.Skip("anything", nil); reason != "" {
+		t.Errorf("expected a nil filter to select every test, got %q", reason)
+	}
+}
+
+func TestExpectFailure(t *testing.T) {
+	failed := &TestResult{Errors: []string{"missing file"}}
+	failed.ExpectFailure("fixed in the next base image")
+	if failed.State() != StatusXFail {
+		t.Errorf("expected xfail, got %s", failed.State())
+	}
+	passed := &TestResult{Pass: true}
+	passed.ExpectFailure("fixed in the next base image")
+	if passed.State() != StatusXPass || len(passed.Errors) != 1 {
+		t.Errorf("expected xpass with an error, got %s with errors %v", passed.State(), passed.Errors)
+	}
+	if s := Skipped("slow", "takes too long").State(); s != StatusSkip {
+		t.Errorf("expected skip, got %s", s)
+	}
+}
+
+func TestResultJSON(t *testing.T) {
+	res, err := json.Marshal(&TestResult{Name: "slow", Pass: true, Duration: 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Name":"slow","Pass":true,"Duration":1.5}`
+	if string(res) != expected {
+		t.Errorf("expected %s, got %s", expected, res)
+	}
+}
@@ -74,7 +74,7 @@ func (ct *CommandTest) Run(driver drivers.Driver) *types.TestResult {
 	if err != nil {
 		logrus.Errorf("error retrieving image config: %s", err.Error())
 	}
-	stdout, stderr, exitcode, err := driver.ProcessCommand(ct.EnvVars, utils.SubstituteEnvVars(ct.Command, config.Env))
+	stdout, stderr, exitcode, err := driver.ProcessCommand(ct.EnvVars, utils.SubstituteEnvVars(ct.Command, config.Env), nil)
 	result := &types.TestResult{
 		Name:   ct.LogName(),
 		Pass:   true,
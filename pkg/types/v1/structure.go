@@ -19,6 +19,7 @@ import (
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
 	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
 )
 
 type StructureTest struct {
@@ -30,6 +31,9 @@ type StructureTest struct {
 	FileExistenceTests []FileExistenceTest `yaml:"fileExistenceTests"`
 	FileContentTests   []FileContentTest   `yaml:"fileContentTests"`
 	LicenseTests       []LicenseTest       `yaml:"licenseTests"`
+
+	parallel int
+	filter   *types.TestFilter
 }
 
 func (st *StructureTest) NewDriver() (drivers.Driver, error) {
@@ -41,6 +45,26 @@ func (st *StructureTest) SetDriverImpl(f func(drivers.DriverConfig) (drivers.Dri
 	st.DriverArgs = args
 }
 
+func (st *StructureTest) SetParallelism(parallel int) {
+	st.parallel = parallel
+}
+
+func (st *StructureTest) SetFilter(filter *types.TestFilter) {
+	st.filter = filter
+}
+
+// filtered returns the job running a test, or one reporting the test as
+// skipped if the filter excludes it.
+func (st *StructureTest) filtered(name string, tags []string, job utils.Job) utils.Job {
+	reason := st.filter.Skip(name, tags)
+	if reason == "" {
+		return job
+	}
+	return func(channel chan interface{}) {
+		channel <- types.Skipped(name, reason)
+	}
+}
+
 func (st *StructureTest) RunAll(channel chan interface{}, file string) {
 	// Wait till the file is Processed so we can display the results per file.
 	fileProcessed := make(chan bool, 1)
@@ -49,76 +73,93 @@ func (st *StructureTest) RunAll(channel chan interface{}, file string) {
 }
 
 func (st *StructureTest) runAll(channel chan interface{}, fileProcessed chan bool) {
-	st.RunCommandTests(channel)
-	st.RunFileContentTests(channel)
-	st.RunFileExistenceTests(channel)
-	st.RunLicenseTests(channel)
+	var jobs []utils.Job
+	for _, test := range st.CommandTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), nil, func(channel chan interface{}) {
+			st.runCommandTest(channel, test)
+		}))
+	}
+	for _, test := range st.FileContentTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), nil, func(channel chan interface{}) {
+			st.runFileContentTest(channel, test)
+		}))
+	}
+	for _, test := range st.FileExistenceTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), nil, func(channel chan interface{}) {
+			st.runFileExistenceTest(channel, test)
+		}))
+	}
+	for _, test := range st.LicenseTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), nil, func(channel chan interface{}) {
+			st.runLicenseTest(channel, test)
+		}))
+	}
+	for i := range jobs {
+		jobs[i] = utils.Timed(jobs[i])
+	}
+	utils.RunJobs(channel, st.parallel, jobs)
 	fileProcessed <- true
 }
 
-func (st *StructureTest) RunCommandTests(channel chan interface{}) {
-	for _, test := range st.CommandTests {
-		if err := test.Validate(); err != nil {
-			logrus.Error(err.Error())
-			continue
-		}
-		driver, err := st.NewDriver()
-		if err != nil {
-			logrus.Fatal(err.Error())
-		}
-		vars := append(st.GlobalEnvVars, test.EnvVars...)
-		if err = driver.Setup(vars, test.Setup); err != nil {
+func (st *StructureTest) runCommandTest(channel chan interface{}, test CommandTest) {
+	if err := test.Validate(); err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	driver, err := st.NewDriver()
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
+	defer driver.Destroy()
+	// copy the global vars, since tests may be running concurrently
+	vars := append(append([]types.EnvVar{}, st.GlobalEnvVars...), test.EnvVars...)
+	if err = driver.Setup(vars, test.Setup); err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	defer func() {
+		if err := driver.Teardown(test.Teardown); err != nil {
 			logrus.Error(err.Error())
-			driver.Destroy()
-			continue
 		}
-		defer func() {
-			if err := driver.Teardown(test.Teardown); err != nil {
-				logrus.Error(err.Error())
-			}
-			driver.Destroy()
-		}()
-		channel <- test.Run(driver)
-	}
+	}()
+	channel <- test.Run(driver)
 }
 
-func (st *StructureTest) RunFileExistenceTests(channel chan interface{}) {
-	for _, test := range st.FileExistenceTests {
-		if err := test.Validate(); err != nil {
-			logrus.Error(err.Error())
-			continue
-		}
-		driver, err := st.NewDriver()
-		if err != nil {
-			logrus.Fatal(err.Error())
-		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+func (st *StructureTest) runFileExistenceTest(channel chan interface{}, test FileExistenceTest) {
+	if err := test.Validate(); err != nil {
+		logrus.Error(err.Error())
+		return
 	}
-
+	driver, err := st.NewDriver()
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
+	defer driver.Destroy()
+	channel <- test.Run(driver)
 }
-func (st *StructureTest) RunFileContentTests(channel chan interface{}) {
-	for _, test := range st.FileContentTests {
-		if err := test.Validate(); err != nil {
-			logrus.Error(err.Error())
-			continue
-		}
-		driver, err := st.NewDriver()
-		if err != nil {
-			logrus.Fatal(err.Error())
-		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+
+func (st *StructureTest) runFileContentTest(channel chan interface{}, test FileContentTest) {
+	if err := test.Validate(); err != nil {
+		logrus.Error(err.Error())
+		return
+	}
+	driver, err := st.NewDriver()
+	if err != nil {
+		logrus.Fatal(err.Error())
 	}
+	defer driver.Destroy()
+	channel <- test.Run(driver)
 }
 
-func (st *StructureTest) RunLicenseTests(channel chan interface{}) {
-	for _, test := range st.LicenseTests {
-		driver, err := st.NewDriver()
-		if err != nil {
-			logrus.Fatal(err.Error())
-		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+func (st *StructureTest) runLicenseTest(channel chan interface{}, test LicenseTest) {
+	driver, err := st.NewDriver()
+	if err != nil {
+		logrus.Fatal(err.Error())
 	}
+	defer driver.Destroy()
+	channel <- test.Run(driver)
 }
@@ -0,0 +1,134 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/binaries"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+type BinaryTest struct {
+	Name             string `yaml:"name"`             // name of test
+	Path             string `yaml:"path"`             // ELF executable or library to inspect
+	Arch             string `yaml:"arch"`             // expected architecture, e.g. amd64 or arm64
+	Linking          string `yaml:"linking"`          // static or dynamic
+	Stripped         *bool  `yaml:"stripped"`         // whether the symbol table should have been removed
+	PIE              *bool  `yaml:"pie"`              // whether the binary should be position independent
+	Relro            string `yaml:"relro"`            // expected RELRO: none, partial or full
+	NX               *bool  `yaml:"nx"`               // whether the stack should be non executable
+	ResolveLibraries bool   `yaml:"resolveLibraries"` // whether every needed library should be found in the library search path
+
+	TestOptions `yaml:",inline"`
+}
+
+func (bt BinaryTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if bt.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = bt.Name
+	if bt.Path == "" {
+		res.Errorf("Please provide a valid file path for test %s", bt.Name)
+	}
+	if bt.Linking != "" && !utils.ValueInList(bt.Linking, binaries.Linkings) {
+		res.Errorf("Invalid linking %s for test %s, please provide one of %s", bt.Linking, bt.Name, strings.Join(binaries.Linkings, ", "))
+	}
+	if bt.Relro != "" && !utils.ValueInList(bt.Relro, binaries.Relros) {
+		res.Errorf("Invalid relro %s for test %s, please provide one of %s", bt.Relro, bt.Name, strings.Join(binaries.Relros, ", "))
+	}
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (bt BinaryTest) LogName() string {
+	return fmt.Sprintf("Binary Test: %s", bt.Name)
+}
+
+func (bt BinaryTest) Run(driver drivers.Driver) *types.TestResult {
+	result := &types.TestResult{
+		Name:   bt.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(bt.LogName())
+	config, err := driver.GetConfig()
+	if err != nil {
+		logrus.Warnf("error retrieving image config, ignoring env vars: %s", err)
+	}
+	bt.Path = utils.SubstituteEnvVar(bt.Path, config.Env)
+	contents, err := driver.ReadFile(bt.Path)
+	if err != nil {
+		result.Errorf("Failed to open %s. Error: %s", bt.Path, err)
+		result.Fail()
+		return result
+	}
+	info, err := binaries.Inspect(contents)
+	if err != nil {
+		result.Errorf("Failed to inspect %s: %s", bt.Path, err)
+		result.Fail()
+		return result
+	}
+	if bt.Arch != "" && info.Arch != bt.Arch {
+		result.Errorf("%s has incorrect architecture. Expected: %s, Actual: %s", bt.Path, bt.Arch, info.Arch)
+		result.Fail()
+	}
+	if bt.Linking != "" && info.Linking != bt.Linking {
+		result.Errorf("%s has incorrect linking. Expected: %s, Actual: %s", bt.Path, bt.Linking, info.Linking)
+		result.Fail()
+	}
+	for _, flag := range []struct {
+		name     string
+		expected *bool
+		actual   bool
+	}{
+		{"stripped", bt.Stripped, info.Stripped},
+		{"PIE", bt.PIE, info.PIE},
+		{"NX", bt.NX, info.NX},
+	} {
+		if flag.expected != nil && *flag.expected != flag.actual {
+			result.Errorf("%s has incorrect %s flag. Expected: %t, Actual: %t", bt.Path, flag.name, *flag.expected, flag.actual)
+			result.Fail()
+		}
+	}
+	if bt.Relro != "" && info.Relro != bt.Relro {
+		result.Errorf("%s has incorrect RELRO. Expected: %s, Actual: %s", bt.Path, bt.Relro, info.Relro)
+		result.Fail()
+	}
+	if bt.ResolveLibraries {
+		bt.checkLibraries(driver, result, info, config.Env["LD_LIBRARY_PATH"])
+	}
+	return result
+}
+
+func (bt BinaryTest) checkLibraries(driver drivers.Driver, result *types.TestResult, info *binaries.Info, ldLibraryPath string) {
+	searchPath := binaries.SearchPath(driver, info, bt.Path, ldLibraryPath)
+	found, missing := binaries.Resolve(driver, info.Needed, searchPath)
+	for lib, p := range found {
+		logrus.Debugf("%s needs %s, found at %s", bt.Path, lib, p)
+	}
+	for _, lib := range missing {
+		result.Errorf("%s needs %s, which isn't in any of %s", bt.Path, lib, strings.Join(searchPath, ":"))
+		result.Fail()
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v2
+
+import (
+	"crypto/x509"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/certificates"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+// files larger than this next to a certificate aren't checked for private keys
+const maxKeyFileSize = 1 << 20
+
+type CertificateTest struct {
+	Name                 string   `yaml:"name"`                 // name of test
+	Path                 string   `yaml:"path"`                 // PEM or DER certificate, or bundle of PEM certificates
+	Subject              string   `yaml:"subject"`              // regex the subject of every certificate should match, e.g. CN=example.com
+	Issuer               string   `yaml:"issuer"`               // regex the issuer of every certificate should match
+	MinDaysValid         *int     `yaml:"minDaysValid"`         // minimum number of days until every certificate expires
+	KeyType              string   `yaml:"keyType"`              // type of the public key of every certificate: rsa, ecdsa, ed25519 or dsa
+	MinKeySize           *int     `yaml:"minKeySize"`           // minimum size in bits of the public key of every certificate
+	ContainsSubjects     []string `yaml:"containsSubjects"`     // regexes that the subject of at least one certificate should match
+	ContainsFingerprints []string `yaml:"containsFingerprints"` // SHA-256 fingerprints of certificates that should be present
+	NoPrivateKeys        bool     `yaml:"noPrivateKeys"`        // fail if the file or any other in its directory holds a PEM private key
+
+	TestOptions `yaml:",inline"`
+}
+
+func (ct CertificateTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if ct.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = ct.Name
+	if ct.Path == "" {
+		res.Errorf("Please provide a valid file path for test %s", ct.Name)
+	}
+	for _, r := range append([]string{ct.Subject, ct.Issuer}, ct.ContainsSubjects...) {
+		if _, err := regexp.Compile(r); err != nil {
+			res.Errorf("Invalid regex %s for test %s: %s", r, ct.Name, err)
+		}
+	}
+	if ct.KeyType != "" && !validKeyType(ct.KeyType) {
+		res.Errorf("Invalid key type %s for test %s, please provide one of %s", ct.KeyType, ct.Name, strings.Join(certificates.KeyTypes, ", "))
+	}
+	for _, f := range ct.ContainsFingerprints {
+		if !sha256Digest.MatchString(certificates.NormalizeFingerprint(f)) {
+			res.Errorf("Invalid fingerprint %s for test %s, please provide a SHA-256 fingerprint", f, ct.Name)
+		}
+	}
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func validKeyType(keyType string) bool {
+	for _, t := range certificates.KeyTypes {
+		if strings.ToLower(keyType) == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (ct CertificateTest) LogName() string {
+	return fmt.Sprintf("Certificate Test: %s", ct.Name)
+}
+
+func (ct CertificateTest) Run(driver drivers.Driver) *types.TestResult {
+	result := &types.TestResult{
+		Name:   ct.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(ct.LogName())
+	config, err := driver.GetConfig()
+	if err != nil {
+		logrus.Errorf("error retrieving image config: %s", err.Error())
+	}
+	ct.Path = utils.SubstituteEnvVar(ct.Path, config.Env)
+	contents, err := driver.ReadFile(ct.Path)
+	if err != nil {
+		result.Errorf("Failed to open %s. Error: %s", ct.Path, err)
+		result.Fail()
+		return result
+	}
+	bundle, err := certificates.Parse(contents)
+	if err != nil {
+		result.Errorf("Failed to parse %s: %s", ct.Path, err)
+		result.Fail()
+		return result
+	}
+	if len(bundle.Certificates) == 0 {
+		result.Errorf("No certificates found in %s", ct.Path)
+		result.Fail()
+		return result
+	}
+	for _, cert := range bundle.Certificates {
+		ct.checkCertificate(result, cert)
+	}
+	for _, r := range ct.ContainsSubjects {
+		re := regexp.MustCompile(r)
+		found := false
+		for _, cert := range bundle.Certificates {
+			if re.MatchString(cert.Subject.String()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Errorf("No certificate in %s has a subject matching %s", ct.Path, r)
+			result.Fail()
+		}
+	}
+	if len(ct.ContainsFingerprints) > 0 {
+		fingerprints := map[string]bool{}
+		for _, cert := range bundle.Certificates {
+			fingerprints[certificates.Fingerprint(cert)] = true
+		}
+		for _, f := range ct.ContainsFingerprints {
+			if !fingerprints[certificates.NormalizeFingerprint(f)] {
+				result.Errorf("No certificate in %s has fingerprint %s", ct.Path, f)
+				result.Fail()
+			}
+		}
+	}
+	if ct.NoPrivateKeys {
+		if len(bundle.PrivateKeys) > 0 {
+			result.Errorf("%s contains a private key: %s", ct.Path, strings.Join(bundle.PrivateKeys, ", "))
+			result.Fail()
+		}
+		ct.checkNoPrivateKeys(driver, result)
+	}
+	return result
+}
+
+func (ct CertificateTest) checkCertificate(result *types.TestResult, cert *x509.Certificate) {
+	subject := cert.Subject.String()
+	if ct.Subject != "" && !regexp.MustCompile(ct.Subject).MatchString(subject) {
+		result.Errorf("Certificate %s in %s has a subject not matching %s", subject, ct.Path, ct.Subject)
+		result.Fail()
+	}
+	if ct.Issuer != "" && !regexp.MustCompile(ct.Issuer).MatchString(cert.Issuer.String()) {
+		result.Errorf("Certificate %s in %s has incorrect issuer. Expected: %s, Actual: %s", subject, ct.Path, ct.Issuer, cert.Issuer.String())
+		result.Fail()
+	}
+	if ct.MinDaysValid != nil {
+		days := int(time.Until(cert.NotAfter).Hours() / 24)
+		if days < *ct.MinDaysValid {
+			result.Errorf("Certificate %s in %s expires on %s, in %d days, expected at least %d", subject, ct.Path, cert.NotAfter.Format("2006-01-02"), days, *ct.MinDaysValid)
+			result.Fail()
+		}
+	}
+	keyType, size := certificates.Key(cert)
+	if ct.KeyType != "" && keyType != strings.ToLower(ct.KeyType) {
+		result.Errorf("Certificate %s in %s has incorrect key type. Expected: %s, Actual: %s", subject, ct.Path, ct.KeyType, keyType)
+		result.Fail()
+	}
+	if ct.MinKeySize != nil && size < *ct.MinKeySize {
+		result.Errorf("Certificate %s in %s has a %d bit %s key, expected at least %d bits", subject, ct.Path, size, keyType, *ct.MinKeySize)
+		result.Fail()
+	}
+}
+
+// checkNoPrivateKeys looks for PEM private keys in the other files in the
+// certificate's directory.
+func (ct CertificateTest) checkNoPrivateKeys(driver drivers.Driver, result *types.TestResult) {
+	dir := path.Dir(ct.Path)
+	infos, err := driver.ReadDir(dir)
+	if err != nil {
+		result.Errorf("Error listing %s: %s", dir, err)
+		result.Fail()
+		return
+	}
+	for _, info := range infos {
+		p := path.Join(dir, info.Name())
+		if info.IsDir() || p == path.Clean(ct.Path) || info.Size() > maxKeyFileSize {
+			continue
+		}
+		// symlinks are followed, e.g. to certificates in /usr/share/ca-certificates
+		contents, err := driver.ReadFile(p)
+		if err != nil {
+			logrus.Warnf("Error reading %s, not checking it for private keys: %s", p, err)
+			continue
+		}
+		if keys := certificates.PrivateKeys(contents); len(keys) > 0 {
+			result.Errorf("%s next to %s contains a private key: %s", p, ct.Path, strings.Join(keys, ", "))
+			result.Fail()
+		}
+	}
+}
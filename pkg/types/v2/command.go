@@ -16,7 +16,13 @@ package v2
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
@@ -36,6 +42,11 @@ type CommandTest struct {
 	ExcludedOutput []string       `yaml:"excludedOutput"`
 	ExpectedError  []string       `yaml:"expectedError"`
 	ExcludedError  []string       `yaml:"excludedError"` // excluded error from running command
+	Timeout        string         `yaml:"timeout"`       // e.g. 30s, overrides the --timeout flag
+	Stdin          string         `yaml:"stdin"`         // input passed to the command
+	StdinFile      string         `yaml:"stdinFile"`     // path to a file on the host to pass to the command as input
+
+	TestOptions `yaml:",inline"`
 }
 
 func (ct *CommandTest) Validate(channel chan interface{}) bool {
@@ -61,6 +72,14 @@ func (ct *CommandTest) Validate(channel chan interface{}) bool {
 			}
 		}
 	}
+	if ct.Stdin != "" && ct.StdinFile != "" {
+		res.Errorf("Please provide either stdin or stdinFile for test %s, not both", ct.Name)
+	}
+	if ct.Timeout != "" {
+		if timeout, err := time.ParseDuration(ct.Timeout); err != nil || timeout <= 0 {
+			res.Errorf("Please provide a valid positive timeout for test %s, e.g. 30s", ct.Name)
+		}
+	}
 	if ct.EnvVars != nil {
 		for _, envVar := range ct.EnvVars {
 			if envVar.Key == "" || envVar.Value == "" {
@@ -86,7 +105,18 @@ func (ct *CommandTest) Run(driver drivers.Driver) *types.TestResult {
 		logrus.Errorf("error retrieving image config: %s", err.Error())
 	}
 	fullCommand := utils.SubstituteEnvVars(append([]string{ct.Command}, ct.Args...), config.Env)
-	stdout, stderr, exitcode, err := driver.ProcessCommand(ct.EnvVars, fullCommand)
+	stdin, err := ct.stdin()
+	if err != nil {
+		return &types.TestResult{
+			Name:   ct.LogName(),
+			Pass:   false,
+			Errors: []string{err.Error()},
+		}
+	}
+	if stdin != nil {
+		defer stdin.Close()
+	}
+	stdout, stderr, exitcode, err := driver.ProcessCommand(ct.EnvVars, fullCommand, stdin)
 	result := &types.TestResult{
 		Name:   ct.LogName(),
 		Pass:   true,
@@ -97,6 +127,7 @@ func (ct *CommandTest) Run(driver drivers.Driver) *types.TestResult {
 	if err != nil {
 		result.Fail()
 		result.Error(err.Error())
+		result.TimedOut = drivers.IsTimeout(err)
 		return result
 	}
 
@@ -104,6 +135,21 @@ func (ct *CommandTest) Run(driver drivers.Driver) *types.TestResult {
 	return result
 }
 
+// stdin returns the input to pass to the command, or nil if it has none.
+func (ct *CommandTest) stdin() (io.ReadCloser, error) {
+	if ct.StdinFile != "" {
+		f, err := os.Open(ct.StdinFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening stdin file")
+		}
+		return f, nil
+	}
+	if ct.Stdin != "" {
+		return ioutil.NopCloser(strings.NewReader(ct.Stdin)), nil
+	}
+	return nil, nil
+}
+
 func (ct *CommandTest) CheckOutput(result *types.TestResult, stdout string, stderr string, exitCode int) {
 	for _, errStr := range ct.ExpectedError {
 		if !utils.CompileAndRunRegex(errStr, stderr, true) {
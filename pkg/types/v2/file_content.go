@@ -29,6 +29,8 @@ type FileContentTest struct {
 	Path             string   `yaml:"path"`             // file to check existence of
 	ExpectedContents []string `yaml:"expectedContents"` // list of expected contents of file
 	ExcludedContents []string `yaml:"excludedContents"` // list of excluded contents of file
+
+	TestOptions `yaml:",inline"`
 }
 
 func (ft FileContentTest) Validate(channel chan interface{}) bool {
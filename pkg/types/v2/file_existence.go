@@ -16,12 +16,22 @@ package v2
 
 import (
 	"archive/tar"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"os"
+	"path"
+	"regexp"
+	"strings"
 
+	units "github.com/docker/go-units"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/GoogleContainerTools/container-structure-test/pkg/capabilities"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
 	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
@@ -30,15 +40,32 @@ import (
 var defaultOwnership = -1
 
 type FileExistenceTest struct {
-	Name           string `yaml:"name"`           // name of test
-	Path           string `yaml:"path"`           // file to check existence of
-	ShouldExist    bool   `yaml:"shouldExist"`    // whether or not the file should exist
-	Permissions    string `yaml:"permissions"`    // expected Unix permission string of the file, e.g. drwxrwxrwx
-	Uid            int    `yaml:"uid"`            // ID of the owner of the file
-	Gid            int    `yaml:"gid"`            // ID of the group of the file
-	IsExecutableBy string `yaml:"isExecutableBy"` // name of group that file should be executable by
+	Name           string            `yaml:"name"`           // name of test
+	Path           string            `yaml:"path"`           // file to check existence of
+	ShouldExist    bool              `yaml:"shouldExist"`    // whether or not the file should exist
+	Permissions    string            `yaml:"permissions"`    // expected Unix permission string of the file, e.g. drwxrwxrwx
+	Uid            int               `yaml:"uid"`            // ID of the owner of the file
+	Gid            int               `yaml:"gid"`            // ID of the group of the file
+	IsExecutableBy string            `yaml:"isExecutableBy"` // name of group that file should be executable by
+	Sha256         string            `yaml:"sha256"`         // expected hex encoded SHA-256 digest of the file contents
+	Sha512         string            `yaml:"sha512"`         // expected hex encoded SHA-512 digest of the file contents
+	Size           *int64            `yaml:"size"`           // expected size of the file in bytes
+	MinSize        string            `yaml:"minSize"`        // minimum size of the file, e.g. 1KB
+	MaxSize        string            `yaml:"maxSize"`        // maximum size of the file, e.g. 50MB
+	IsSymlink      *bool             `yaml:"isSymlink"`      // whether or not the path should be a symlink
+	LinkTarget     string            `yaml:"linkTarget"`     // expected target of the symlink, exactly or as a regex
+	ResolvesTo     string            `yaml:"resolvesTo"`     // path the file should resolve to once all symlinks are followed
+	Xattrs         map[string]string `yaml:"xattrs"`         // expected values of extended attributes of the file
+	Capabilities   *[]string         `yaml:"capabilities"`   // exact set of file capabilities, e.g. cap_net_bind_service+ep
+
+	TestOptions `yaml:",inline"`
 }
 
+var (
+	sha256Digest = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	sha512Digest = regexp.MustCompile(`^[0-9a-fA-F]{128}$`)
+)
+
 func (fe FileExistenceTest) MarshalYAML() (interface{}, error) {
 	return FileExistenceTest{ShouldExist: true}, nil
 }
@@ -69,6 +96,25 @@ func (ft FileExistenceTest) Validate(channel chan interface{}) bool {
 	if ft.Path == "" {
 		res.Errorf("Please provide a valid file path for test %s", ft.Name)
 	}
+	if ft.Sha256 != "" && !sha256Digest.MatchString(ft.Sha256) {
+		res.Errorf("Invalid sha256 %s for test %s, please provide 64 hex characters", ft.Sha256, ft.Name)
+	}
+	if ft.Sha512 != "" && !sha512Digest.MatchString(ft.Sha512) {
+		res.Errorf("Invalid sha512 %s for test %s, please provide 128 hex characters", ft.Sha512, ft.Name)
+	}
+	for _, size := range []string{ft.MinSize, ft.MaxSize} {
+		if size == "" {
+			continue
+		}
+		if _, err := units.FromHumanSize(size); err != nil {
+			res.Errorf("Invalid size %s for test %s: %s", size, ft.Name, err)
+		}
+	}
+	if ft.Capabilities != nil {
+		if _, err := capabilities.Normalize(*ft.Capabilities); err != nil {
+			res.Errorf("Invalid capabilities for test %s: %s", ft.Name, err)
+		}
+	}
 	if len(res.Errors) > 0 {
 		channel <- res
 		return false
@@ -92,9 +138,13 @@ func (ft FileExistenceTest) Run(driver drivers.Driver) *types.TestResult {
 	if err != nil {
 		logrus.Errorf("error retrieving image config: %s", err.Error())
 	}
+	// links are checked first, as the stat follows them and fails for a dangling one
+	if ft.IsSymlink != nil || ft.LinkTarget != "" {
+		ft.checkLink(driver, result, utils.SubstituteEnvVar(ft.Path, config.Env))
+	}
 	info, err = driver.StatFile(utils.SubstituteEnvVar(ft.Path, config.Env))
 	if info == nil && ft.ShouldExist {
-		result.Errorf(errors.Wrap(err, "Error examining file in container").Error())
+		result.Error(errors.Wrap(err, "Error examining file in container").Error())
 		result.Fail()
 		return result
 	}
@@ -156,5 +206,159 @@ func (ft FileExistenceTest) Run(driver drivers.Driver) *types.TestResult {
 			result.Fail()
 		}
 	}
+	if ft.ResolvesTo != "" && info != nil {
+		expected := path.Clean("/" + utils.SubstituteEnvVar(ft.ResolvesTo, config.Env))
+		resolved, err := drivers.Resolve(driver, utils.SubstituteEnvVar(ft.Path, config.Env))
+		if err != nil {
+			result.Errorf("Error resolving symlinks in %s: %s", ft.Path, err)
+			result.Fail()
+		} else if resolved != expected {
+			result.Errorf("%s resolves to the wrong path. Expected: %s, Actual: %s", ft.Path, expected, resolved)
+			result.Fail()
+		}
+	}
+	if info != nil && (len(ft.Xattrs) > 0 || ft.Capabilities != nil) {
+		ft.checkXattrs(driver, result, utils.SubstituteEnvVar(ft.Path, config.Env))
+	}
+	if info != nil && ft.checksContents() {
+		ft.checkContents(driver, result, utils.SubstituteEnvVar(ft.Path, config.Env))
+	}
 	return result
 }
+
+func (ft FileExistenceTest) checkLink(driver drivers.Driver, result *types.TestResult, path string) {
+	info, err := driver.Lstat(path)
+	if err != nil {
+		// a path that shouldn't exist is reported as existing or not by the caller
+		if ft.ShouldExist {
+			result.Errorf("Error examining link %s: %s", ft.Path, err)
+			result.Fail()
+		}
+		return
+	}
+	target, isLink := drivers.LinkTarget(info)
+	if ft.IsSymlink != nil && isLink != *ft.IsSymlink {
+		if isLink {
+			result.Errorf("%s should not be a symlink but links to %s", ft.Path, target)
+		} else {
+			result.Errorf("%s should be a symlink but is not", ft.Path)
+		}
+		result.Fail()
+	}
+	if ft.LinkTarget == "" {
+		return
+	}
+	if !isLink {
+		result.Errorf("%s is not a symlink, expected it to link to %s", ft.Path, ft.LinkTarget)
+		result.Fail()
+		return
+	}
+	if target != ft.LinkTarget {
+		// the target can also be given as a regex
+		r, err := regexp.Compile("^(?:" + ft.LinkTarget + ")$")
+		if err != nil || !r.MatchString(target) {
+			result.Errorf("%s has incorrect link target. Expected: %s, Actual: %s", ft.Path, ft.LinkTarget, target)
+			result.Fail()
+		}
+	}
+}
+
+func (ft FileExistenceTest) checkXattrs(driver drivers.Driver, result *types.TestResult, path string) {
+	info, err := drivers.FullInfo(driver, path)
+	if err != nil {
+		result.Errorf("Error reading extended attributes of %s: %s", ft.Path, err)
+		result.Fail()
+		return
+	}
+	attrs := drivers.Xattrs(info)
+	for name, expected := range ft.Xattrs {
+		actual, ok := attrs[name]
+		if !ok {
+			result.Errorf("%s is missing extended attribute %s", ft.Path, name)
+			result.Fail()
+		} else if actual != expected {
+			result.Errorf("%s has incorrect extended attribute %s. Expected: %q, Actual: %q", ft.Path, name, expected, actual)
+			result.Fail()
+		}
+	}
+	if ft.Capabilities == nil {
+		return
+	}
+	// already validated
+	expected, _ := capabilities.Normalize(*ft.Capabilities)
+	var actual []string
+	if value, ok := attrs[capabilities.Xattr]; ok {
+		if actual, err = capabilities.Decode([]byte(value)); err != nil {
+			result.Errorf("Error decoding capabilities of %s: %s", ft.Path, err)
+			result.Fail()
+			return
+		}
+	}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		result.Errorf("%s has incorrect capabilities. Expected: %v, Actual: %v", ft.Path, expected, actual)
+		result.Fail()
+	}
+}
+
+func (ft FileExistenceTest) checksContents() bool {
+	return ft.Sha256 != "" || ft.Sha512 != "" || ft.Size != nil || ft.MinSize != "" || ft.MaxSize != ""
+}
+
+// checkContents streams the file through the requested hashes, counting its size
+// along the way, so large files are never held in memory.
+func (ft FileExistenceTest) checkContents(driver drivers.Driver, result *types.TestResult, path string) {
+	rc, err := driver.OpenFile(path)
+	if err != nil {
+		result.Errorf("Error opening file %s: %s", ft.Path, err)
+		result.Fail()
+		return
+	}
+	defer rc.Close()
+	var sha256Hash, sha512Hash hash.Hash
+	writers := []io.Writer{}
+	if ft.Sha256 != "" {
+		sha256Hash = sha256.New()
+		writers = append(writers, sha256Hash)
+	}
+	if ft.Sha512 != "" {
+		sha512Hash = sha512.New()
+		writers = append(writers, sha512Hash)
+	}
+	size, err := io.Copy(io.MultiWriter(writers...), rc)
+	if err != nil {
+		result.Errorf("Error reading file %s: %s", ft.Path, err)
+		result.Fail()
+		return
+	}
+	if sha256Hash != nil {
+		if actual := hex.EncodeToString(sha256Hash.Sum(nil)); actual != strings.ToLower(ft.Sha256) {
+			result.Errorf("%s has incorrect sha256. Expected: %s, Actual: %s", ft.Path, ft.Sha256, actual)
+			result.Fail()
+		}
+	}
+	if sha512Hash != nil {
+		if actual := hex.EncodeToString(sha512Hash.Sum(nil)); actual != strings.ToLower(ft.Sha512) {
+			result.Errorf("%s has incorrect sha512. Expected: %s, Actual: %s", ft.Path, ft.Sha512, actual)
+			result.Fail()
+		}
+	}
+	if ft.Size != nil && size != *ft.Size {
+		result.Errorf("%s has incorrect size. Expected: %d, Actual: %d", ft.Path, *ft.Size, size)
+		result.Fail()
+	}
+	if ft.MinSize != "" {
+		// already validated
+		min, _ := units.FromHumanSize(ft.MinSize)
+		if size < min {
+			result.Errorf("%s is %d bytes, smaller than %s", ft.Path, size, ft.MinSize)
+			result.Fail()
+		}
+	}
+	if ft.MaxSize != "" {
+		max, _ := units.FromHumanSize(ft.MaxSize)
+		if size > max {
+			result.Errorf("%s is %d bytes, larger than %s", ft.Path, size, ft.MaxSize)
+			result.Fail()
+		}
+	}
+}
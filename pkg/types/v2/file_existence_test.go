@@ -0,0 +1,74 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestFileExistenceDanglingSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "links")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	link := filepath.Join(dir, "dangling")
+	if err := os.Symlink("/nonexistent", link); err != nil {
+		t.Fatal(err)
+	}
+	driver, err := drivers.NewHostDriver(drivers.DriverConfig{Metadata: filepath.Join(dir, "missing.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes, no := true, false
+
+	tables := []struct {
+		name   string
+		test   FileExistenceTest
+		pass   bool
+		errors int
+	}{
+		{
+			name: "dangling link asserted",
+			test: FileExistenceTest{Path: link, ShouldExist: false, IsSymlink: &yes, LinkTarget: "/nonexistent"},
+			pass: true,
+		},
+		{
+			name:   "dangling link mismatch",
+			test:   FileExistenceTest{Path: link, ShouldExist: false, IsSymlink: &no},
+			pass:   false,
+			errors: 1,
+		},
+		{
+			name: "missing path that shouldn't exist",
+			test: FileExistenceTest{Path: filepath.Join(dir, "missing"), ShouldExist: false, IsSymlink: &yes},
+			pass: true,
+		},
+	}
+	for _, table := range tables {
+		table.test.Uid, table.test.Gid = defaultOwnership, defaultOwnership
+		result := table.test.Run(driver)
+		testutil.CheckDeepEqual(t, table.pass, result.IsPass())
+		if len(result.Errors) != table.errors {
+			t.Errorf("%s: expected %d errors, got %v", table.name, table.errors, result.Errors)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+// FileTreeTest walks the tree under Root and checks every path matching its
+// globs. symlinks are exempt from the permission checks, since their own
+// permissions are meaningless.
+type FileTreeTest struct {
+	Name               string   `yaml:"name"`               // name of test
+	Root               string   `yaml:"root"`               // directory to walk
+	Include            []string `yaml:"include"`            // globs of paths to check, every path under root if empty
+	Exclude            []string `yaml:"exclude"`            // globs of paths not to check
+	Uid                *int     `yaml:"uid"`                // ID of the owner of every path
+	Gid                *int     `yaml:"gid"`                // ID of the group of every path
+	MaxPermissions     string   `yaml:"maxPermissions"`     // octal permission bits no path may exceed, e.g. 0755
+	NoWorldWritable    bool     `yaml:"noWorldWritable"`    // fail on paths writable by others
+	NoSetuid           bool     `yaml:"noSetuid"`           // fail on paths with the setuid bit
+	NoSetgid           bool     `yaml:"noSetgid"`           // fail on paths with the setgid bit
+	NoDanglingSymlinks bool     `yaml:"noDanglingSymlinks"` // fail on symlinks whose target doesn't exist
+	MinFiles           *int     `yaml:"minFiles"`           // minimum number of matching paths that aren't directories
+	MaxFiles           *int     `yaml:"maxFiles"`           // maximum number of matching paths that aren't directories
+
+	TestOptions `yaml:",inline"`
+}
+
+func (ft FileTreeTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if ft.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = ft.Name
+	if ft.Root == "" {
+		res.Errorf("Please provide a valid root for test %s", ft.Name)
+	}
+	for _, globs := range [][]string{ft.Include, ft.Exclude} {
+		for _, glob := range globs {
+			if _, err := utils.CompileGlob(glob); err != nil {
+				res.Errorf("%s for test %s", err, ft.Name)
+			}
+		}
+	}
+	if ft.MaxPermissions != "" {
+		if _, err := parsePermissions(ft.MaxPermissions); err != nil {
+			res.Errorf("Invalid maxPermissions %s for test %s, please provide octal permissions such as 0755", ft.MaxPermissions, ft.Name)
+		}
+	}
+	if ft.MinFiles != nil && ft.MaxFiles != nil && *ft.MinFiles > *ft.MaxFiles {
+		res.Errorf("minFiles cannot be greater than maxFiles for test %s", ft.Name)
+	}
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (ft FileTreeTest) LogName() string {
+	return fmt.Sprintf("File Tree Test: %s", ft.Name)
+}
+
+func parsePermissions(perms string) (os.FileMode, error) {
+	p, err := strconv.ParseUint(perms, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if p > 0777 {
+		return 0, fmt.Errorf("permissions %s out of range", perms)
+	}
+	return os.FileMode(p), nil
+}
+
+func (ft FileTreeTest) Run(driver drivers.Driver) *types.TestResult {
+	result := &types.TestResult{
+		Name:   ft.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(ft.LogName())
+	config, err := driver.GetConfig()
+	if err != nil {
+		logrus.Errorf("error retrieving image config: %s", err.Error())
+	}
+	root := path.Clean("/" + utils.SubstituteEnvVar(ft.Root, config.Env))
+	// already validated
+	include := compileGlobs(ft.Include)
+	exclude := compileGlobs(ft.Exclude)
+	maxPermissions, _ := parsePermissions(ft.MaxPermissions)
+
+	files := 0
+	checkOwnership := ft.Uid != nil || ft.Gid != nil
+	err = driver.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if len(include) > 0 && matchingGlob(p, ft.Include, include) == "" {
+			return nil
+		}
+		if matchingGlob(p, ft.Exclude, exclude) != "" {
+			return nil
+		}
+		if !info.IsDir() {
+			files++
+		}
+		mode := info.Mode()
+		isLink := mode&os.ModeSymlink != 0
+		if ft.MaxPermissions != "" && !isLink && mode.Perm()&^maxPermissions != 0 {
+			result.Errorf("%s has permissions %s, which exceed %s", p, mode.Perm(), maxPermissions)
+			result.Fail()
+		}
+		if ft.NoWorldWritable && !isLink && mode&0002 != 0 {
+			result.Errorf("%s is world writable: %s", p, mode)
+			result.Fail()
+		}
+		if ft.NoSetuid && mode&os.ModeSetuid != 0 {
+			result.Errorf("%s has the setuid bit set: %s", p, mode)
+			result.Fail()
+		}
+		if ft.NoSetgid && mode&os.ModeSetgid != 0 {
+			result.Errorf("%s has the setgid bit set: %s", p, mode)
+			result.Fail()
+		}
+		if ft.NoDanglingSymlinks && isLink {
+			if _, err := driver.StatFile(p); err != nil {
+				result.Errorf("%s is a dangling symlink", p)
+				result.Fail()
+			}
+		}
+		if checkOwnership {
+			header, ok := info.Sys().(*tar.Header)
+			if !ok {
+				result.Errorf("Error checking ownership of file %s", p)
+				result.Fail()
+				// the driver doesn't expose ownership, so don't report every path
+				checkOwnership = false
+				return nil
+			}
+			if ft.Uid != nil && header.Uid != *ft.Uid {
+				result.Errorf("%s has incorrect user ownership. Expected: %d, Actual: %d", p, *ft.Uid, header.Uid)
+				result.Fail()
+			}
+			if ft.Gid != nil && header.Gid != *ft.Gid {
+				result.Errorf("%s has incorrect group ownership. Expected: %d, Actual: %d", p, *ft.Gid, header.Gid)
+				result.Fail()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		result.Errorf("Error walking %s: %s", root, err)
+		result.Fail()
+		return result
+	}
+
+	if ft.MinFiles != nil && files < *ft.MinFiles {
+		result.Errorf("Found %d files under %s, expected at least %d", files, root, *ft.MinFiles)
+		result.Fail()
+	}
+	if ft.MaxFiles != nil && files > *ft.MaxFiles {
+		result.Errorf("Found %d files under %s, expected at most %d", files, root, *ft.MaxFiles)
+		result.Fail()
+	}
+	return result
+}
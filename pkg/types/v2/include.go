@@ -0,0 +1,81 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v2
+
+import (
+	"fmt"
+	"reflect"
+)
+
+func (st *StructureTest) Includes() []string {
+	return st.Include
+}
+
+// Merge adds the tests of the config file at path file, included by this one.
+// they run before the tests defined here, and are reported as defined in file.
+// the metadata test is combined into a single test reported as defined here:
+// its lists are combined, and any other field set here takes precedence over
+// the included one. bools like exact are pointers, so setting them to false
+// here overrides true in an included file.
+func (st *StructureTest) Merge(included interface{}, file string) error {
+	other, ok := included.(*StructureTest)
+	if !ok {
+		return fmt.Errorf("cannot include a config of type %T in a schema version 2 config", included)
+	}
+	setFile(reflect.ValueOf(other).Elem(), file)
+	merge(reflect.ValueOf(st).Elem(), reflect.ValueOf(other).Elem())
+	return nil
+}
+
+// setFile records file as the config file of the tests in the lists of st that
+// don't have one yet, i.e. that weren't included from another file.
+func setFile(st reflect.Value, file string) {
+	for i := 0; i < st.NumField(); i++ {
+		tests := st.Field(i)
+		if tests.Kind() != reflect.Slice || tests.Type().Elem().Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < tests.Len(); j++ {
+			if opts := tests.Index(j).FieldByName("TestOptions"); opts.IsValid() && opts.FieldByName("File").String() == "" {
+				opts.FieldByName("File").SetString(file)
+			}
+		}
+	}
+}
+
+// merge prepends the elements of the slices in src to those in dst, merges
+// structs field by field, and sets anything else that is unset in dst to its
+// value in src. a nil pointer is unset, so false or an empty list set through a
+// pointer isn't replaced.
+func merge(dst, src reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Slice:
+		if src.Len() == 0 {
+			return
+		}
+		merged := reflect.MakeSlice(dst.Type(), 0, src.Len()+dst.Len())
+		dst.Set(reflect.AppendSlice(reflect.AppendSlice(merged, src), dst))
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			// unexported fields, like the parallelism, aren't part of the config
+			if dst.Type().Field(i).PkgPath == "" {
+				merge(dst.Field(i), src.Field(i))
+			}
+		}
+	default:
+		if reflect.DeepEqual(dst.Interface(), reflect.Zero(dst.Type()).Interface()) {
+			dst.Set(src)
+		}
+	}
+}
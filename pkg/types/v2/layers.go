@@ -0,0 +1,215 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"regexp"
+
+	units "github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// LayerTest checks the number and size of the image layers, and the paths
+// they change. path checks apply to the layer at Layer, to the layers whose
+// history matches CreatedBy, or to every layer if neither is set.
+type LayerTest struct {
+	Name                     string   `yaml:"name"`                     // name of test
+	LayerCount               *int     `yaml:"layerCount"`               // exact number of layers
+	MaxLayers                *int     `yaml:"maxLayers"`                // maximum number of layers
+	MaxLayerSize             string   `yaml:"maxLayerSize"`             // maximum compressed size of any layer, e.g. 50MB
+	MaxLayerUncompressedSize string   `yaml:"maxLayerUncompressedSize"` // maximum uncompressed size of any layer
+	MaxTotalSize             string   `yaml:"maxTotalSize"`             // maximum compressed size of all layers
+	MaxTotalUncompressedSize string   `yaml:"maxTotalUncompressedSize"` // maximum uncompressed size of all layers
+	Layer                    *int     `yaml:"layer"`                    // index of the layer to check, negative indexes count from the top
+	CreatedBy                string   `yaml:"createdBy"`                // regex matching the history of the layers to check
+	ExpectedAdded            []string `yaml:"expectedAdded"`            // regexes of paths that must be added
+	ExcludedAdded            []string `yaml:"excludedAdded"`            // regexes of paths that must not be added
+	ExpectedModified         []string `yaml:"expectedModified"`         // regexes of paths that must be modified
+	ExcludedModified         []string `yaml:"excludedModified"`         // regexes of paths that must not be modified
+	ExpectedDeleted          []string `yaml:"expectedDeleted"`          // regexes of paths that must be whited out
+	ExcludedDeleted          []string `yaml:"excludedDeleted"`          // regexes of paths that must not be whited out
+
+	TestOptions `yaml:",inline"`
+}
+
+func (lt LayerTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if lt.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = lt.Name
+	if lt.LayerCount != nil && *lt.LayerCount < 0 {
+		res.Errorf("Invalid layer count %d for test %s", *lt.LayerCount, lt.Name)
+	}
+	if lt.MaxLayers != nil && *lt.MaxLayers < 0 {
+		res.Errorf("Invalid max layers %d for test %s", *lt.MaxLayers, lt.Name)
+	}
+	for _, size := range []string{lt.MaxLayerSize, lt.MaxLayerUncompressedSize, lt.MaxTotalSize, lt.MaxTotalUncompressedSize} {
+		if size == "" {
+			continue
+		}
+		if _, err := units.FromHumanSize(size); err != nil {
+			res.Errorf("Invalid size %s for test %s: %s", size, lt.Name, err)
+		}
+	}
+	if lt.Layer != nil && lt.CreatedBy != "" {
+		res.Errorf("Only one of layer and createdBy can be set for test %s", lt.Name)
+	}
+	regexes := []string{lt.CreatedBy}
+	for _, r := range [][]string{lt.ExpectedAdded, lt.ExcludedAdded, lt.ExpectedModified, lt.ExcludedModified, lt.ExpectedDeleted, lt.ExcludedDeleted} {
+		regexes = append(regexes, r...)
+	}
+	for _, r := range regexes {
+		if _, err := regexp.Compile(r); err != nil {
+			res.Errorf("Invalid regex %s for test %s: %s", r, lt.Name, err)
+		}
+	}
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (lt LayerTest) LogName() string {
+	return fmt.Sprintf("Layer Test: %s", lt.Name)
+}
+
+func (lt LayerTest) Run(layers []types.Layer) *types.TestResult {
+	result := &types.TestResult{
+		Name:   lt.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(lt.LogName())
+
+	if lt.LayerCount != nil && len(layers) != *lt.LayerCount {
+		result.Errorf("Expected %d layers, found %d", *lt.LayerCount, len(layers))
+		result.Fail()
+	}
+	if lt.MaxLayers != nil && len(layers) > *lt.MaxLayers {
+		result.Errorf("Expected at most %d layers, found %d", *lt.MaxLayers, len(layers))
+		result.Fail()
+	}
+
+	// sizes were checked in Validate
+	var total, totalUncompressed int64
+	for i, layer := range layers {
+		total += layer.Size
+		totalUncompressed += layer.UncompressedSize
+		if lt.MaxLayerSize != "" {
+			max, _ := units.FromHumanSize(lt.MaxLayerSize)
+			if layer.Size > max {
+				result.Errorf("Layer %d (%s) is %s, larger than %s", i, layer.Digest, units.HumanSize(float64(layer.Size)), lt.MaxLayerSize)
+				result.Fail()
+			}
+		}
+		if lt.MaxLayerUncompressedSize != "" {
+			max, _ := units.FromHumanSize(lt.MaxLayerUncompressedSize)
+			if layer.UncompressedSize > max {
+				result.Errorf("Layer %d (%s) is %s uncompressed, larger than %s", i, layer.Digest, units.HumanSize(float64(layer.UncompressedSize)), lt.MaxLayerUncompressedSize)
+				result.Fail()
+			}
+		}
+	}
+	if lt.MaxTotalSize != "" {
+		max, _ := units.FromHumanSize(lt.MaxTotalSize)
+		if total > max {
+			result.Errorf("Image layers total %s, larger than %s", units.HumanSize(float64(total)), lt.MaxTotalSize)
+			result.Fail()
+		}
+	}
+	if lt.MaxTotalUncompressedSize != "" {
+		max, _ := units.FromHumanSize(lt.MaxTotalUncompressedSize)
+		if totalUncompressed > max {
+			result.Errorf("Image layers total %s uncompressed, larger than %s", units.HumanSize(float64(totalUncompressed)), lt.MaxTotalUncompressedSize)
+			result.Fail()
+		}
+	}
+
+	selected, err := lt.selectLayers(layers)
+	if err != nil {
+		result.Error(err.Error())
+		result.Fail()
+		return result
+	}
+	var added, modified, deleted []string
+	for _, layer := range selected {
+		added = append(added, layer.Added...)
+		modified = append(modified, layer.Modified...)
+		deleted = append(deleted, layer.Deleted...)
+	}
+	checkPaths(result, "added", added, lt.ExpectedAdded, lt.ExcludedAdded)
+	checkPaths(result, "modified", modified, lt.ExpectedModified, lt.ExcludedModified)
+	checkPaths(result, "deleted", deleted, lt.ExpectedDeleted, lt.ExcludedDeleted)
+	return result
+}
+
+// selectLayers returns the layers the path checks apply to.
+func (lt LayerTest) selectLayers(layers []types.Layer) ([]types.Layer, error) {
+	if lt.Layer != nil {
+		i := *lt.Layer
+		if i < 0 {
+			i += len(layers)
+		}
+		if i < 0 || i >= len(layers) {
+			return nil, fmt.Errorf("Layer %d out of range, image has %d layers", *lt.Layer, len(layers))
+		}
+		return layers[i : i+1], nil
+	}
+	if lt.CreatedBy == "" {
+		return layers, nil
+	}
+	r := regexp.MustCompile(lt.CreatedBy)
+	var selected []types.Layer
+	for _, layer := range layers {
+		if r.MatchString(layer.CreatedBy) {
+			selected = append(selected, layer)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("No layer created by '%s' found", lt.CreatedBy)
+	}
+	return selected, nil
+}
+
+func checkPaths(result *types.TestResult, change string, paths []string, expected []string, excluded []string) {
+	for _, e := range expected {
+		r := regexp.MustCompile(e)
+		found := false
+		for _, p := range paths {
+			if r.MatchString(p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Errorf("Expected path matching '%s' to be %s", e, change)
+			result.Fail()
+		}
+	}
+	for _, e := range excluded {
+		r := regexp.MustCompile(e)
+		for _, p := range paths {
+			if r.MatchString(p) {
+				result.Errorf("Excluded path '%s' matching '%s' was %s", p, e, change)
+				result.Fail()
+			}
+		}
+	}
+}
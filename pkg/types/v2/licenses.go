@@ -22,95 +22,182 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/licenses"
 	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
 	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
 )
 
-// Not currently used, but leaving the possibility open
+// LicenseTest checks the licenses of the Debian packages in the image, and of
+// any other copyright files listed, against a license policy. licenses are read
+// from the License fields of machine readable copyright files. other copyright
+// files fail if they contain any of the denied licenses.
 type LicenseTest struct {
-	Debian bool     `yaml:"debian"`
-	Files  []string `yaml:"files"`
+	Debian          bool                `yaml:"debian"`
+	Files           []string            `yaml:"files"`
+	DeniedLicenses  *[]string           `yaml:"deniedLicenses"`  // defaults to AGPL and WTFPL
+	AllowedLicenses []string            `yaml:"allowedLicenses"` // if set, the only licenses machine readable copyright files may declare
+	Exceptions      *[]LicenseException `yaml:"exceptions"`      // defaults to skipping libgnutls30
+
+	TestOptions `yaml:",inline"`
+}
+
+// LicenseException exempts a package from the license policy. if licenses are
+// given, only those licenses are exempt, otherwise the package isn't checked at all.
+type LicenseException struct {
+	Package  string   `yaml:"package"`
+	Licenses []string `yaml:"licenses"`
 }
 
 var (
-	// Whitelist is the list of packages that we want to automatically pass this
-	// check even if it would normally fail for one reason or another.
-	whitelist = []string{"libgnutls30"}
+	// packages that we want to automatically pass this check even if it would
+	// normally fail for one reason or another.
+	defaultExceptions = []LicenseException{{Package: "libgnutls30"}}
 
-	// Blacklist is the set of words that, if contained in a license file, should cause a failure.
-	// This will most likely just be names of unsupported licenses.
-	blacklist = []string{"AGPL", "WTFPL"}
+	// licenses that cause a failure, unless the test sets its own.
+	defaultDeniedLicenses = []string{"AGPL", "WTFPL"}
 )
 
-func checkFile(licenseFile string, driver drivers.Driver) error {
-	// Read through the copyright file and make sure don't have an unauthorized license
-	license, err := driver.ReadFile(licenseFile)
-	if err != nil {
-		return fmt.Errorf("Error reading license file for %s: %s", licenseFile, err.Error())
+func (lt LicenseTest) deniedLicenses() []string {
+	if lt.DeniedLicenses == nil {
+		return defaultDeniedLicenses
+	}
+	return *lt.DeniedLicenses
+}
+
+func (lt LicenseTest) exceptions() []LicenseException {
+	if lt.Exceptions == nil {
+		return defaultExceptions
+	}
+	return *lt.Exceptions
+}
+
+// exception returns the exception for a package, if there is one.
+func (lt LicenseTest) exception(pkg string) (LicenseException, bool) {
+	for _, e := range lt.exceptions() {
+		if e.Package == pkg {
+			return e, true
+		}
+	}
+	return LicenseException{}, false
+}
+
+func matchesAny(license string, entries []string) bool {
+	for _, e := range entries {
+		if licenses.Matches(license, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (lt LicenseTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{
+		Name: lt.LogName(),
+	}
+	for _, list := range [][]string{lt.deniedLicenses(), lt.AllowedLicenses} {
+		for _, l := range list {
+			if l == "" {
+				res.Error("License cannot be empty")
+			}
+		}
 	}
-	contents := strings.ToUpper(string(license))
-	for _, b := range blacklist {
-		if strings.Contains(contents, b) {
-			return fmt.Errorf("Invalid license for %s, license contains %s", licenseFile, b)
+	for _, e := range lt.exceptions() {
+		if e.Package == "" {
+			res.Error("Please provide a package for every license exception")
 		}
 	}
-	return nil
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
 }
 
-func (lt LicenseTest) Run(driver drivers.Driver) *types.TestResult {
+// checkFile checks a copyright file against the license policy, returning a
+// result named after the package or file it was checked for.
+func (lt LicenseTest) checkFile(name string, licenseFile string, driver drivers.Driver) *types.TestResult {
 	result := &types.TestResult{
-		Name:   lt.LogName(),
+		Name:   fmt.Sprintf("%s: %s", lt.LogName(), name),
 		Pass:   true,
 		Errors: make([]string, 0),
 	}
+	exception, excepted := lt.exception(name)
+	if excepted && len(exception.Licenses) == 0 {
+		logrus.Debugf("skipping license check for %s", name)
+		return result
+	}
+	license, err := driver.ReadFile(licenseFile)
+	if err != nil {
+		result.Errorf("Error reading license file for %s: %s", name, err.Error())
+		result.Fail()
+		return result
+	}
+
+	ids, machineReadable := licenses.Detect(license)
+	if !machineReadable {
+		// fall back to looking for the denied licenses anywhere in the file
+		contents := strings.ToUpper(string(license))
+		for _, d := range lt.deniedLicenses() {
+			if strings.Contains(contents, strings.ToUpper(d)) && !matchesAny(d, exception.Licenses) {
+				result.Errorf("Invalid license for %s, license contains %s", name, d)
+				result.Fail()
+			}
+		}
+		if len(lt.AllowedLicenses) > 0 {
+			logrus.Warnf("%s is not machine readable, unable to check %s against allowed licenses", licenseFile, name)
+		}
+		return result
+	}
+
+	for _, id := range ids {
+		if matchesAny(id, exception.Licenses) {
+			continue
+		}
+		if matchesAny(id, lt.deniedLicenses()) {
+			result.Errorf("Invalid license for %s, %s is denied", name, id)
+			result.Fail()
+		} else if len(lt.AllowedLicenses) > 0 && !matchesAny(id, lt.AllowedLicenses) {
+			result.Errorf("Invalid license for %s, %s is not allowed", name, id)
+			result.Fail()
+		}
+	}
+	return result
+}
+
+// Run checks each package and file separately, so a failure in one is reported
+// on its own.
+func (lt LicenseTest) Run(driver drivers.Driver) []*types.TestResult {
+	var results []*types.TestResult
 	logrus.Debug(lt.LogName())
 	if lt.Debian {
 		root := utils.DebianRoot
 		packages, err := driver.ReadDir(root)
 		if err != nil {
+			result := &types.TestResult{
+				Name: lt.LogName(),
+			}
 			result.Errorf("Error reading directory: %s", err)
 			result.Fail()
-			return result
+			return []*types.TestResult{result}
 		}
 		for _, p := range packages {
 			if !p.IsDir() {
 				continue
 			}
-			logrus.Debugf(p.Name())
-			// Skip over packages in the whitelist
-			whitelisted := false
-			for _, w := range whitelist {
-				if w == p.Name() {
-					whitelisted = true
-					break
-				}
-			}
-			if whitelisted {
-				continue
-			}
-
-			// If package doesn't have copyright file, log an error.
+			logrus.Debug(p.Name())
 			licenseFile := path.Join(root, p.Name(), utils.LicenseFile)
-			_, err := driver.StatFile(licenseFile)
-			if err != nil {
-				result.Errorf("Error reading license file for %s: %s", p.Name(), err.Error())
-				result.Fail()
-			}
-
-			if err = checkFile(licenseFile, driver); err != nil {
-				result.Error(err.Error())
-				result.Fail()
-			}
+			results = append(results, lt.checkFile(p.Name(), licenseFile, driver))
 		}
 	}
 
 	for _, file := range lt.Files {
-		if err := checkFile(file, driver); err != nil {
-			result.Error(err.Error())
-			result.Fail()
-		}
+		results = append(results, lt.checkFile(file, file, driver))
 	}
-	return result
+	if len(results) == 0 {
+		// still report the test when there was nothing to check
+		results = append(results, &types.TestResult{Name: lt.LogName(), Pass: true})
+	}
+	return results
 }
 
 func (lt LicenseTest) LogName() string {
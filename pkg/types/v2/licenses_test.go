@@ -0,0 +1,33 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestLicenseTestWithNothingToCheck(t *testing.T) {
+	driver, err := drivers.NewHostDriver(drivers.DriverConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := LicenseTest{}.Run(driver)
+	testutil.CheckDeepEqual(t, 1, len(results))
+	testutil.CheckDeepEqual(t, "License Test", results[0].Name)
+	testutil.CheckDeepEqual(t, true, results[0].IsPass())
+}
@@ -15,6 +15,9 @@
 package v2
 
 import (
+	"sort"
+	"time"
+
 	"github.com/sirupsen/logrus"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
@@ -23,13 +26,42 @@ import (
 )
 
 type MetadataTest struct {
-	Env          []types.EnvVar `yaml:"env"`
-	ExposedPorts []string       `yaml:"exposedPorts"`
-	Entrypoint   *[]string      `yaml:"entrypoint"`
-	Cmd          *[]string      `yaml:"cmd"`
-	Workdir      string         `yaml:"workdir"`
-	Volumes      []string       `yaml:"volumes"`
-	Labels       []types.Label  `yaml:"labels"`
+	Env           []types.EnvVar `yaml:"env"`
+	ExposedPorts  []string       `yaml:"exposedPorts"`
+	Entrypoint    *[]string      `yaml:"entrypoint"`
+	Cmd           *[]string      `yaml:"cmd"`
+	Workdir       string         `yaml:"workdir"`
+	Volumes       []string       `yaml:"volumes"`
+	Labels        []types.Label  `yaml:"labels"`
+	User          string         `yaml:"user"`
+	Healthcheck   *Healthcheck   `yaml:"healthcheck"`
+	StopSignal    string         `yaml:"stopSignal"`
+	Shell         *[]string      `yaml:"shell"`
+	OnBuild       *[]string      `yaml:"onBuild"`
+	OS            string         `yaml:"os"`
+	Architecture  string         `yaml:"architecture"`
+	Variant       string         `yaml:"variant"`
+	Author        string         `yaml:"author"`
+	CreatedAfter  string         `yaml:"createdAfter"`  // RFC 3339 timestamp the image must be created after
+	CreatedBefore string         `yaml:"createdBefore"` // RFC 3339 timestamp the image must be created before
+
+	UnexposedPorts []string `yaml:"unexposedPorts"` // ports that must not be exposed
+	AbsentEnv      []string `yaml:"absentEnv"`      // keys of env vars that must not be set
+	AbsentLabels   []string `yaml:"absentLabels"`   // keys of labels that must not be set
+	// Exact fails on any env var, label, port or volume in the image that isn't listed above
+	Exact *bool `yaml:"exact"`
+
+	TestOptions `yaml:",inline"`
+}
+
+// Healthcheck is the expected image healthcheck. durations are in the format
+// accepted by time.ParseDuration, e.g. 30s.
+type Healthcheck struct {
+	Test        *[]string `yaml:"test"`
+	Interval    string    `yaml:"interval"`
+	Timeout     string    `yaml:"timeout"`
+	StartPeriod string    `yaml:"startPeriod"`
+	Retries     *int      `yaml:"retries"`
 }
 
 func (mt MetadataTest) IsEmpty() bool {
@@ -39,7 +71,26 @@ func (mt MetadataTest) IsEmpty() bool {
 		mt.Cmd == nil &&
 		mt.Workdir == "" &&
 		len(mt.Volumes) == 0 &&
-		len(mt.Labels) == 0
+		len(mt.Labels) == 0 &&
+		mt.User == "" &&
+		mt.Healthcheck == nil &&
+		mt.StopSignal == "" &&
+		mt.Shell == nil &&
+		mt.OnBuild == nil &&
+		mt.OS == "" &&
+		mt.Architecture == "" &&
+		mt.Variant == "" &&
+		mt.Author == "" &&
+		mt.CreatedAfter == "" &&
+		mt.CreatedBefore == "" &&
+		len(mt.UnexposedPorts) == 0 &&
+		len(mt.AbsentEnv) == 0 &&
+		len(mt.AbsentLabels) == 0 &&
+		!mt.exact()
+}
+
+func (mt MetadataTest) exact() bool {
+	return mt.Exact != nil && *mt.Exact
 }
 
 func (mt MetadataTest) LogName() string {
@@ -70,6 +121,39 @@ func (mt MetadataTest) Validate(channel chan interface{}) bool {
 			res.Error("Volume cannot be empty")
 		}
 	}
+	for _, key := range mt.AbsentEnv {
+		if key == "" {
+			res.Error("Absent environment variable key cannot be empty")
+		}
+	}
+	for _, key := range mt.AbsentLabels {
+		if key == "" {
+			res.Error("Absent label key cannot be empty")
+		}
+	}
+	for _, port := range mt.UnexposedPorts {
+		if port == "" {
+			res.Error("Unexposed port cannot be empty")
+		}
+	}
+	if h := mt.Healthcheck; h != nil {
+		for _, d := range []string{h.Interval, h.Timeout, h.StartPeriod} {
+			if d == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(d); err != nil {
+				res.Errorf("Invalid healthcheck duration %s: %s", d, err)
+			}
+		}
+	}
+	for _, t := range []string{mt.CreatedAfter, mt.CreatedBefore} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, t); err != nil {
+			res.Errorf("Invalid creation time %s, expected an RFC 3339 timestamp: %s", t, err)
+		}
+	}
 	if len(res.Errors) > 0 {
 		channel <- res
 		return false
@@ -172,5 +256,186 @@ func (mt MetadataTest) Run(driver drivers.Driver) *types.TestResult {
 			result.Fail()
 		}
 	}
+
+	for _, key := range mt.AbsentEnv {
+		if val, ok := imageConfig.Env[key]; ok {
+			result.Errorf("env var %s should not be set, found value %s", key, val)
+			result.Fail()
+		}
+	}
+
+	for _, key := range mt.AbsentLabels {
+		if val, ok := imageConfig.Labels[key]; ok {
+			result.Errorf("label %s should not be set, found value %s", key, val)
+			result.Fail()
+		}
+	}
+
+	for _, port := range mt.UnexposedPorts {
+		if utils.ValueInList(port, imageConfig.ExposedPorts) {
+			result.Errorf("Port %s should not be exposed", port)
+			result.Fail()
+		}
+	}
+
+	if mt.exact() {
+		mt.checkExact(result, imageConfig)
+	}
+
+	if mt.User != "" && mt.User != imageConfig.User {
+		result.Errorf("Image user %s does not match config user: %s", imageConfig.User, mt.User)
+		result.Fail()
+	}
+
+	if mt.Healthcheck != nil {
+		mt.checkHealthcheck(result, imageConfig.Healthcheck)
+	}
+
+	if mt.StopSignal != "" && mt.StopSignal != imageConfig.StopSignal {
+		result.Errorf("Image stop signal %s does not match config stop signal: %s", imageConfig.StopSignal, mt.StopSignal)
+		result.Fail()
+	}
+
+	if mt.Shell != nil && !stringSlicesEqual(*mt.Shell, imageConfig.Shell) {
+		result.Errorf("Image shell %v does not match expected shell: %v", imageConfig.Shell, *mt.Shell)
+		result.Fail()
+	}
+
+	if mt.OnBuild != nil && !stringSlicesEqual(*mt.OnBuild, imageConfig.OnBuild) {
+		result.Errorf("Image onbuild triggers %v do not match expected triggers: %v", imageConfig.OnBuild, *mt.OnBuild)
+		result.Fail()
+	}
+
+	if mt.OS != "" && mt.OS != imageConfig.OS {
+		result.Errorf("Image OS %s does not match config OS: %s", imageConfig.OS, mt.OS)
+		result.Fail()
+	}
+
+	if mt.Architecture != "" && mt.Architecture != imageConfig.Architecture {
+		result.Errorf("Image architecture %s does not match config architecture: %s", imageConfig.Architecture, mt.Architecture)
+		result.Fail()
+	}
+
+	if mt.Variant != "" && mt.Variant != imageConfig.Variant {
+		result.Errorf("Image variant %s does not match config variant: %s", imageConfig.Variant, mt.Variant)
+		result.Fail()
+	}
+
+	if mt.Author != "" && mt.Author != imageConfig.Author {
+		result.Errorf("Image author %s does not match config author: %s", imageConfig.Author, mt.Author)
+		result.Fail()
+	}
+
+	// timestamps were checked in Validate
+	if mt.CreatedAfter != "" {
+		after, _ := time.Parse(time.RFC3339, mt.CreatedAfter)
+		if !imageConfig.Created.After(after) {
+			result.Errorf("Image created at %s, expected after %s", imageConfig.Created.Format(time.RFC3339), mt.CreatedAfter)
+			result.Fail()
+		}
+	}
+	if mt.CreatedBefore != "" {
+		before, _ := time.Parse(time.RFC3339, mt.CreatedBefore)
+		if !imageConfig.Created.Before(before) {
+			result.Errorf("Image created at %s, expected before %s", imageConfig.Created.Format(time.RFC3339), mt.CreatedBefore)
+			result.Fail()
+		}
+	}
 	return result
 }
+
+// checkExact fails on any env var, label, port or volume the test doesn't expect.
+func (mt MetadataTest) checkExact(result *types.TestResult, imageConfig types.Config) {
+	env := map[string]bool{}
+	for _, pair := range mt.Env {
+		env[pair.Key] = true
+	}
+	for _, key := range sortedKeys(imageConfig.Env) {
+		if !env[key] {
+			result.Errorf("Unexpected env var %s=%s found in image", key, imageConfig.Env[key])
+			result.Fail()
+		}
+	}
+
+	labels := map[string]bool{}
+	for _, pair := range mt.Labels {
+		labels[pair.Key] = true
+	}
+	for _, key := range sortedKeys(imageConfig.Labels) {
+		if !labels[key] {
+			result.Errorf("Unexpected label %s=%s found in image", key, imageConfig.Labels[key])
+			result.Fail()
+		}
+	}
+
+	for _, port := range imageConfig.ExposedPorts {
+		if !utils.ValueInList(port, mt.ExposedPorts) {
+			result.Errorf("Unexpected port %s exposed by image", port)
+			result.Fail()
+		}
+	}
+
+	for _, volume := range imageConfig.Volumes {
+		if !utils.ValueInList(volume, mt.Volumes) {
+			result.Errorf("Unexpected volume %s found in image", volume)
+			result.Fail()
+		}
+	}
+}
+
+func (mt MetadataTest) checkHealthcheck(result *types.TestResult, actual *types.Healthcheck) {
+	if actual == nil {
+		result.Error("Image has no healthcheck")
+		result.Fail()
+		return
+	}
+	expected := mt.Healthcheck
+	if expected.Test != nil && !stringSlicesEqual(*expected.Test, actual.Test) {
+		result.Errorf("Image healthcheck test %v does not match expected test: %v", actual.Test, *expected.Test)
+		result.Fail()
+	}
+	// durations were checked in Validate
+	durations := []struct {
+		name     string
+		expected string
+		actual   time.Duration
+	}{
+		{"interval", expected.Interval, actual.Interval},
+		{"timeout", expected.Timeout, actual.Timeout},
+		{"start period", expected.StartPeriod, actual.StartPeriod},
+	}
+	for _, d := range durations {
+		if d.expected == "" {
+			continue
+		}
+		if e, _ := time.ParseDuration(d.expected); e != d.actual {
+			result.Errorf("Image healthcheck %s %s does not match expected %s: %s", d.name, d.actual, d.name, d.expected)
+			result.Fail()
+		}
+	}
+	if expected.Retries != nil && *expected.Retries != actual.Retries {
+		result.Errorf("Image healthcheck retries %d does not match expected retries: %d", actual.Retries, *expected.Retries)
+		result.Fail()
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
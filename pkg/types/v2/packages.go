@@ -0,0 +1,165 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/packages"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+type PackageTest struct {
+	Name             string            `yaml:"name"`             // name of test
+	Manager          string            `yaml:"manager"`          // dpkg, apk or rpm, detected from the image if empty
+	ExpectedPackages []ExpectedPackage `yaml:"expectedPackages"` // packages that must be installed
+	ExcludedPackages []string          `yaml:"excludedPackages"` // names of packages that must not be installed
+	AllowedPackages  []string          `yaml:"allowedPackages"`  // if set, names of the only packages other than the expected ones that may be installed
+
+	TestOptions `yaml:",inline"`
+}
+
+// ExpectedPackage is a package that must be installed, optionally at an exact
+// version or at a version matching a constraint such as ">= 1.2, < 2". package
+// names here and in the excluded and allowed lists match the package for every
+// architecture it is installed for, unless written as name:arch, e.g. libc6:i386.
+type ExpectedPackage struct {
+	Name              string `yaml:"name"`
+	Version           string `yaml:"version"`
+	VersionConstraint string `yaml:"versionConstraint"`
+}
+
+func (pt PackageTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if pt.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = pt.Name
+	if pt.Manager != "" && !packages.IsSupported(pt.Manager) {
+		res.Errorf("Unsupported package manager %s for test %s", pt.Manager, pt.Name)
+	}
+	for _, p := range pt.ExpectedPackages {
+		if p.Name == "" {
+			res.Errorf("Please provide a valid name for every expected package in test %s", pt.Name)
+		}
+		if p.Version != "" && p.VersionConstraint != "" {
+			res.Errorf("Only one of version and versionConstraint can be set for package %s in test %s", p.Name, pt.Name)
+		}
+		if p.VersionConstraint != "" {
+			if _, err := packages.ParseConstraint(p.VersionConstraint); err != nil {
+				res.Errorf("%s for package %s in test %s", err, p.Name, pt.Name)
+			}
+		}
+	}
+	for _, name := range pt.ExcludedPackages {
+		if name == "" {
+			res.Errorf("Excluded package name cannot be empty in test %s", pt.Name)
+		}
+	}
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (pt PackageTest) LogName() string {
+	return fmt.Sprintf("Package Test: %s", pt.Name)
+}
+
+func (pt PackageTest) Run(driver drivers.Driver) *types.TestResult {
+	result := &types.TestResult{
+		Name:   pt.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(pt.LogName())
+	manager, pkgs, err := packages.List(driver, pt.Manager)
+	if err != nil {
+		result.Errorf("Error listing installed packages: %s", err)
+		result.Fail()
+		return result
+	}
+	logrus.Debugf("found %d %s packages", len(pkgs), manager)
+
+	for _, expected := range pt.ExpectedPackages {
+		matching := installed(pkgs, expected.Name)
+		if len(matching) == 0 {
+			result.Errorf("Expected package %s is not installed", expected.Name)
+			result.Fail()
+			continue
+		}
+		for _, p := range matching {
+			if expected.Version != "" && packages.Compare(manager, p.Version, expected.Version) != 0 {
+				result.Errorf("Package %s is at version %s, expected %s", p.Key(), p.Version, expected.Version)
+				result.Fail()
+			}
+			if expected.VersionConstraint != "" {
+				// already validated
+				c, _ := packages.ParseConstraint(expected.VersionConstraint)
+				if !c.Matches(manager, p.Version) {
+					result.Errorf("Package %s is at version %s, expected %s", p.Key(), p.Version, expected.VersionConstraint)
+					result.Fail()
+				}
+			}
+		}
+	}
+
+	for _, name := range pt.ExcludedPackages {
+		for _, p := range installed(pkgs, name) {
+			result.Errorf("Excluded package %s is installed at version %s", p.Key(), p.Version)
+			result.Fail()
+		}
+	}
+
+	if len(pt.AllowedPackages) > 0 {
+		// expected packages are always allowed
+		allowed := append([]string{}, pt.AllowedPackages...)
+		for _, expected := range pt.ExpectedPackages {
+			allowed = append(allowed, expected.Name)
+		}
+		for _, p := range pkgs {
+			if !matchesName(p, allowed) {
+				result.Errorf("Package %s %s is not in the list of allowed packages", p.Key(), p.Version)
+				result.Fail()
+			}
+		}
+	}
+	return result
+}
+
+// installed returns the installed packages called name, for every architecture
+// unless name includes one.
+func installed(pkgs []packages.Package, name string) []packages.Package {
+	var res []packages.Package
+	for _, p := range pkgs {
+		if p.Matches(name) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func matchesName(p packages.Package, names []string) bool {
+	for _, name := range names {
+		if p.Matches(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+// SecretTest fails if a path matching any of its globs was written by any layer
+// of the image, even if a later layer deleted it, since the file can still be
+// extracted from the layer that added it.
+type SecretTest struct {
+	Name         string   `yaml:"name"`         // name of test
+	Paths        []string `yaml:"paths"`        // globs of paths that must never exist, e.g. **/id_rsa
+	AllowedPaths []string `yaml:"allowedPaths"` // globs of paths exempt from the check, e.g. /etc/ssl/certs/*.pem
+
+	TestOptions `yaml:",inline"`
+}
+
+func (st SecretTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if st.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = st.Name
+	if len(st.Paths) == 0 {
+		res.Errorf("Please provide at least one path for test %s", st.Name)
+	}
+	for _, globs := range [][]string{st.Paths, st.AllowedPaths} {
+		for _, glob := range globs {
+			if _, err := utils.CompileGlob(glob); err != nil {
+				res.Errorf("%s for test %s", err, st.Name)
+			}
+		}
+	}
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (st SecretTest) LogName() string {
+	return fmt.Sprintf("Secret Test: %s", st.Name)
+}
+
+func compileGlobs(globs []string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, glob := range globs {
+		// already validated
+		r, _ := utils.CompileGlob(glob)
+		res = append(res, r)
+	}
+	return res
+}
+
+func (st SecretTest) Run(layers []types.Layer) *types.TestResult {
+	result := &types.TestResult{
+		Name:   st.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(st.LogName())
+
+	paths := compileGlobs(st.Paths)
+	allowed := compileGlobs(st.AllowedPaths)
+	for i, layer := range layers {
+		for _, written := range [][]string{layer.Added, layer.Modified} {
+			for _, p := range written {
+				glob := matchingGlob(p, st.Paths, paths)
+				if glob == "" || matchingGlob(p, st.AllowedPaths, allowed) != "" {
+					continue
+				}
+				if layer.CreatedBy != "" {
+					result.Errorf("Path %s matching '%s' found in layer %d (%s) created by '%s'", p, glob, i, layer.Digest, layer.CreatedBy)
+				} else {
+					result.Errorf("Path %s matching '%s' found in layer %d (%s)", p, glob, i, layer.Digest)
+				}
+				result.Fail()
+			}
+		}
+	}
+	return result
+}
+
+// matchingGlob returns the first glob matching the path, or "" if none match.
+func matchingGlob(p string, globs []string, regexes []*regexp.Regexp) string {
+	for i, r := range regexes {
+		if r.MatchString(p) {
+			return globs[i]
+		}
+	}
+	return ""
+}
@@ -16,23 +16,56 @@ package v2
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
 	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
 )
 
 type StructureTest struct {
-	DriverImpl         func(drivers.DriverConfig) (drivers.Driver, error)
-	DriverArgs         drivers.DriverConfig
-	SchemaVersion      string              `yaml:"schemaVersion"`
-	GlobalEnvVars      []types.EnvVar      `yaml:"globalEnvVars"`
-	CommandTests       []CommandTest       `yaml:"commandTests"`
-	FileExistenceTests []FileExistenceTest `yaml:"fileExistenceTests"`
-	FileContentTests   []FileContentTest   `yaml:"fileContentTests"`
-	MetadataTest       MetadataTest        `yaml:"metadataTest"`
-	LicenseTests       []LicenseTest       `yaml:"licenseTests"`
+	DriverImpl             func(drivers.DriverConfig) (drivers.Driver, error)
+	DriverArgs             drivers.DriverConfig
+	SchemaVersion          string                  `yaml:"schemaVersion"`
+	GlobalEnvVars          []types.EnvVar          `yaml:"globalEnvVars"`
+	Include                []string                `yaml:"include"` // config files whose tests are run before these, relative to this file
+	CommandTests           []CommandTest           `yaml:"commandTests"`
+	FileExistenceTests     []FileExistenceTest     `yaml:"fileExistenceTests"`
+	FileContentTests       []FileContentTest       `yaml:"fileContentTests"`
+	MetadataTest           MetadataTest            `yaml:"metadataTest"`
+	LicenseTests           []LicenseTest           `yaml:"licenseTests"`
+	LayerTests             []LayerTest             `yaml:"layerTests"`
+	SecretTests            []SecretTest            `yaml:"secretTests"`
+	PackageTests           []PackageTest           `yaml:"packageTests"`
+	UserTests              []UserTest              `yaml:"userTests"`
+	FileTreeTests          []FileTreeTest          `yaml:"fileTreeTests"`
+	StructuredContentTests []StructuredContentTest `yaml:"structuredContentTests"`
+	CertificateTests       []CertificateTest       `yaml:"certificateTests"`
+	BinaryTests            []BinaryTest            `yaml:"binaryTests"`
+
+	parallel int
+	filter   *types.TestFilter
+	layers   layerCache
+}
+
+// layerCache holds the image layers, which are shared by every layer and
+// secret test since retrieving them can mean saving and reading the whole image.
+type layerCache struct {
+	once   sync.Once
+	layers []types.Layer
+	err    error
+}
+
+// TestOptions are the fields every test type has, controlling whether it runs
+// and how its result is reported.
+type TestOptions struct {
+	Tags          []string `yaml:"tags"`          // for selecting tests with --include-tags and --exclude-tags
+	Skip          string   `yaml:"skip"`          // reason the test isn't run
+	ExpectFailure string   `yaml:"expectFailure"` // reason the test is known to fail, passing is then a failure
+	File          string   `yaml:"-" json:"-"`    // config file the test was included from, if not the one being run
 }
 
 func (st *StructureTest) NewDriver() (drivers.Driver, error) {
@@ -44,6 +77,139 @@ func (st *StructureTest) SetDriverImpl(f func(drivers.DriverConfig) (drivers.Dri
 	st.DriverArgs = args
 }
 
+// imageLayers returns the layers of the image, retrieving them with a new
+// driver the first time.
+func (st *StructureTest) imageLayers() ([]types.Layer, error) {
+	st.layers.once.Do(func() {
+		driver, err := st.NewDriver()
+		if err != nil {
+			st.layers.err = fmt.Errorf("error creating driver: %s", err.Error())
+			return
+		}
+		defer driver.Destroy()
+		st.layers.layers, st.layers.err = driver.GetLayers()
+	})
+	return st.layers.layers, st.layers.err
+}
+
+func (st *StructureTest) SetParallelism(parallel int) {
+	st.parallel = parallel
+}
+
+func (st *StructureTest) SetFilter(filter *types.TestFilter) {
+	st.filter = filter
+}
+
+// filtered returns the job running a test, or one reporting the test as
+// skipped if it is marked to be skipped or the filter excludes it.
+func (st *StructureTest) filtered(name string, opts TestOptions, job utils.Job) utils.Job {
+	reason := st.filter.Skip(name, opts.Tags)
+	if reason == "" {
+		reason = opts.Skip
+	}
+	if reason != "" {
+		job = func(channel chan interface{}) {
+			channel <- types.Skipped(name, reason)
+		}
+	}
+	if opts.File == "" {
+		return job
+	}
+	return inFile(opts.File, job)
+}
+
+// inFile wraps the job of a test included from another config file so that its
+// results record that file.
+func inFile(file string, job utils.Job) utils.Job {
+	return func(channel chan interface{}) {
+		results := make(chan interface{}, 1)
+		go func() {
+			defer close(results)
+			job(results)
+		}()
+		for res := range results {
+			if r, ok := res.(*types.TestResult); ok {
+				r.File = file
+			}
+			channel <- res
+		}
+	}
+}
+
+// expected marks the result of a test that ran as an expected failure if the
+// test is expected to fail. results reporting an invalid test or an error
+// setting it up aren't passed through this, so they stay failures.
+func expected(opts TestOptions, result *types.TestResult) *types.TestResult {
+	if opts.ExpectFailure != "" {
+		result.ExpectFailure(opts.ExpectFailure)
+	}
+	return result
+}
+
+// expectedAll is expected for a test reporting several results. the test is an
+// expected failure if any of them failed, which are then marked as such, and
+// otherwise a single unexpected pass is reported in their place.
+func expectedAll(name string, opts TestOptions, results []*types.TestResult) []*types.TestResult {
+	if opts.ExpectFailure == "" {
+		return results
+	}
+	failed := false
+	for _, result := range results {
+		if !result.IsPass() {
+			failed = true
+			expected(opts, result)
+		}
+	}
+	if failed {
+		return results
+	}
+	return []*types.TestResult{expected(opts, &types.TestResult{Name: name, Pass: true})}
+}
+
+// driverTest is a test run against a driver of its own.
+type driverTest interface {
+	Validate(channel chan interface{}) bool
+	LogName() string
+	Run(driver drivers.Driver) *types.TestResult
+}
+
+// runDriverTest validates a test and runs it against a new driver.
+func (st *StructureTest) runDriverTest(channel chan interface{}, test driverTest, opts TestOptions) {
+	if !test.Validate(channel) {
+		return
+	}
+	st.withDriver(channel, test.LogName(), st.DriverArgs, func(driver drivers.Driver) {
+		channel <- expected(opts, test.Run(driver))
+	})
+}
+
+// withDriver creates a driver with the global env vars set and passes it to run,
+// destroying it afterwards. failing to do so is reported as the result of the
+// test named name.
+func (st *StructureTest) withDriver(channel chan interface{}, name string, args drivers.DriverConfig, run func(drivers.Driver)) {
+	driver, err := st.DriverImpl(args)
+	if err != nil {
+		channel <- &types.TestResult{
+			Name: name,
+			Errors: []string{
+				fmt.Sprintf("error creating driver: %s", err.Error()),
+			},
+		}
+		return
+	}
+	defer driver.Destroy()
+	if err = driver.SetEnv(st.GlobalEnvVars); err != nil {
+		channel <- &types.TestResult{
+			Name: name,
+			Errors: []string{
+				fmt.Sprintf("error setting env vars: %s", err.Error()),
+			},
+		}
+		return
+	}
+	run(driver)
+}
+
 func (st *StructureTest) RunAll(channel chan interface{}, file string) {
 	fileProcessed := make(chan bool, 1)
 	go st.runAll(channel, fileProcessed)
@@ -51,128 +217,238 @@ func (st *StructureTest) RunAll(channel chan interface{}, file string) {
 }
 
 func (st *StructureTest) runAll(channel chan interface{}, fileProcessed chan bool) {
-	st.RunCommandTests(channel)
-	st.RunFileContentTests(channel)
-	st.RunFileExistenceTests(channel)
-	st.RunLicenseTests(channel)
-	st.RunMetadataTests(channel)
+	var jobs []utils.Job
+	jobs = append(jobs, st.commandTestJobs()...)
+	jobs = append(jobs, st.fileContentTestJobs()...)
+	jobs = append(jobs, st.fileExistenceTestJobs()...)
+	jobs = append(jobs, st.licenseTestJobs()...)
+	jobs = append(jobs, st.metadataTestJobs()...)
+	jobs = append(jobs, st.layerTestJobs()...)
+	jobs = append(jobs, st.secretTestJobs()...)
+	jobs = append(jobs, st.packageTestJobs()...)
+	jobs = append(jobs, st.userTestJobs()...)
+	jobs = append(jobs, st.fileTreeTestJobs()...)
+	jobs = append(jobs, st.structuredContentTestJobs()...)
+	jobs = append(jobs, st.certificateTestJobs()...)
+	jobs = append(jobs, st.binaryTestJobs()...)
+	for i := range jobs {
+		jobs[i] = utils.Timed(jobs[i])
+	}
+	utils.RunJobs(channel, st.parallel, jobs)
 	fileProcessed <- true
 }
 
-func (st *StructureTest) RunCommandTests(channel chan interface{}) {
+func (st *StructureTest) commandTestJobs() []utils.Job {
+	var jobs []utils.Job
 	for _, test := range st.CommandTests {
-		if !test.Validate(channel) {
-			continue
-		}
-		res := &types.TestResult{
-			Name: test.Name,
-			Pass: false,
-		}
-		driver, err := st.NewDriver()
-		if err != nil {
-			res.Errorf("error creating driver: %s", err.Error())
-			channel <- res
-			continue
-		}
-		defer driver.Destroy()
-		if err = driver.SetEnv(st.GlobalEnvVars); err != nil {
-			res.Errorf("error setting env vars: %s", err.Error())
-			channel <- res
-			continue
-		}
-		if err = driver.Setup(test.EnvVars, test.Setup); err != nil {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runCommandTest(channel, test)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) runCommandTest(channel chan interface{}, test CommandTest) {
+	if !test.Validate(channel) {
+		return
+	}
+	args := st.DriverArgs
+	if test.Timeout != "" {
+		// already validated
+		args.Timeout, _ = time.ParseDuration(test.Timeout)
+	}
+	st.withDriver(channel, test.LogName(), args, func(driver drivers.Driver) {
+		if err := driver.Setup(test.EnvVars, test.Setup); err != nil {
+			res := &types.TestResult{Name: test.LogName()}
 			res.Errorf("error in setup: %s", err.Error())
+			res.TimedOut = drivers.IsTimeout(err)
 			channel <- res
-			continue
+			return
 		}
 		defer func() {
 			if err := driver.Teardown(test.Teardown); err != nil {
 				logrus.Error(err.Error())
 			}
 		}()
-		channel <- test.Run(driver)
-	}
+		channel <- expected(test.TestOptions, test.Run(driver))
+	})
 }
 
-func (st *StructureTest) RunFileExistenceTests(channel chan interface{}) {
+func (st *StructureTest) fileExistenceTestJobs() []utils.Job {
+	var jobs []utils.Job
 	for _, test := range st.FileExistenceTests {
-		if !test.Validate(channel) {
-			continue
-		}
-		res := &types.TestResult{
-			Name: test.Name,
-			Pass: false,
-		}
-		driver, err := st.NewDriver()
-		if err != nil {
-			res.Errorf("error creating driver: %s", err.Error())
-			channel <- res
-			continue
-		}
-		if err = driver.SetEnv(st.GlobalEnvVars); err != nil {
-			res.Errorf("error setting env vars: %s", err.Error())
-			channel <- res
-			continue
-		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runDriverTest(channel, test, test.TestOptions)
+		}))
 	}
+	return jobs
 }
 
-func (st *StructureTest) RunFileContentTests(channel chan interface{}) {
+func (st *StructureTest) fileContentTestJobs() []utils.Job {
+	var jobs []utils.Job
 	for _, test := range st.FileContentTests {
-		if !test.Validate(channel) {
-			continue
-		}
-		res := &types.TestResult{
-			Name: test.Name,
-			Pass: false,
-		}
-		driver, err := st.NewDriver()
-		if err != nil {
-			res.Errorf("error creating driver: %s", err.Error())
-			channel <- res
-			continue
-		}
-		if err = driver.SetEnv(st.GlobalEnvVars); err != nil {
-			res.Errorf("error setting env vars: %s", err.Error())
-			channel <- res
-			continue
-		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runDriverTest(channel, test, test.TestOptions)
+		}))
 	}
+	return jobs
 }
 
-func (st *StructureTest) RunMetadataTests(channel chan interface{}) {
-	if st.MetadataTest.IsEmpty() {
-		logrus.Debug("Skipping empty metadata test")
+func (st *StructureTest) layerTestJobs() []utils.Job {
+	var jobs []utils.Job
+	for _, test := range st.LayerTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runLayerTest(channel, test)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) runLayerTest(channel chan interface{}, test LayerTest) {
+	if !test.Validate(channel) {
 		return
 	}
-	if !st.MetadataTest.Validate(channel) {
+	layers, err := st.imageLayers()
+	if err != nil {
+		channel <- &types.TestResult{
+			Name: test.LogName(),
+			Errors: []string{
+				fmt.Sprintf("error retrieving image layers: %s", err.Error()),
+			},
+		}
 		return
 	}
-	driver, err := st.NewDriver()
+	channel <- expected(test.TestOptions, test.Run(layers))
+}
+
+func (st *StructureTest) secretTestJobs() []utils.Job {
+	var jobs []utils.Job
+	for _, test := range st.SecretTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runSecretTest(channel, test)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) runSecretTest(channel chan interface{}, test SecretTest) {
+	if !test.Validate(channel) {
+		return
+	}
+	layers, err := st.imageLayers()
 	if err != nil {
 		channel <- &types.TestResult{
-			Name: st.MetadataTest.LogName(),
+			Name: test.LogName(),
 			Errors: []string{
-				fmt.Sprintf("error creating driver: %s", err.Error()),
+				fmt.Sprintf("error retrieving image layers: %s", err.Error()),
 			},
 		}
 		return
 	}
-	channel <- st.MetadataTest.Run(driver)
-	driver.Destroy()
+	channel <- expected(test.TestOptions, test.Run(layers))
+}
+
+func (st *StructureTest) packageTestJobs() []utils.Job {
+	var jobs []utils.Job
+	for _, test := range st.PackageTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runDriverTest(channel, test, test.TestOptions)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) userTestJobs() []utils.Job {
+	var jobs []utils.Job
+	for _, test := range st.UserTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runDriverTest(channel, test, test.TestOptions)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) fileTreeTestJobs() []utils.Job {
+	var jobs []utils.Job
+	for _, test := range st.FileTreeTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runDriverTest(channel, test, test.TestOptions)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) structuredContentTestJobs() []utils.Job {
+	var jobs []utils.Job
+	for _, test := range st.StructuredContentTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runDriverTest(channel, test, test.TestOptions)
+		}))
+	}
+	return jobs
 }
 
-func (st *StructureTest) RunLicenseTests(channel chan interface{}) {
+func (st *StructureTest) certificateTestJobs() []utils.Job {
+	var jobs []utils.Job
+	for _, test := range st.CertificateTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runDriverTest(channel, test, test.TestOptions)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) binaryTestJobs() []utils.Job {
+	var jobs []utils.Job
+	for _, test := range st.BinaryTests {
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runDriverTest(channel, test, test.TestOptions)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) metadataTestJobs() []utils.Job {
+	if st.MetadataTest.IsEmpty() {
+		logrus.Debug("Skipping empty metadata test")
+		return nil
+	}
+	return []utils.Job{st.filtered(st.MetadataTest.LogName(), st.MetadataTest.TestOptions, st.runMetadataTest)}
+}
+
+func (st *StructureTest) runMetadataTest(channel chan interface{}) {
+	st.runDriverTest(channel, st.MetadataTest, st.MetadataTest.TestOptions)
+}
+
+func (st *StructureTest) licenseTestJobs() []utils.Job {
+	var jobs []utils.Job
 	for _, test := range st.LicenseTests {
-		driver, err := st.NewDriver()
-		if err != nil {
-			logrus.Fatal(err.Error())
-		}
-		channel <- test.Run(driver)
-		driver.Destroy()
+		test := test
+		jobs = append(jobs, st.filtered(test.LogName(), test.TestOptions, func(channel chan interface{}) {
+			st.runLicenseTest(channel, test)
+		}))
+	}
+	return jobs
+}
+
+func (st *StructureTest) runLicenseTest(channel chan interface{}, test LicenseTest) {
+	if !test.Validate(channel) {
+		return
 	}
+	st.withDriver(channel, test.LogName(), st.DriverArgs, func(driver drivers.Driver) {
+		for _, result := range expectedAll(test.LogName(), test.TestOptions, test.Run(driver)) {
+			channel <- result
+		}
+	})
 }
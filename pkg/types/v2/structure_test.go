@@ -0,0 +1,129 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestExpectFailureOnlyForTestsThatRan(t *testing.T) {
+	expectFailure := TestOptions{ExpectFailure: "not fixed yet"}
+	st := &StructureTest{
+		DriverImpl: drivers.NewHostDriver,
+		FileExistenceTests: []FileExistenceTest{
+			// fails validation, so never runs
+			{Path: "/nonexistent/file", ShouldExist: true, TestOptions: expectFailure},
+			{Name: "missing", Path: "/nonexistent/file", ShouldExist: true, TestOptions: expectFailure},
+			{Name: "skipped", Path: "/nonexistent/file", TestOptions: TestOptions{Skip: "slow"}},
+		},
+	}
+	channel := make(chan interface{}, 10)
+	st.RunAll(channel, "test.yaml")
+	close(channel)
+
+	var states []types.Status
+	for res := range channel {
+		states = append(states, res.(*types.TestResult).State())
+	}
+	testutil.CheckDeepEqual(t, []types.Status{types.StatusFail, types.StatusXFail, types.StatusSkip}, states)
+}
+
+func TestIncludedTestsRecordFile(t *testing.T) {
+	st := &StructureTest{
+		DriverImpl: drivers.NewHostDriver,
+		FileExistenceTests: []FileExistenceTest{
+			{Name: "included", Path: "/", TestOptions: TestOptions{File: "base.yaml"}},
+			{Name: "skipped", Path: "/", TestOptions: TestOptions{Skip: "slow", File: "base.yaml"}},
+			{Name: "local", Path: "/"},
+		},
+	}
+	channel := make(chan interface{}, 10)
+	st.RunAll(channel, "test.yaml")
+	close(channel)
+
+	var files []string
+	for res := range channel {
+		files = append(files, res.(*types.TestResult).File)
+	}
+	testutil.CheckDeepEqual(t, []string{"base.yaml", "base.yaml", ""}, files)
+}
+
+func TestExpectFailureForLicenseTest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "licenses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mit, agpl := filepath.Join(dir, "mit"), filepath.Join(dir, "agpl")
+	ioutil.WriteFile(mit, []byte("Released under the MIT license\n"), 0644)
+	ioutil.WriteFile(agpl, []byte("Released under the AGPL\n"), 0644)
+
+	tables := []struct {
+		files    []string
+		expected []types.Status
+	}{
+		// only the failing file is an expected failure
+		{files: []string{mit, agpl, mit}, expected: []types.Status{types.StatusPass, types.StatusXFail, types.StatusPass}},
+		// passing files are reported as a single unexpected pass
+		{files: []string{mit, mit}, expected: []types.Status{types.StatusXPass}},
+	}
+	for _, table := range tables {
+		st := &StructureTest{
+			DriverImpl: drivers.NewHostDriver,
+			LicenseTests: []LicenseTest{
+				{Files: table.files, TestOptions: TestOptions{ExpectFailure: "not fixed yet"}},
+			},
+		}
+		channel := make(chan interface{}, 10)
+		st.RunAll(channel, "test.yaml")
+		close(channel)
+
+		var states []types.Status
+		for res := range channel {
+			states = append(states, res.(*types.TestResult).State())
+		}
+		testutil.CheckDeepEqual(t, table.expected, states)
+	}
+}
+
+func TestDriverErrorsNamedAfterTest(t *testing.T) {
+	st := &StructureTest{
+		DriverImpl: func(drivers.DriverConfig) (drivers.Driver, error) {
+			return nil, errors.New("no daemon")
+		},
+		CommandTests: []CommandTest{{Name: "echo", Command: "echo"}},
+		UserTests:    []UserTest{{Name: "root", UniqueRoot: true}},
+		MetadataTest: MetadataTest{User: "root"},
+	}
+	channel := make(chan interface{}, 10)
+	st.RunAll(channel, "test.yaml")
+	close(channel)
+
+	var names []string
+	for res := range channel {
+		r := res.(*types.TestResult)
+		names = append(names, r.Name)
+		testutil.CheckDeepEqual(t, []string{"error creating driver: no daemon"}, r.Errors)
+	}
+	testutil.CheckDeepEqual(t, []string{"Command Test: echo", "Metadata Test", "User Test: root"}, names)
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v2
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/structured"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+type StructuredContentTest struct {
+	Name       string                `yaml:"name"`       // name of test
+	Path       string                `yaml:"path"`       // file to parse
+	Format     string                `yaml:"format"`     // json, yaml, toml or ini, detected from the file extension if empty
+	Assertions []StructuredAssertion `yaml:"assertions"` // values expected in the parsed file
+
+	TestOptions `yaml:",inline"`
+}
+
+type StructuredAssertion struct {
+	Query   string      `yaml:"query"`   // JSONPath-like expression selecting values, e.g. $.server.port
+	Equals  interface{} `yaml:"equals"`  // value every selected value should equal
+	Matches string      `yaml:"matches"` // regex every selected scalar value should match
+	Exists  *bool       `yaml:"exists"`  // whether the query should select anything, true unless set
+	Type    string      `yaml:"type"`    // type of every selected value: string, number, boolean, array, object or null
+	Length  *int        `yaml:"length"`  // number of elements of every selected array or object
+}
+
+func (st StructuredContentTest) format() string {
+	if st.Format != "" {
+		return strings.ToLower(st.Format)
+	}
+	return structured.FormatFor(st.Path)
+}
+
+func (st StructuredContentTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if st.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = st.Name
+	if st.Path == "" {
+		res.Errorf("Please provide a valid file path for test %s", st.Name)
+	}
+	if format := st.format(); format == "" {
+		res.Errorf("Could not detect the format of %s for test %s, please provide one of %s", st.Path, st.Name, strings.Join(structured.Formats, ", "))
+	} else if !structured.ValidFormat(format) {
+		res.Errorf("Invalid format %s for test %s, please provide one of %s", st.Format, st.Name, strings.Join(structured.Formats, ", "))
+	}
+	if len(st.Assertions) == 0 {
+		res.Errorf("Please provide at least one assertion for test %s", st.Name)
+	}
+	for _, a := range st.Assertions {
+		if _, err := structured.ParseQuery(a.Query); err != nil {
+			res.Errorf("Invalid query for test %s: %s", st.Name, err)
+		}
+		if a.Matches != "" {
+			if _, err := regexp.Compile(a.Matches); err != nil {
+				res.Errorf("Invalid regex %s for test %s: %s", a.Matches, st.Name, err)
+			}
+		}
+		if a.Type != "" && !validType(a.Type) {
+			res.Errorf("Invalid type %s for test %s, please provide one of %s", a.Type, st.Name, strings.Join(structured.Types, ", "))
+		}
+	}
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func validType(t string) bool {
+	for _, valid := range structured.Types {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
+
+func (st StructuredContentTest) LogName() string {
+	return fmt.Sprintf("Structured Content Test: %s", st.Name)
+}
+
+func (st StructuredContentTest) Run(driver drivers.Driver) *types.TestResult {
+	result := &types.TestResult{
+		Name:   st.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(st.LogName())
+	config, err := driver.GetConfig()
+	if err != nil {
+		logrus.Errorf("error retrieving image config: %s", err.Error())
+	}
+	p := utils.SubstituteEnvVar(st.Path, config.Env)
+	contents, err := driver.ReadFile(p)
+	if err != nil {
+		result.Errorf("Failed to open %s. Error: %s", p, err)
+		result.Fail()
+		return result
+	}
+	doc, err := structured.Parse(st.format(), contents)
+	if err != nil {
+		result.Errorf("Failed to parse %s: %s", p, err)
+		result.Fail()
+		return result
+	}
+	for _, a := range st.Assertions {
+		// already validated
+		q, _ := structured.ParseQuery(a.Query)
+		a.check(result, p, q.Find(doc))
+	}
+	return result
+}
+
+func (a StructuredAssertion) check(result *types.TestResult, file string, values []interface{}) {
+	if a.Exists != nil && !*a.Exists {
+		if len(values) > 0 {
+			result.Errorf("%s: %s should not exist but is %s", file, a.Query, structured.Summarize(values[0]))
+			result.Fail()
+		}
+		return
+	}
+	if len(values) == 0 {
+		result.Errorf("%s: %s not found", file, a.Query)
+		result.Fail()
+		return
+	}
+	var expected interface{}
+	if a.Equals != nil {
+		expected = structured.Normalize(a.Equals)
+	}
+	for _, v := range values {
+		if a.Equals != nil && !reflect.DeepEqual(expected, v) {
+			result.Errorf("%s: %s has incorrect value. Expected: %s, Actual: %s", file, a.Query, structured.Summarize(expected), structured.Summarize(v))
+			result.Fail()
+		}
+		if a.Type != "" && structured.TypeOf(v) != a.Type {
+			result.Errorf("%s: %s has incorrect type. Expected: %s, Actual: %s", file, a.Query, a.Type, structured.TypeOf(v))
+			result.Fail()
+		}
+		if a.Matches != "" {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				result.Errorf("%s: %s is of type %s, expected a value matching %s", file, a.Query, structured.TypeOf(v), a.Matches)
+				result.Fail()
+			default:
+				if !regexp.MustCompile(a.Matches).MatchString(fmt.Sprint(v)) {
+					result.Errorf("%s: %s does not match %s, Actual: %s", file, a.Query, a.Matches, structured.Summarize(v))
+					result.Fail()
+				}
+			}
+		}
+		if a.Length != nil {
+			n := -1
+			switch v := v.(type) {
+			case map[string]interface{}:
+				n = len(v)
+			case []interface{}:
+				n = len(v)
+			}
+			if n < 0 {
+				result.Errorf("%s: %s is of type %s, expected an array or object of length %d", file, a.Query, structured.TypeOf(v), *a.Length)
+				result.Fail()
+			} else if n != *a.Length {
+				result.Errorf("%s: %s has incorrect length. Expected: %d, Actual: %d", file, a.Query, *a.Length, n)
+				result.Fail()
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/accounts"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/drivers"
+	types "github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+	"github.com/GoogleContainerTools/container-structure-test/pkg/utils"
+)
+
+type UserTest struct {
+	Name             string         `yaml:"name"`             // name of test
+	Users            []ExpectedUser `yaml:"users"`            // accounts that must exist
+	UniqueRoot       bool           `yaml:"uniqueRoot"`       // fail if any account other than root has uid 0
+	NoEmptyPasswords bool           `yaml:"noEmptyPasswords"` // fail if any account has an empty password hash
+
+	TestOptions `yaml:",inline"`
+}
+
+// ExpectedUser is an account that must exist in /etc/passwd. unset fields
+// aren't checked.
+type ExpectedUser struct {
+	Name   string   `yaml:"name"`
+	Uid    *int     `yaml:"uid"`
+	Gid    *int     `yaml:"gid"`
+	Home   string   `yaml:"home"`
+	Shell  string   `yaml:"shell"`
+	Groups []string `yaml:"groups"` // groups the user must belong to, as its primary group or a member
+}
+
+func (ut UserTest) Validate(channel chan interface{}) bool {
+	res := &types.TestResult{}
+	if ut.Name == "" {
+		res.Error("Please provide a valid name for every test")
+	}
+	res.Name = ut.Name
+	for _, u := range ut.Users {
+		if u.Name == "" {
+			res.Errorf("Please provide a valid name for every expected user in test %s", ut.Name)
+		}
+	}
+	if len(ut.Users) == 0 && !ut.UniqueRoot && !ut.NoEmptyPasswords {
+		res.Errorf("Please provide users or account checks to run in test %s", ut.Name)
+	}
+	if len(res.Errors) > 0 {
+		channel <- res
+		return false
+	}
+	return true
+}
+
+func (ut UserTest) LogName() string {
+	return fmt.Sprintf("User Test: %s", ut.Name)
+}
+
+func (ut UserTest) Run(driver drivers.Driver) *types.TestResult {
+	result := &types.TestResult{
+		Name:   ut.LogName(),
+		Pass:   true,
+		Errors: make([]string, 0),
+	}
+	logrus.Info(ut.LogName())
+	contents, err := driver.ReadFile(accounts.PasswdFile)
+	if err != nil {
+		result.Errorf("Error reading %s: %s", accounts.PasswdFile, err)
+		result.Fail()
+		return result
+	}
+	users, err := accounts.ParsePasswd(contents)
+	if err != nil {
+		result.Errorf("Error parsing %s: %s", accounts.PasswdFile, err)
+		result.Fail()
+		return result
+	}
+
+	var groups []accounts.Group
+	for _, u := range ut.Users {
+		if len(u.Groups) == 0 {
+			continue
+		}
+		contents, err := driver.ReadFile(accounts.GroupFile)
+		if err != nil {
+			result.Errorf("Error reading %s: %s", accounts.GroupFile, err)
+			result.Fail()
+			return result
+		}
+		if groups, err = accounts.ParseGroup(contents); err != nil {
+			result.Errorf("Error parsing %s: %s", accounts.GroupFile, err)
+			result.Fail()
+			return result
+		}
+		break
+	}
+
+	for _, expected := range ut.Users {
+		ut.checkUser(result, expected, users, groups)
+	}
+
+	if ut.UniqueRoot {
+		for _, u := range users {
+			if u.Uid == 0 && u.Name != "root" {
+				result.Errorf("Account %s has uid 0", u.Name)
+				result.Fail()
+			}
+		}
+	}
+
+	if ut.NoEmptyPasswords {
+		for _, u := range users {
+			if u.Password == "" {
+				result.Errorf("Account %s has an empty password in %s", u.Name, accounts.PasswdFile)
+				result.Fail()
+			}
+		}
+		contents, err := driver.ReadFile(accounts.ShadowFile)
+		if err != nil {
+			// without a shadow file, accounts can only have passwords in /etc/passwd
+			logrus.Warnf("unable to read %s, only checking %s: %s", accounts.ShadowFile, accounts.PasswdFile, err)
+			return result
+		}
+		shadows, err := accounts.ParseShadow(contents)
+		if err != nil {
+			result.Errorf("Error parsing %s: %s", accounts.ShadowFile, err)
+			result.Fail()
+			return result
+		}
+		for _, s := range shadows {
+			if s.Password == "" {
+				result.Errorf("Account %s has an empty password in %s", s.Name, accounts.ShadowFile)
+				result.Fail()
+			}
+		}
+	}
+	return result
+}
+
+func (ut UserTest) checkUser(result *types.TestResult, expected ExpectedUser, users []accounts.User, groups []accounts.Group) {
+	var user *accounts.User
+	for i := range users {
+		if users[i].Name == expected.Name {
+			user = &users[i]
+			break
+		}
+	}
+	if user == nil {
+		result.Errorf("Expected user %s does not exist", expected.Name)
+		result.Fail()
+		return
+	}
+	if expected.Uid != nil && user.Uid != *expected.Uid {
+		result.Errorf("User %s has uid %d, expected %d", user.Name, user.Uid, *expected.Uid)
+		result.Fail()
+	}
+	if expected.Gid != nil && user.Gid != *expected.Gid {
+		result.Errorf("User %s has gid %d, expected %d", user.Name, user.Gid, *expected.Gid)
+		result.Fail()
+	}
+	if expected.Home != "" && user.Home != expected.Home {
+		result.Errorf("User %s has home %s, expected %s", user.Name, user.Home, expected.Home)
+		result.Fail()
+	}
+	if expected.Shell != "" && user.Shell != expected.Shell {
+		result.Errorf("User %s has shell %s, expected %s", user.Name, user.Shell, expected.Shell)
+		result.Fail()
+	}
+	member := accounts.Groups(*user, groups)
+	for _, g := range expected.Groups {
+		if !utils.ValueInList(g, member) {
+			result.Errorf("User %s is not a member of group %s", user.Name, g)
+			result.Fail()
+		}
+	}
+}
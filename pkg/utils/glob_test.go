@@ -0,0 +1,56 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tables := []struct {
+		glob    string
+		matches []string
+		misses  []string
+	}{
+		{"**/*.pem", []string{"/key.pem", "/etc/ssl/private/key.pem"}, []string{"/etc/key.pem.bak", "/etc/pem"}},
+		{"**/.npmrc", []string{"/.npmrc", "/root/.npmrc"}, []string{"/root/.npmrc2", "/root/x.npmrc"}},
+		{"/root/.ssh/*", []string{"/root/.ssh/id_rsa"}, []string{"/root/.ssh", "/root/.ssh/keys/id_rsa", "/home/root/.ssh/id_rsa"}},
+		{"root/**", []string{"/root/a", "/root/a/b"}, []string{"/rootfs/a"}},
+		{"**/id_?sa", []string{"/id_rsa", "/home/u/.ssh/id_dsa"}, []string{"/id_ecdsa"}},
+		{"**/id_[!d]sa", []string{"/id_rsa"}, []string{"/id_dsa"}},
+		{"/app/a+b.txt", []string{"/app/a+b.txt"}, []string{"/app/aab.txt"}},
+	}
+
+	for _, table := range tables {
+		r, err := CompileGlob(table.glob)
+		if err != nil {
+			t.Fatalf("compiling %s: %s", table.glob, err)
+		}
+		for _, m := range table.matches {
+			if !r.MatchString(m) {
+				t.Errorf("expected %s to match %s", table.glob, m)
+			}
+		}
+		for _, m := range table.misses {
+			if r.MatchString(m) {
+				t.Errorf("expected %s not to match %s", table.glob, m)
+			}
+		}
+	}
+
+	if _, err := CompileGlob("/etc/[abc"); err == nil {
+		t.Errorf("expected error for unterminated character class")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/pkg/types/unversioned"
+)
+
+// Job is a unit of work which writes its results to the provided channel.
+type Job func(chan interface{})
+
+// RunJobs runs the provided jobs on a pool of at most parallel workers.
+// Every job writes into its own channel, and the results are forwarded to the
+// output channel in the order the jobs were provided, regardless of the order
+// in which they finish.
+func RunJobs(channel chan interface{}, parallel int, jobs []Job) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	outputs := make([]chan interface{}, len(jobs))
+	for i := range outputs {
+		outputs[i] = make(chan interface{}, 1)
+	}
+
+	workers := make(chan struct{}, parallel)
+	go func() {
+		for i, job := range jobs {
+			workers <- struct{}{}
+			go func(job Job, out chan interface{}) {
+				defer func() {
+					close(out)
+					<-workers
+				}()
+				job(out)
+			}(job, outputs[i])
+		}
+	}()
+
+	for _, out := range outputs {
+		for res := range out {
+			channel <- res
+		}
+	}
+}
+
+// Timed wraps a job so that every test result it produces records the time it
+// took to produce, including creating and setting up the driver.
+func Timed(job Job) Job {
+	return func(channel chan interface{}) {
+		start := time.Now()
+		results := make(chan interface{}, 1)
+		go func() {
+			defer close(results)
+			job(results)
+		}()
+		for res := range results {
+			if r, ok := res.(*unversioned.TestResult); ok {
+				r.Duration = time.Since(start)
+			}
+			channel <- res
+		}
+	}
+}
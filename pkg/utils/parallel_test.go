@@ -0,0 +1,83 @@
+// Copyright 2019 Google Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/container-structure-test/testutil"
+)
+
+func TestRunJobs(t *testing.T) {
+	tables := []struct {
+		jobs     int
+		parallel int
+	}{
+		{0, 4},
+		{1, 1},
+		{10, 1},
+		{10, 3},
+		{10, 20},
+		{5, 0},
+	}
+
+	for _, table := range tables {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+
+		var jobs []Job
+		var expected []interface{}
+		for i := 0; i < table.jobs; i++ {
+			i := i
+			expected = append(expected, i)
+			jobs = append(jobs, func(channel chan interface{}) {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+
+				// later jobs finish first
+				time.Sleep(time.Duration(table.jobs-i) * time.Millisecond)
+				channel <- i
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+			})
+		}
+
+		channel := make(chan interface{}, table.jobs)
+		RunJobs(channel, table.parallel, jobs)
+		close(channel)
+
+		var actual []interface{}
+		for res := range channel {
+			actual = append(actual, res)
+		}
+		testutil.CheckDeepEqual(t, expected, actual)
+
+		limit := table.parallel
+		if limit < 1 {
+			limit = 1
+		}
+		if maxRunning > limit {
+			t.Errorf("expected at most %d jobs to run at once but %d did", limit, maxRunning)
+		}
+	}
+}